@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+
+	checker "apgcheck/src"
+)
+
+func runAudit(args []string) int {
+	return runSubcommand("audit", args)
+}
+
+// runAuditVerify checks the hash chain of an audit log and prints the
+// number of entries and the last hash, which a later verification should
+// find again.
+func runAuditVerify(args []string) int {
+	fs := newFlagSet("audit verify")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	quiet := fs.BoolP("quiet", "q", false, "suppress output")
+	isJson := fs.BoolP("json", "j", false, "output in JSON format")
+	expect := fs.String("expect-hash", "", "fail unless the log contains an entry with this hash, such as the last hash of an earlier verification")
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck audit verify <log>%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	entries, err := checker.VerifyAuditLog(fs.Arg(0))
+	found := *expect == ""
+	last := ""
+	for _, e := range entries {
+		found = found || e.Hash == *expect
+		last = e.Hash
+	}
+	if err == nil && !found {
+		err = fmt.Errorf("no entry has hash %s, entries were removed", *expect)
+	}
+
+	if *isJson {
+		out := map[string]any{"valid": err == nil, "entries": len(entries), "last_hash": last}
+		if err != nil {
+			out["error"] = err.Error()
+		}
+		data, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(data))
+	} else if !*quiet {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		} else {
+			fmt.Printf("%s✓ Audit log intact: %d entries%s\n", colors.Green, len(entries), colors.Reset)
+			if last != "" {
+				fmt.Printf("Last hash: %s\n", last)
+			}
+		}
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// operatorName is who is recorded as taking a decision when no
+// --operator is given.
+func operatorName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// recordAudit appends the decision about a package, known to clients by
+// name, to the audit log.
+func recordAudit(log *checker.AuditLog, apgFile, name string, c *checker.Checker, policy, operator string, report checker.ValidationResponse, err error) error {
+	return log.Record(apgFile, checker.AuditEntry{
+		Package:      name,
+		Policy:       policy,
+		PolicySHA256: checker.PolicyDigest(c.Policy),
+		Result:       checker.AuditResult(report, err),
+		Errors:       len(report.Errors),
+		Warnings:     len(report.Warnings),
+		Operator:     operator,
+	})
+}
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	checker "apgcheck/src"
+)
+
+func runBundle(args []string) int {
+	fs := newFlagSet("bundle")
+	apgVersion := fs.IntP("apg-version", "A", 0, "APG format version (1 or 2, 0 to detect per package)")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	quiet := fs.BoolP("quiet", "q", false, "suppress output")
+	isJson := fs.BoolP("json", "j", false, "output in JSON format")
+	format := formatFlag(fs, "text", "json", "csv")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	skipSums := fs.Bool("skip-checksums", false, "skip verification of MD5 and CRC32 hashes")
+	limits := addLimitFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	output, err := outputFormat(*format, *isJson, "text", "json", "csv")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 2
+	}
+
+	if fs.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck bundle <file.apg> <file.apg>... [options]%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	c, ok := limits.newChecker(*verbose, *skipSums, colors)
+	if !ok {
+		return 1
+	}
+	report, err := c.ValidateBundle(fs.Args(), *apgVersion)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sExtraction Error: %v%s\n", colors.Red, err, colors.Reset)
+		printHint(err.Error(), "", colors)
+		return 1
+	}
+
+	if output == "json" {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else if output == "csv" {
+		if err := writeCSV(report.Packages); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+	} else if !*quiet {
+		for _, r := range report.Packages {
+			if r.Valid {
+				fmt.Printf("%s✓ %s%s\n", colors.Green, r.File, colors.Reset)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "%s✗ %s%s\n", colors.Red, r.File, colors.Reset)
+			printErrors(r.Errors, "  ", colors)
+		}
+		printErrors(report.Errors, "", colors)
+		if report.Valid {
+			fmt.Printf("%s✓ Bundle of %d packages is consistent%s\n", colors.Green, len(report.Packages), colors.Reset)
+		}
+	}
+
+	findings := report.Findings
+	for _, r := range report.Packages {
+		findings = append(findings, r.Findings...)
+	}
+	return c.Policy.ExitCode(report.Valid, findings)
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	checker "apgcheck/src"
+)
+
+func runCompareReports(args []string) int {
+	fs := newFlagSet("compare-reports")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	quiet := fs.BoolP("quiet", "q", false, "suppress output")
+	isJson := fs.BoolP("json", "j", false, "output in JSON format")
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck compare-reports <old.json> <new.json>%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	old, err := checker.LoadReportFindings(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+	new, err := checker.LoadReportFindings(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+	cmp := checker.CompareFindings(old, new)
+
+	if *isJson {
+		out, _ := json.MarshalIndent(cmp, "", "  ")
+		fmt.Println(string(out))
+	} else if !*quiet {
+		for _, f := range cmp.Fixed {
+			fmt.Printf("%sFixed %s: %s%s%s\n", colors.Green, f.Severity, packagePrefix(f), f.Message, colors.Reset)
+		}
+		for _, f := range cmp.New {
+			color := colors.Red
+			if f.Severity == "warning" {
+				color = colors.Yellow
+			}
+			fmt.Fprintf(os.Stderr, "%sNew %s: %s%s%s%s\n", color, f.Severity, packagePrefix(f), f.Message, codeSuffix(f.Message), colors.Reset)
+		}
+		if len(cmp.New) == 0 {
+			fmt.Printf("%s✓ no new findings%s (%d fixed, %d unchanged)\n", colors.Green, colors.Reset, len(cmp.Fixed), cmp.Unchanged)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s✗ %d new findings%s (%d fixed, %d unchanged)\n", colors.Red, len(cmp.New), colors.Reset, len(cmp.Fixed), cmp.Unchanged)
+		}
+	}
+
+	if len(cmp.New) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func packagePrefix(f checker.ComparedFinding) string {
+	if f.Package == "" {
+		return ""
+	}
+	return f.Package + ": "
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	checker "apgcheck/src"
+)
+
+func runCompat(args []string) int {
+	fs := newFlagSet("compat")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	isJson := fs.BoolP("json", "j", false, "output in JSON format")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck compat <file.deb|file.rpm>%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	c := checker.New(*verbose, false, colors, 0)
+	report, err := c.CompatReport(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+
+	if *isJson {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+
+	fmt.Printf("%s%s package %s %s%s\n", colors.Bold, report.Format, report.Metadata.Name, report.Metadata.Version, colors.Reset)
+	fmt.Println("APG v2 metadata.json equivalent:")
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	enc.Encode(report.Metadata)
+	for _, field := range report.Missing {
+		fmt.Printf("%sMissing: '%s' cannot be derived and must be filled in by hand%s\n", colors.Yellow, field, colors.Reset)
+	}
+	for _, note := range report.Notes {
+		fmt.Printf("%sNote: %s%s\n", colors.Blue, note, colors.Reset)
+	}
+	return 0
+}
@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	checker "apgcheck/src"
+)
+
+// showingConfig makes validation print its resolved configuration instead
+// of validating, so config show resolves flags exactly as validation does.
+var showingConfig bool
+
+// configSetting is one resolved setting and where its value came from:
+// "default", "command line", an APGCHECK_* variable, a --policy file, or,
+// for policy settings, the flag overriding it.
+type configSetting struct {
+	Name   string          `json:"name"`
+	Value  json.RawMessage `json:"value"`
+	Source string          `json:"source"`
+}
+
+type configReport struct {
+	Flags  []configSetting `json:"flags"`
+	Policy []configSetting `json:"policy"`
+}
+
+func runConfig(args []string) int {
+	return runSubcommand("config", args)
+}
+
+// runConfigShow takes the flags of validation and prints the configuration
+// they resolve to.
+func runConfigShow(args []string) int {
+	showingConfig = true
+	defer func() { showingConfig = false }()
+	return runValidate(args)
+}
+
+// showConfig prints the flags of validation and the effective policy with
+// the source of each value.
+func showConfig(fs *pflag.FlagSet, limits *limitFlags, output string, colors checker.Colors) int {
+	// APGCHECK_FORMAT is set for every command and may name a format
+	// only validation has.
+	if output != "text" && output != "json" && flagSource(fs.Lookup("format")) == "APGCHECK_FORMAT" {
+		output = "text"
+	}
+	if output != "text" && output != "json" {
+		fmt.Fprintf(os.Stderr, "%sError: config show supports --format text or json%s\n", colors.Red, colors.Reset)
+		return 1
+	}
+
+	var report configReport
+	fs.VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" || f.Name == "version" {
+			return
+		}
+		value, _ := json.Marshal(f.Value.String())
+		report.Flags = append(report.Flags, configSetting{Name: "--" + f.Name, Value: value, Source: flagSource(f)})
+	})
+
+	// The configuration is only shown, so nothing is confined.
+	*limits.harden = false
+	c, ok := limits.newChecker(false, false, colors)
+	if !ok {
+		return 1
+	}
+	fromFile := map[string]bool{}
+	if *limits.policy != "" {
+		fromFile = policyKeys(*limits.policy)
+	}
+	effective, _ := json.Marshal(c.Policy)
+	var raw any
+	json.Unmarshal(effective, &raw)
+	settings := flattenJSON("", raw)
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		source := "default"
+		for file := range fromFile {
+			if key == file || strings.HasPrefix(key, file+".") || strings.HasPrefix(file, key+".") {
+				source = "policy " + *limits.policy
+			}
+		}
+		for _, pf := range policyFlags {
+			if pf.key == key && fs.Changed(pf.flag) {
+				source = "--" + pf.flag
+				if f := fs.Lookup(pf.flag); flagSource(f) != "command line" {
+					source += " from " + flagSource(f)
+				}
+			}
+		}
+		report.Policy = append(report.Policy, configSetting{Name: key, Value: settings[key], Source: source})
+	}
+	// max_file_size_mb follows max_total_size_mb unless it is set itself.
+	if i := slices.IndexFunc(report.Policy, func(s configSetting) bool { return s.Name == "limits.max_file_size_mb" }); i >= 0 && report.Policy[i].Source == "default" {
+		if j := slices.IndexFunc(report.Policy, func(s configSetting) bool { return s.Name == "limits.max_total_size_mb" }); j >= 0 {
+			report.Policy[i].Source = report.Policy[j].Source
+		}
+	}
+
+	if output == "json" {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	fmt.Printf("%sFlags:%s\n", colors.Bold, colors.Reset)
+	printSettings(report.Flags, colors)
+	fmt.Printf("\n%sPolicy:%s\n", colors.Bold, colors.Reset)
+	printSettings(report.Policy, colors)
+	return 0
+}
+
+// flagSource tells where the value of a flag came from.
+func flagSource(f *pflag.Flag) string {
+	if env := f.Annotations[envAnnotation]; len(env) > 0 {
+		return env[0]
+	}
+	if f.Changed {
+		return "command line"
+	}
+	return "default"
+}
+
+func printSettings(settings []configSetting, colors checker.Colors) {
+	width := 0
+	for _, s := range settings {
+		width = max(width, len(s.Name))
+	}
+	for _, s := range settings {
+		value := string(s.Value)
+		var str string
+		if json.Unmarshal(s.Value, &str) == nil {
+			value = str
+		}
+		source := s.Source
+		if source != "default" {
+			source = colors.Yellow + source + colors.Reset
+		}
+		fmt.Printf("  %-*s  %s  (%s)\n", width, s.Name, value, source)
+	}
+}
+
+// flattenJSON returns the leaves of a decoded JSON object by their dotted
+// keys; arrays and empty objects are leaves.
+func flattenJSON(prefix string, v any) map[string]json.RawMessage {
+	out := map[string]json.RawMessage{}
+	if m, ok := v.(map[string]any); ok && len(m) > 0 {
+		for key, value := range m {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			maps.Copy(out, flattenJSON(key, value))
+		}
+		return out
+	}
+	if prefix != "" {
+		out[prefix], _ = json.Marshal(v)
+	}
+	return out
+}
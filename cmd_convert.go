@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	checker "apgcheck/src"
+)
+
+func runConvert(args []string) int {
+	fs := newFlagSet("convert")
+	output := fs.StringP("output", "o", "", "directory to write the APG skeleton to (default: package name without extension)")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	isJson := fs.BoolP("json", "j", false, "output in JSON format")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck convert <file.deb|file.rpm> [-o dir]%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	outDir := *output
+	if outDir == "" {
+		outDir = strings.TrimSuffix(filepath.Base(fs.Arg(0)), filepath.Ext(fs.Arg(0)))
+	}
+
+	c := checker.New(*verbose, false, colors, 0)
+	result, err := c.Convert(fs.Arg(0), outDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+
+	if *isJson {
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+
+	fmt.Printf("%s✓ APG skeleton written to %s (%d files)%s\n", colors.Green, result.OutDir, result.Files, colors.Reset)
+	for _, field := range result.TODO {
+		fmt.Printf("%sTODO: fill in '%s' in metadata.json%s\n", colors.Yellow, field, colors.Reset)
+	}
+	for _, note := range result.Notes {
+		fmt.Printf("%sNote: %s%s\n", colors.Blue, note, colors.Reset)
+	}
+	fmt.Printf("Pack it with: tar -C %s -cJf <name>.apg .\n", result.OutDir)
+	return 0
+}
@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	checker "apgcheck/src"
+)
+
+func runDelta(args []string) int {
+	fs := newFlagSet("delta")
+	base := fs.String("base", "", "package the delta applies to")
+	target := fs.String("target", "", "package the delta must reconstruct (requires --base)")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	quiet := fs.BoolP("quiet", "q", false, "suppress output")
+	isJson := fs.BoolP("json", "j", false, "output in JSON format")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	skipSums := fs.Bool("skip-checksums", false, "skip verification of MD5 hashes")
+	limits := addLimitFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck delta <file.apgdelta> [--base old.apg [--target new.apg]]%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	c, ok := limits.newChecker(*verbose, *skipSums, colors)
+	if !ok {
+		return 1
+	}
+	report, err := c.ValidateDelta(fs.Arg(0), *base, *target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sExtraction Error: %v%s\n", colors.Red, err, colors.Reset)
+		printHint(err.Error(), "", colors)
+		return 1
+	}
+
+	if *isJson {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else if !*quiet {
+		if report.Valid {
+			fmt.Printf("%s✓ APG delta validation successful%s\n", colors.Green, colors.Reset)
+			fmt.Printf("File: %s\n", report.File)
+		} else {
+			printErrors(report.Errors, "", colors)
+		}
+	}
+
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	checker "apgcheck/src"
+)
+
+func runGenMan(args []string) int {
+	fs := newFlagSet("gen-man")
+	output := fs.StringP("output", "o", "", "write the man page to this file instead of stdout")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck gen-man [-o apgcheck.1]%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	page := manPage()
+	if *output == "" {
+		fmt.Print(page)
+		return 0
+	}
+	if err := os.WriteFile(*output, []byte(page), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+	return 0
+}
+
+// manPage renders apgcheck(1). The date is taken from SOURCE_DATE_EPOCH
+// when set, so distribution builds of the page are reproducible.
+func manPage() string {
+	date := time.Now()
+	if v, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		date = time.Unix(v, 0)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH APGCHECK 1 %q \"apgcheck %s\" \"User Commands\"\n", date.UTC().Format("2006-01-02"), checker.Version)
+	b.WriteString(".SH NAME\napgcheck \\- APG file validator for NurOS\n")
+	b.WriteString(".SH SYNOPSIS\n.B apgcheck\n\\fB\\-a\\fR \\fIfile.apg\\fR [\\fIoptions\\fR]\n.br\n.B apgcheck\n\\fIcommand\\fR [\\fIoptions\\fR] [\\fIarguments\\fR]\n")
+	b.WriteString(".SH DESCRIPTION\n")
+	b.WriteString("apgcheck validates NurOS packages against the APG v1 and v2 specifications: " +
+		"it checks the archive structure, verifies checksums and validates metadata fields. " +
+		"Without a command it validates the package given with \\fB\\-\\-apgfile\\fR.\n")
+
+	b.WriteString(".SH OPTIONS\n")
+	manFlags(&b, describeFlags(root))
+
+	b.WriteString(".SH COMMANDS\n")
+	var walk func(prefix string, cmds []command)
+	walk = func(prefix string, cmds []command) {
+		for _, cmd := range cmds {
+			if len(cmd.subcommands) > 0 {
+				walk(prefix+cmd.name+" ", cmd.subcommands)
+				continue
+			}
+			fmt.Fprintf(&b, ".SS %s\n%s.\n", roffEscape(prefix+cmd.name), roffEscape(capitalize(cmd.summary)))
+			manFlags(&b, describeFlags(cmd))
+		}
+	}
+	walk("", commands)
+
+	b.WriteString(".SH EXIT STATUS\n")
+	b.WriteString(".TP\n.B 0\nThe package is valid, the command succeeded, or \\fB\\-\\-help\\fR was given.\n")
+	b.WriteString(".TP\n.B 1\nValidation or a check failed, or a file could not be read.\n")
+	b.WriteString(".TP\n.B 2\nA command was used incorrectly: an unknown or malformed option, missing or extra arguments, or an unknown subcommand.\n")
+
+	b.WriteString(".SH RULES\n")
+	b.WriteString("Findings carry the code and ID of the rule that classified them; codes are stable across versions.\n")
+	for _, r := range checker.Rules() {
+		scope := fmt.Sprintf("Severity: %s; applies to %s", r.Severity, strings.Join(r.AppliesTo, ", "))
+		if r.Requires != "" {
+			scope += "; requires " + r.Requires
+		}
+		fmt.Fprintf(&b, ".TP\n.B %s %s\n%s.\n%s.\n.br\nHint: %s.\n", r.Code, roffEscape(r.ID), roffEscape(capitalize(r.Summary)), roffEscape(scope), roffEscape(r.Hint))
+	}
+
+	b.WriteString(".SH ENVIRONMENT\n")
+	b.WriteString("The APGCHECK_* variables set the flags they correspond to. Flags given on the command line override them, and both override the settings of the policy file.\n")
+	b.WriteString(".TP\n.B APGCHECK_FORMAT\nOutput format, as \\fB\\-\\-format\\fR; \\fBjson\\fR or \\fBtext\\fR for commands with \\fB\\-\\-json\\fR. Commands that do not support the format ignore it.\n")
+	b.WriteString(".TP\n.B APGCHECK_PROFILE\nPolicy file to validate with, as \\fB\\-\\-policy\\fR.\n")
+	b.WriteString(".TP\n.B APGCHECK_TEMPDIR\nDirectory to extract packages into, as \\fB\\-\\-temp\\-dir\\fR.\n")
+	b.WriteString(".TP\n.B APGCHECK_NO_COLOR\nDisable colored output, as \\fB\\-\\-no\\-color\\fR.\n")
+	b.WriteString(".TP\n.B NO_COLOR\nDisable colored output.\n")
+	b.WriteString(".TP\n.B SOURCE_DATE_EPOCH\nThe timestamp deterministic archives are expected to use.\n")
+	b.WriteString(".SH SEE ALSO\nhttps://github.com/NurOS\\-Linux/apgcheck\n")
+	return b.String()
+}
+
+func manFlags(b *strings.Builder, fs *pflag.FlagSet) {
+	fs.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+		b.WriteString(".TP\n")
+		if f.Shorthand != "" {
+			fmt.Fprintf(b, "\\fB\\-%s\\fR, ", f.Shorthand)
+		}
+		fmt.Fprintf(b, "\\fB\\-\\-%s\\fR", roffEscape(f.Name))
+		if takesValue(f) {
+			fmt.Fprintf(b, " \\fI%s\\fR", f.Value.Type())
+		}
+		b.WriteString("\n" + roffEscape(capitalize(f.Usage)))
+		if takesValue(f) && f.DefValue != "" && f.DefValue != "[]" && f.DefValue != "0" {
+			fmt.Fprintf(b, " (default: %s)", roffEscape(f.DefValue))
+		}
+		b.WriteString(".\n")
+	})
+}
+
+// capitalize starts a sentence, leaving file names such as metadata.json
+// as they are.
+func capitalize(s string) string {
+	first, _, _ := strings.Cut(s, " ")
+	if s == "" || strings.Contains(first, ".") {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// roffEscape escapes text for use in a man page: backslashes and hyphens
+// are escaped, and lines are kept from starting with a control character.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	checker "apgcheck/src"
+)
+
+func runGraph(args []string) int {
+	fs := newFlagSet("graph")
+	repoIndex := fs.String("repo-index", "", "repository index to resolve dependencies against")
+	format := formatFlag(fs, "dot", "json")
+	apgVersion := fs.IntP("apg-version", "A", 0, "APG format version (1 or 2, 0 to detect per package)")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	skipSums := fs.Bool("skip-checksums", false, "skip verification of MD5 and CRC32 hashes")
+	limits := addLimitFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck graph <file.apg>... [--repo-index <index>] [--format dot|json]%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+	if _, err := outputFormat(*format, false, "dot", "json"); err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 2
+	}
+
+	var idx *checker.RepoIndex
+	if *repoIndex != "" {
+		var err error
+		if idx, err = checker.LoadIndex(*repoIndex); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+	}
+
+	c, ok := limits.newChecker(*verbose, *skipSums, colors)
+	if !ok {
+		return 1
+	}
+	var roots []checker.MetadataV2
+	for _, f := range fs.Args() {
+		meta, ok := lockRoot(f, idx, *apgVersion, c, colors)
+		if !ok {
+			return 1
+		}
+		roots = append(roots, meta)
+	}
+
+	g := checker.BuildGraph(roots, idx)
+	if *format == "json" {
+		out, _ := json.MarshalIndent(g, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		fmt.Print(g.DOT())
+	}
+
+	for _, cycle := range g.Cycles {
+		fmt.Fprintf(os.Stderr, "%sError: dependency cycle: %s%s\n", colors.Red, strings.Join(cycle, " ↔ "), colors.Reset)
+	}
+	if len(g.Cycles) > 0 {
+		return 1
+	}
+	return 0
+}
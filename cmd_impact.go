@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	checker "apgcheck/src"
+)
+
+func runImpact(args []string) int {
+	fs := newFlagSet("impact")
+	repoIndex := fs.String("repo-index", "", "repository index to check reverse dependencies against")
+	apgVersion := fs.IntP("apg-version", "A", 0, "APG format version (1 or 2, 0 to detect)")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	isJson := fs.BoolP("json", "j", false, "output in JSON format")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	skipSums := fs.Bool("skip-checksums", false, "skip verification of MD5 and CRC32 hashes")
+	limits := addLimitFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 1 || *repoIndex == "" {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck impact --repo-index <index> <file.apg>%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	idx, err := checker.LoadIndex(*repoIndex)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+
+	c, ok := limits.newChecker(*verbose, *skipSums, colors)
+	if !ok {
+		return 1
+	}
+	report, err := c.ValidateFile(fs.Arg(0), *apgVersion)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sExtraction Error: %v%s\n", colors.Red, err, colors.Reset)
+		printHint(err.Error(), "", colors)
+		return 1
+	}
+	if !report.Valid {
+		printErrors(report.Errors, "", colors)
+		return 1
+	}
+
+	impact := idx.Impact(checker.MetadataFromMap(report.Metadata))
+
+	if *isJson {
+		out, _ := json.MarshalIndent(impact, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		fmt.Printf("%s%s %s%s", colors.Bold, impact.Package, impact.Version, colors.Reset)
+		if impact.PublishedVersion != "" {
+			fmt.Printf(" (published: %s)", impact.PublishedVersion)
+		}
+		fmt.Println()
+		for _, name := range impact.RemovedProvides {
+			fmt.Printf("%sNo longer provides: %s%s\n", colors.Yellow, name, colors.Reset)
+		}
+		if len(impact.ReverseDependencies) == 0 {
+			fmt.Println("No published packages depend on it")
+		}
+		for _, rd := range impact.ReverseDependencies {
+			if rd.Broken {
+				fmt.Printf("%s✗ %s %s (%s): %s%s\n", colors.Red, rd.Package, rd.Version, rd.Dependency, rd.Reason, colors.Reset)
+			} else {
+				fmt.Printf("%s✓ %s %s (%s)%s\n", colors.Green, rd.Package, rd.Version, rd.Dependency, colors.Reset)
+			}
+		}
+	}
+
+	if impact.Broken() {
+		return 1
+	}
+	return 0
+}
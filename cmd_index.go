@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	checker "apgcheck/src"
+)
+
+func runIndex(args []string) int {
+	return runSubcommand("index", args)
+}
+
+func runIndexVerify(args []string) int {
+	fs := newFlagSet("index verify")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	quiet := fs.BoolP("quiet", "q", false, "suppress output")
+	isJson := fs.BoolP("json", "j", false, "output in JSON format")
+	format := formatFlag(fs, "text", "json", "csv")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	skipSums := fs.Bool("skip-checksums", false, "skip verification of MD5 and CRC32 hashes")
+	limits := addLimitFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	output, err := outputFormat(*format, *isJson, "text", "json", "csv")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 2
+	}
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "%sError: index verify expects exactly one index file%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	c, ok := limits.newChecker(*verbose, *skipSums, colors)
+	if !ok {
+		return 1
+	}
+	report, err := c.VerifyIndex(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+
+	failed := 0
+	for _, r := range report.Packages {
+		if !r.Valid {
+			failed++
+		}
+	}
+
+	if output == "json" {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else if output == "csv" {
+		if err := writeCSV(report.Packages); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+	} else if !*quiet {
+		for _, r := range report.Packages {
+			if r.Valid {
+				fmt.Printf("%s✓ %s%s\n", colors.Green, r.File, colors.Reset)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "%s✗ %s%s\n", colors.Red, r.File, colors.Reset)
+			printErrors(r.Errors, "  ", colors)
+		}
+		printFileConflicts(report.FileConflicts, colors)
+		fmt.Printf("%d packages checked, %d failed\n", len(report.Packages), failed)
+	}
+
+	var findings []checker.Finding
+	for _, r := range report.Packages {
+		findings = append(findings, r.Findings...)
+	}
+	for _, conflict := range report.FileConflicts {
+		findings = append(findings, checker.Finding{Severity: "error", Message: fmt.Sprintf("%s is shipped by several packages", conflict.Path)})
+	}
+	return c.Policy.ExitCode(report.Valid, findings)
+}
+
+func runIndexBuild(args []string) int {
+	fs := newFlagSet("index build")
+	output := fs.StringP("output", "o", "", "write the index to this file instead of stdout")
+	apgVersion := fs.IntP("apg-version", "A", 0, "APG format version (1 or 2, 0 to detect per package)")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	skipSums := fs.Bool("skip-checksums", false, "skip verification of MD5 and CRC32 hashes")
+	limits := addLimitFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "%sError: index build expects exactly one directory%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	if *output != "" {
+		limits.writable = append(limits.writable, filepath.Dir(*output))
+	}
+	c, ok := limits.newChecker(*verbose, *skipSums, colors)
+	if !ok {
+		return 1
+	}
+	idx, rejected, conflicts, err := c.BuildIndex(fs.Arg(0), *apgVersion)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+
+	for _, r := range rejected {
+		fmt.Fprintf(os.Stderr, "%s✗ %s excluded from index%s\n", colors.Red, r.File, colors.Reset)
+		printErrors(r.Errors, "  ", colors)
+	}
+
+	printFileConflicts(conflicts, colors)
+
+	out, _ := json.MarshalIndent(idx, "", "  ")
+	if *output == "" {
+		fmt.Println(string(out))
+	} else if err := os.WriteFile(*output, append(out, '\n'), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: failed to write index: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+
+	if len(rejected) > 0 || len(conflicts) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printFileConflicts(conflicts []checker.FileConflict, colors checker.Colors) {
+	for _, fc := range conflicts {
+		fmt.Fprintf(os.Stderr, "%sError: %s is installed by %s without a conflicts/replaces relation%s\n",
+			colors.Red, fc.Path, strings.Join(fc.Packages, ", "), colors.Reset)
+	}
+}
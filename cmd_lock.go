@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	checker "apgcheck/src"
+)
+
+func runLock(args []string) int {
+	fs := newFlagSet("lock")
+	repoIndex := fs.String("repo-index", "", "repository index to resolve dependencies against")
+	output := fs.StringP("output", "o", "", "write the lockfile to this file instead of stdout")
+	apgVersion := fs.IntP("apg-version", "A", 0, "APG format version (1 or 2, 0 to detect)")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	skipSums := fs.Bool("skip-checksums", false, "skip verification of MD5 and CRC32 hashes")
+	limits := addLimitFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 1 || *repoIndex == "" {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck lock --repo-index <index> <file.apg|package name>%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	idx, err := checker.LoadIndex(*repoIndex)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+
+	if *output != "" {
+		limits.writable = append(limits.writable, filepath.Dir(*output))
+	}
+	c, ok := limits.newChecker(*verbose, *skipSums, colors)
+	if !ok {
+		return 1
+	}
+
+	root, ok := lockRoot(fs.Arg(0), idx, *apgVersion, c, colors)
+	if !ok {
+		return 1
+	}
+
+	lock, errs := idx.Resolve(root)
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, e, colors.Reset)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+
+	out, _ := json.MarshalIndent(lock, "", "  ")
+	if *output == "" {
+		fmt.Println(string(out))
+	} else if err := os.WriteFile(*output, append(out, '\n'), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: failed to write lockfile: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+	return 0
+}
+
+func lockRoot(arg string, idx *checker.RepoIndex, apgVersion int, c *checker.Checker, colors checker.Colors) (checker.MetadataV2, bool) {
+	if filepath.Ext(arg) != ".apg" {
+		if idx == nil {
+			fmt.Fprintf(os.Stderr, "%sError: looking up '%s' by name requires --repo-index%s\n", colors.Red, arg, colors.Reset)
+			return checker.MetadataV2{}, false
+		}
+		entry, ok := idx.Find(arg)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%sError: package '%s' not found in the repository index%s\n", colors.Red, arg, colors.Reset)
+			return checker.MetadataV2{}, false
+		}
+		return checker.MetadataFromMap(entry.Metadata), true
+	}
+
+	report, err := c.ValidateFile(arg, apgVersion)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sExtraction Error: %v%s\n", colors.Red, err, colors.Reset)
+		printHint(err.Error(), "", colors)
+		return checker.MetadataV2{}, false
+	}
+	if !report.Valid {
+		printErrors(report.Errors, "", colors)
+		return checker.MetadataV2{}, false
+	}
+	return checker.MetadataFromMap(report.Metadata), true
+}
@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	checker "apgcheck/src"
+)
+
+func runRepro(args []string) int {
+	fs := newFlagSet("repro")
+	expectDigest := fs.String("expect-digest", "", "compare the normalized payload digest of one package against this digest")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	quiet := fs.BoolP("quiet", "q", false, "suppress output")
+	isJson := fs.BoolP("json", "j", false, "output in JSON format")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	limits := addLimitFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	want := 2
+	if *expectDigest != "" {
+		want = 1
+	}
+	if fs.NArg() != want {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck repro <old.apg> <new.apg>%s\n", colors.Red, colors.Reset)
+		fmt.Fprintf(os.Stderr, "%s       apgcheck repro <file.apg> --expect-digest <sha256>%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	c, ok := limits.newChecker(*verbose, false, colors)
+	if !ok {
+		return 1
+	}
+
+	var report *checker.ReproReport
+	if *expectDigest != "" {
+		_, digest, err := c.NormalizedPayload(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+		report = &checker.ReproReport{
+			Reproducible: strings.EqualFold(digest, *expectDigest),
+			Files:        []string{fs.Arg(0)},
+			Digests:      []string{digest},
+			Differences:  []string{},
+		}
+		if !report.Reproducible {
+			report.Differences = append(report.Differences, fmt.Sprintf("payload digest %s does not match expected %s", digest, *expectDigest))
+		}
+	} else {
+		var err error
+		report, err = c.Repro(fs.Arg(0), fs.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+	}
+
+	if *isJson {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else if !*quiet {
+		if report.Reproducible {
+			fmt.Printf("%s✓ payloads are bit-identical%s\n", colors.Green, colors.Reset)
+			fmt.Printf("Digest: %s\n", report.Digests[0])
+		} else {
+			fmt.Fprintf(os.Stderr, "%s✗ payloads differ%s\n", colors.Red, colors.Reset)
+			for _, d := range report.Differences {
+				fmt.Fprintf(os.Stderr, "%s  %s%s\n", colors.Red, d, colors.Reset)
+			}
+		}
+	}
+
+	if !report.Reproducible {
+		return 1
+	}
+	return 0
+}
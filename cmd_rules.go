@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	checker "apgcheck/src"
+)
+
+func runRules(args []string) int {
+	fs := newFlagSet("rules")
+	format := formatFlag(fs, "text", "json", "markdown")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	output, err := outputFormat(*format, false, "text", "json", "markdown")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 2
+	}
+
+	rules, ok := selectRules(fs.Args(), colors)
+	if !ok {
+		return 1
+	}
+
+	if output == "json" {
+		out, _ := json.MarshalIndent(ruleCatalog{Version: checker.Version, Rules: rules}, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	if output == "markdown" {
+		fmt.Print(rulesMarkdown(rules))
+		return 0
+	}
+
+	for i, r := range rules {
+		if i > 0 {
+			fmt.Println()
+		}
+		severity := colors.Red
+		if r.Severity == "warning" {
+			severity = colors.Yellow
+		}
+		fmt.Printf("%s%s %s%s  %s%s%s\n", colors.Bold, r.Code, r.ID, colors.Reset, severity, r.Severity, colors.Reset)
+		fmt.Printf("  %s\n", r.Summary)
+		fmt.Printf("  Applies to: %s\n", strings.Join(r.AppliesTo, ", "))
+		if r.Requires != "" {
+			fmt.Printf("  Requires: %s\n", r.Requires)
+		}
+		for _, o := range r.Options {
+			fmt.Printf("  Option: %s: %s\n", strings.Join(optionNames(o), ", "), o.Effect)
+		}
+		fmt.Printf("  %sHint: %s%s\n", colors.Blue, r.Hint, colors.Reset)
+		fmt.Printf("  Docs: %s\n", r.DocsURL)
+	}
+	return 0
+}
+
+// rulesMarkdown renders the rule reference that rule codes link to, with a
+// section per rule anchored at its code.
+func rulesMarkdown(rules []checker.Rule) string {
+	var b strings.Builder
+	b.WriteString("# apgcheck rules\n\n")
+	b.WriteString("Every finding apgcheck reports is classified by one of these rules. Rule codes are stable across versions and are never reused, so suppressions, baselines and bug reports can refer to them. This file is generated with `apgcheck rules --format markdown > RULES.md`.\n")
+	for _, r := range rules {
+		fmt.Fprintf(&b, "\n## %s\n\n", r.Code)
+		fmt.Fprintf(&b, "**%s** (%s): %s.\n\n", r.ID, r.Severity, r.Summary)
+		fmt.Fprintf(&b, "- Applies to: %s\n", strings.Join(r.AppliesTo, ", "))
+		if r.Requires != "" {
+			fmt.Fprintf(&b, "- Requires: `%s`\n", r.Requires)
+		}
+		for _, o := range r.Options {
+			var names []string
+			for _, n := range optionNames(o) {
+				names = append(names, "`"+n+"`")
+			}
+			fmt.Fprintf(&b, "- Option %s: %s\n", strings.Join(names, ", "), o.Effect)
+		}
+		fmt.Fprintf(&b, "- Fix: %s\n", r.Hint)
+	}
+	return b.String()
+}
+
+// ruleCatalog is the JSON export of the rules, for generating documentation
+// and policy editors.
+type ruleCatalog struct {
+	Version string         `json:"version"`
+	Rules   []checker.Rule `json:"rules"`
+}
+
+func optionNames(o checker.RuleOption) []string {
+	var names []string
+	if o.Flag != "" {
+		names = append(names, o.Flag)
+	}
+	if o.Policy != "" {
+		names = append(names, o.Policy)
+	}
+	return names
+}
+
+// selectRules returns the rules named by ids, or the whole catalog when no
+// ids are given.
+func selectRules(ids []string, colors checker.Colors) ([]checker.Rule, bool) {
+	if len(ids) == 0 {
+		return checker.Rules(), true
+	}
+	var selected []checker.Rule
+	for _, id := range ids {
+		rule, ok := checker.RuleByID(id)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%sError: unknown rule '%s'%s\n", colors.Red, id, colors.Reset)
+			return nil, false
+		}
+		selected = append(selected, rule)
+	}
+	return selected, true
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	checker "apgcheck/src"
+)
+
+func runSelftest(args []string) int {
+	fs := newFlagSet("selftest")
+	suite := fs.String("suite", "", "directory of golden packages with .expect.json files (default: built-in cases)")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	quiet := fs.BoolP("quiet", "q", false, "suppress output")
+	isJson := fs.BoolP("json", "j", false, "output in JSON format")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	limits := addLimitFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	dir := *suite
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "apgcheck-selftest-")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+		defer os.RemoveAll(tmp)
+		if err := checker.SynthesizeSuite(tmp); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: failed to synthesize test packages: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+		dir = tmp
+		limits.writable = append(limits.writable, tmp)
+	}
+
+	c, ok := limits.newChecker(*verbose, false, colors)
+	if !ok {
+		return 1
+	}
+	results, err := c.RunSuite(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+	if *suite == "" {
+		for i := range results {
+			results[i].File = filepath.Base(results[i].File)
+		}
+	}
+	return printSuiteResults(results, *isJson, *quiet, colors)
+}
+
+func printSuiteResults(results []checker.SuiteResult, isJson, quiet bool, colors checker.Colors) int {
+	failed := 0
+	for _, r := range results {
+		if !r.Passed {
+			failed++
+		}
+	}
+
+	if isJson {
+		out, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(out))
+	} else if !quiet {
+		for _, r := range results {
+			if r.Passed {
+				fmt.Printf("%s✓ %s%s\n", colors.Green, r.File, colors.Reset)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "%s✗ %s%s\n", colors.Red, r.File, colors.Reset)
+			for _, p := range r.Problems {
+				fmt.Fprintf(os.Stderr, "%s  %s%s\n", colors.Red, p, colors.Reset)
+			}
+		}
+		fmt.Printf("%d cases, %d passed, %d failed\n", len(results), len(results)-failed, failed)
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,643 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	checker "apgcheck/src"
+)
+
+// server validates packages uploaded over HTTP. Every request validates
+// with its own copy of the current checker, which a reload replaces.
+type server struct {
+	current    atomic.Pointer[serveConfig]
+	load       func() (*serveConfig, bool)
+	watched    []string
+	apgVersion int
+	colors     checker.Colors
+
+	// slots holds a token for every validation running; waiting counts
+	// the requests queued for one.
+	slots        chan struct{}
+	waiting      atomic.Int64
+	maxQueue     int64
+	queueTimeout time.Duration
+	limiter      *rateLimiter
+	uploads      uploads
+	jobs         jobs
+	tracer       *checker.Tracer
+	audit        *checker.AuditLog
+}
+
+// serveConfig is what a reload replaces: the checker of the default
+// policy, those of the named policies clients may select, and the API
+// tokens, which map each token to the name of its client.
+type serveConfig struct {
+	checker  *checker.Checker
+	policies map[string]*checker.Checker
+	tokens   map[string]string
+}
+
+func runServe(args []string) int {
+	fs := newFlagSet("serve")
+	listen := fs.String("listen", "127.0.0.1:8080", "address to listen on")
+	apgVersion := fs.IntP("apg-version", "A", 1, "APG format version of uploads that do not give one (1 or 2)")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	skipSums := fs.Bool("skip-checksums", false, "skip verification of MD5 and CRC32 hashes")
+	limits := addLimitFlags(fs)
+	repoIndex := fs.String("repo-index", "", "repository index to resolve dependencies against")
+	baseManifest := fs.String("base-manifest", "", "base-system file list; fail packages that overwrite files of other packages in it")
+	scanLicenses := fs.Bool("scan-licenses", false, "detect licenses in shipped files and report those the package license does not cover")
+	strictMeta := fs.Bool("strict-metadata", false, "reject metadata keys the APG format does not define")
+	tokens := fs.String("tokens", "", "file of API clients, one 'name token' pair per line; requests must present a token")
+	tlsCert := fs.String("tls-cert", "", "serve HTTPS with this certificate")
+	tlsKey := fs.String("tls-key", "", "private key of --tls-cert")
+	clientCA := fs.String("client-ca", "", "require client certificates issued by these CAs (mutual TLS)")
+	maxConcurrent := fs.Int("max-concurrent", runtime.NumCPU(), "validations to run at once")
+	maxQueue := fs.Int64("max-queue", 16, "requests that may wait for a validation slot before new ones are refused")
+	queueTimeout := fs.Duration("queue-timeout", time.Minute, "how long a request may wait for a validation slot")
+	rate := fs.Float64("rate", 0, "uploads each client may submit per minute (0 for no limit)")
+	burst := fs.Int("burst", 5, "uploads a client may submit at once within --rate")
+	policies := fs.StringToString("policies", nil, "named policies clients may select with ?policy=NAME, as name=file pairs")
+	maxUploads := fs.Int("max-uploads", 32, "resumable uploads that may be in progress at once")
+	uploadTimeout := fs.Duration("upload-timeout", time.Hour, "how long a resumable upload is kept without a new chunk")
+	maxJobs := fs.Int("max-jobs", 64, "asynchronous jobs that may be queued or running at once")
+	jobTTL := fs.Duration("job-ttl", time.Hour, "how long the report of a finished job is kept")
+	callbacks := fs.StringSlice("allowed-callbacks", nil, "URL prefixes jobs may post their report to with ?callback=URL")
+	trace := addTraceFlags(fs)
+	auditLog := fs.String("audit-log", "", "append every decision to this hash-chained audit log, with the client as operator")
+	headerTimeout := fs.Duration("read-header-timeout", 10*time.Second, "how long a client may take to send the headers of a request")
+	readTimeout := fs.Duration("read-timeout", 15*time.Minute, "how long a client may take to send a request, body included (0 for no limit)")
+	writeTimeout := fs.Duration("write-timeout", 30*time.Minute, "how long a request may take from its headers to the end of the response, waiting and validating included (0 for no limit)")
+	idleTimeout := fs.Duration("idle-timeout", 2*time.Minute, "how long an idle keep-alive connection is kept open")
+	reload := fs.Duration("reload-interval", 2*time.Second, "how often to check the policy, index and base manifest for changes (0 to reload on SIGHUP only)")
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if *limits.harden && !*limits.sandbox {
+		fmt.Fprintf(os.Stderr, "%sError: serve needs --sandbox with --harden, since the server itself must accept connections%s\n", colors.Red, colors.Reset)
+		return 1
+	}
+
+	if *limits.cache != "" && !cacheIsDir(*limits.cache) {
+		fmt.Fprintf(os.Stderr, "%sError: serve needs a cache directory for --cache, which concurrent requests share; end the path with /%s\n", colors.Red, colors.Reset)
+		return 1
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") || (*clientCA != "" && *tlsCert == "") {
+		fmt.Fprintf(os.Stderr, "%sError: --tls-cert and --tls-key go together, and --client-ca requires them%s\n", colors.Red, colors.Reset)
+		return 1
+	}
+
+	if *headerTimeout <= 0 || *idleTimeout <= 0 || *readTimeout < 0 || *writeTimeout < 0 {
+		fmt.Fprintf(os.Stderr, "%sError: --read-header-timeout and --idle-timeout must be positive, --read-timeout and --write-timeout not negative%s\n", colors.Red, colors.Reset)
+		return 1
+	}
+
+	if *maxConcurrent < 1 || *maxQueue < 0 || *rate < 0 || *burst < 1 || *maxJobs < 0 {
+		fmt.Fprintf(os.Stderr, "%sError: --max-concurrent and --burst must be at least 1, --max-queue, --max-jobs and --rate not negative%s\n", colors.Red, colors.Reset)
+		return 1
+	}
+
+	for _, prefix := range *callbacks {
+		if u, err := url.Parse(prefix); err != nil || u.Scheme == "" || u.Host == "" || u.User != nil {
+			fmt.Fprintf(os.Stderr, "%sError: invalid --allowed-callbacks prefix '%s' (expected a URL such as https://hooks.example.com/apg)%s\n", colors.Red, prefix, colors.Reset)
+			return 1
+		}
+	}
+
+	s := &server{
+		apgVersion:   *apgVersion,
+		colors:       colors,
+		slots:        make(chan struct{}, *maxConcurrent),
+		maxQueue:     *maxQueue,
+		queueTimeout: *queueTimeout,
+		uploads:      uploads{byID: map[string]*upload{}, max: *maxUploads, timeout: *uploadTimeout},
+		jobs:         jobs{byID: map[string]*job{}, max: *maxJobs, ttl: *jobTTL, callbacks: *callbacks},
+		tracer:       trace.tracer(),
+	}
+	if *rate > 0 {
+		s.limiter = &rateLimiter{perMinute: *rate, burst: float64(*burst), clients: map[string]*bucket{}}
+	}
+	for name := range *policies {
+		if !policyName.MatchString(name) {
+			fmt.Fprintf(os.Stderr, "%sError: invalid policy name '%s' (expected letters, digits, '-' and '_')%s\n", colors.Red, name, colors.Reset)
+			return 1
+		}
+	}
+
+	s.load = func() (*serveConfig, bool) {
+		c, ok := limits.newChecker(*verbose, *skipSums, colors)
+		if !ok {
+			return nil, false
+		}
+		c.ScanLicenses = *scanLicenses
+		c.StrictMetadata = *strictMeta
+		if *repoIndex != "" {
+			idx, err := checker.LoadIndex(*repoIndex)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+				return nil, false
+			}
+			c.RepoIndex = idx
+		}
+		if *baseManifest != "" {
+			manifest, err := checker.LoadBaseManifest(*baseManifest)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+				return nil, false
+			}
+			c.BaseManifest = manifest
+		}
+		config := &serveConfig{checker: c, policies: map[string]*checker.Checker{}}
+		for name, file := range *policies {
+			named, ok := limits.newCheckerWithPolicy(file, *verbose, *skipSums, colors)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "%sError: cannot load policy %s%s\n", colors.Red, name, colors.Reset)
+				return nil, false
+			}
+			named.ScanLicenses, named.StrictMetadata = c.ScanLicenses, c.StrictMetadata
+			named.RepoIndex, named.BaseManifest = c.RepoIndex, c.BaseManifest
+			config.policies[name] = named
+		}
+		if *tokens != "" {
+			var err error
+			if config.tokens, err = loadTokens(*tokens); err != nil {
+				fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+				return nil, false
+			}
+		}
+		return config, true
+	}
+	for _, file := range []string{*limits.policy, *repoIndex, *baseManifest, *tokens} {
+		if file != "" {
+			s.watched = append(s.watched, file)
+		}
+	}
+	for _, file := range *policies {
+		s.watched = append(s.watched, file)
+	}
+
+	config, ok := s.load()
+	if !ok {
+		return 1
+	}
+	s.current.Store(config)
+	go s.watch(*reload)
+	go s.expireUploads()
+	go s.expireJobs()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/validate", s.handleValidate)
+	mux.HandleFunc("POST /v1/uploads", s.handleCreateUpload)
+	mux.HandleFunc("PATCH /v1/uploads/{id}", s.handleAppendUpload)
+	mux.HandleFunc("HEAD /v1/uploads/{id}", s.handleUploadOffset)
+	mux.HandleFunc("DELETE /v1/uploads/{id}", s.handleDeleteUpload)
+	mux.HandleFunc("POST /v1/uploads/{id}/validate", s.handleValidateUpload)
+	mux.HandleFunc("GET /v1/jobs/{id}", s.handleJob)
+	mux.HandleFunc("GET /v1/jobs/{id}/events", s.handleJobEvents)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	// Clients that send slowly, never read the response or leave a
+	// connection idle are cut off, so they cannot hold connections open
+	// before the rate limit and queue ever see a request.
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: *headerTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+	if *auditLog != "" {
+		var err error
+		if s.audit, err = checker.OpenAuditLog(*auditLog); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+	}
+	if s.tracer != nil {
+		srv.Handler = s.traced(mux)
+		go s.exportSpans()
+	}
+	if *clientCA != "" {
+		pem, err := os.ReadFile(*clientCA)
+		pool := x509.NewCertPool()
+		if err != nil || !pool.AppendCertsFromPEM(pem) {
+			fmt.Fprintf(os.Stderr, "%sError: cannot read client CAs from %s%s\n", colors.Red, *clientCA, colors.Reset)
+			return 1
+		}
+		srv.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	}
+	if *tokens == "" && *clientCA == "" {
+		fmt.Fprintf(os.Stderr, "%sWarning: no --tokens or --client-ca, any client can submit packages%s\n", colors.Yellow, colors.Reset)
+	}
+
+	fmt.Fprintf(os.Stderr, "%sListening on %s%s\n", colors.Blue, *listen, colors.Reset)
+	var err error
+	if *tlsCert != "" {
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+	return 0
+}
+
+// watch reloads the configuration on SIGHUP and, with a non-zero
+// interval, when a watched file changes. A configuration that fails to
+// load is reported and the previous one kept.
+func (s *server) watch(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var tick <-chan time.Time
+	if interval > 0 {
+		tick = time.Tick(interval)
+	}
+	stamps := s.stamps()
+	for {
+		select {
+		case <-hup:
+			stamps = s.stamps()
+			s.reload("SIGHUP")
+		case <-tick:
+			now := s.stamps()
+			if now == stamps {
+				continue
+			}
+			stamps = now
+			s.reload("a configuration file changed")
+		}
+	}
+}
+
+var policyName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// stamps identifies the state of the watched files by their sizes and
+// modification times.
+func (s *server) stamps() string {
+	var stamp string
+	for _, file := range s.watched {
+		if fi, err := os.Stat(file); err == nil {
+			stamp += fmt.Sprintf("%s %d %d\n", file, fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+	return stamp
+}
+
+func (s *server) reload(reason string) {
+	config, ok := s.load()
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%sError: not reloading after %s, keeping the previous configuration%s\n", s.colors.Red, reason, s.colors.Reset)
+		return
+	}
+	s.current.Store(config)
+	fmt.Fprintf(os.Stderr, "%sReloaded the configuration after %s%s\n", s.colors.Blue, reason, s.colors.Reset)
+}
+
+// handleValidate validates the package in the request body. The APG
+// version comes from the version query parameter, source=1 validates a
+// source package, and name is the file name given in the report. With
+// async=1 the package is validated as a job.
+func (s *server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	config, client, ok := s.admit(w, r, true)
+	if !ok {
+		return
+	}
+	v, ok := s.parseValidation(w, r, config, client)
+	if !ok {
+		return
+	}
+	async := r.URL.Query().Get("async") == "1"
+	if async {
+		if !s.jobs.reserve(w, r) {
+			return
+		}
+	} else {
+		if err := s.acquire(r); err != nil {
+			s.logRequest(r, client, "rejected, "+err.Error())
+			w.Header().Set("Retry-After", strconv.Itoa(int(s.queueTimeout.Seconds())+1))
+			writeJSONError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		defer func() { <-s.slots }()
+	}
+
+	if limit := v.c.Policy.Limits.MaxTotalSizeMB; limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit*1024*1024)
+	}
+	upload, err := os.CreateTemp(cmp.Or(v.c.TempDir, "/tmp"), "apgcheck-upload-*.apg")
+	if err == nil {
+		v.file = upload.Name()
+		_, err = io.Copy(upload, r.Body)
+		upload.Close()
+	}
+	var tooLarge *http.MaxBytesError
+	if err != nil {
+		os.Remove(v.file)
+		if async {
+			s.jobs.release()
+		}
+	}
+	if errors.As(err, &tooLarge) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("upload is over the %d MB size limit (max_total_size_mb)", v.c.Policy.Limits.MaxTotalSizeMB))
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("cannot read the upload: %w", err))
+		return
+	}
+	if async {
+		s.submit(w, v)
+		return
+	}
+	defer os.Remove(v.file)
+	s.respond(w, v)
+}
+
+// admit authenticates a request and, for those starting an upload,
+// applies the client's rate limit. It answers refused requests itself.
+func (s *server) admit(w http.ResponseWriter, r *http.Request, rateLimited bool) (*serveConfig, string, bool) {
+	config := s.current.Load()
+	client, ok := config.authenticate(r)
+	if !ok {
+		s.logRequest(r, client, "rejected, not authorized")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="apgcheck"`)
+		writeJSONError(w, http.StatusUnauthorized, fmt.Errorf("missing or unknown API token"))
+		return nil, client, false
+	}
+	key := client
+	if client == "anonymous" {
+		key, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	if !rateLimited {
+		return config, client, true
+	}
+	if wait, ok := s.limiter.take(key); !ok {
+		s.logRequest(r, client, "rejected, over the rate limit")
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		writeJSONError(w, http.StatusTooManyRequests, fmt.Errorf("rate limit of %g uploads per minute exceeded", s.limiter.perMinute))
+		return nil, client, false
+	}
+	return config, client, true
+}
+
+// validation is a package to validate and how, as a request asks for it.
+type validation struct {
+	c        *checker.Checker
+	version  int
+	file     string
+	name     string
+	policy   string
+	client   string
+	remote   string
+	callback string
+}
+
+// parseValidation reads the policy, APG version, package kind and name a
+// request asks for, and copies the checker of the policy.
+func (s *server) parseValidation(w http.ResponseWriter, r *http.Request, config *serveConfig, client string) (*validation, bool) {
+	query := r.URL.Query()
+	v := &validation{
+		version:  s.apgVersion,
+		name:     cmp.Or(query.Get("name"), "upload.apg"),
+		policy:   cmp.Or(query.Get("policy"), "default"),
+		client:   client,
+		remote:   r.RemoteAddr,
+		callback: query.Get("callback"),
+	}
+	c := *config.checker
+	if policy := query.Get("policy"); policy != "" {
+		named, ok := config.policies[policy]
+		if !ok {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("unknown policy '%s' (available: %s)", policy, strings.Join(slices.Sorted(maps.Keys(config.policies)), ", ")))
+			return nil, false
+		}
+		c = *named
+	}
+	if version := query.Get("version"); version != "" {
+		n, err := strconv.Atoi(version)
+		if err != nil || (n != 1 && n != 2) {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid version '%s' (expected 1 or 2)", version))
+			return nil, false
+		}
+		v.version = n
+	}
+	c.SourcePackage = query.Get("source") == "1"
+	if s.tracer != nil {
+		c.Tracer, c.TraceParent = s.tracer, requestSpan(r)
+	}
+	v.c = &c
+	return v, true
+}
+
+// run validates a package and logs the outcome.
+func (s *server) run(v *validation) (checker.ValidationResponse, error) {
+	report, err := v.c.ValidateFile(v.file, v.version)
+	if s.audit != nil {
+		if err := recordAudit(s.audit, v.file, v.name, v.c, v.policy, v.client, report, err); err != nil {
+			s.log(v.remote, v.client, fmt.Sprintf("decision on %s withheld: %v", v.name, err))
+			return report, fmt.Errorf("%w: %w", errNotAudited, err)
+		}
+	}
+	if err != nil {
+		s.log(v.remote, v.client, fmt.Sprintf("%s could not be extracted: %v", v.name, err))
+		return report, err
+	}
+	report.File = v.name
+	result := "valid"
+	if !report.Valid {
+		result = "invalid"
+	}
+	s.log(v.remote, v.client, fmt.Sprintf("%s is %s under policy %s (%d errors, %d warnings)", v.name, result, v.policy, len(report.Errors), len(report.Warnings)))
+	return report, nil
+}
+
+// errNotAudited withholds a decision that could not be recorded in the
+// audit log.
+var errNotAudited = errors.New("decision could not be recorded in the audit log")
+
+// respond validates a package and answers with the report.
+func (s *server) respond(w http.ResponseWriter, v *validation) {
+	report, err := s.run(v)
+	if errors.Is(err, errNotAudited) {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// acquire waits for a validation slot. Requests are refused when the
+// queue is full, and when they wait longer than the queue timeout, so a
+// burst of uploads is held back before its bodies are read.
+func (s *server) acquire(r *http.Request) error {
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if s.waiting.Add(1) > s.maxQueue {
+		s.waiting.Add(-1)
+		return fmt.Errorf("server busy, all %d validation slots are in use and the queue is full", cap(s.slots))
+	}
+	defer s.waiting.Add(-1)
+	timer := time.NewTimer(s.queueTimeout)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("server busy, no validation slot within %s", s.queueTimeout)
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+}
+
+// rateLimiter gives every client a token bucket refilled at perMinute and
+// holding up to burst uploads.
+type rateLimiter struct {
+	perMinute float64
+	burst     float64
+	mu        sync.Mutex
+	clients   map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take spends a token of the client, or returns how long until one is
+// available. A nil limiter allows everything.
+func (l *rateLimiter) take(client string) (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if len(l.clients) > 4096 {
+		for name, b := range l.clients {
+			if b.tokens+now.Sub(b.last).Minutes()*l.perMinute >= l.burst {
+				delete(l.clients, name)
+			}
+		}
+	}
+	b, ok := l.clients[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.clients[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Minutes()*l.perMinute)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.perMinute * float64(time.Minute)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// authenticate names the client of a request: the name of its API token
+// and the subject of its client certificate, whichever the server
+// requires. Without tokens every request is accepted.
+func (config *serveConfig) authenticate(r *http.Request) (string, bool) {
+	var names []string
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		names = append(names, "cert:"+r.TLS.VerifiedChains[0][0].Subject.CommonName)
+	}
+	if config.tokens != nil {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		name := ""
+		for known, client := range config.tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+				name = client
+			}
+		}
+		if !ok || name == "" {
+			return strings.Join(names, " "), false
+		}
+		names = append([]string{name}, names...)
+	}
+	return cmp.Or(strings.Join(names, " "), "anonymous"), true
+}
+
+// logRequest records on stderr which client submitted what, and the
+// outcome.
+func (s *server) logRequest(r *http.Request, client, outcome string) {
+	s.log(r.RemoteAddr, client, outcome)
+}
+
+func (s *server) log(remote, client, outcome string) {
+	fmt.Fprintf(os.Stderr, "%s %s from %s: %s\n", time.Now().UTC().Format(time.RFC3339), cmp.Or(client, "unknown client"), remote, outcome)
+}
+
+// loadTokens reads a file of API clients: lines of a client name and its
+// token, with empty lines and lines starting with # ignored.
+func loadTokens(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %w", err)
+	}
+	tokens := map[string]string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) != 2:
+			return nil, fmt.Errorf("%s:%d: expected 'name token'", file, i+1)
+		case len(fields[1]) < 16:
+			return nil, fmt.Errorf("%s:%d: token of %s is shorter than 16 characters", file, i+1, fields[0])
+		case tokens[fields[1]] != "":
+			return nil, fmt.Errorf("%s:%d: %s has the same token as %s", file, i+1, fields[0], tokens[fields[1]])
+		}
+		tokens[fields[1]] = fields[0]
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no tokens in %s", file)
+	}
+	return tokens, nil
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
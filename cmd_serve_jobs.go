@@ -0,0 +1,241 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	checker "apgcheck/src"
+)
+
+// job is a validation submitted with async=1. It waits for a validation
+// slot like any request, but the client gets its ID at once and polls or
+// subscribes for the report.
+type job struct {
+	ID       string                      `json:"id"`
+	Status   string                      `json:"status"`
+	Report   *checker.ValidationResponse `json:"report,omitempty"`
+	Error    string                      `json:"error,omitempty"`
+	owner    string
+	callback string
+	finished time.Time
+	// changed is closed and replaced whenever the status changes.
+	changed chan struct{}
+}
+
+// jobs holds the asynchronous jobs, pending ones and finished ones whose
+// report has not expired.
+type jobs struct {
+	mu        sync.Mutex
+	byID      map[string]*job
+	pending   int
+	max       int
+	ttl       time.Duration
+	callbacks []string
+}
+
+// reserve admits a job, unless --max-jobs are already pending or the
+// callback it asks for is not allowed.
+func (j *jobs) reserve(w http.ResponseWriter, r *http.Request) bool {
+	if callback := r.URL.Query().Get("callback"); callback != "" && !j.allowedCallback(callback) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("callback '%s' is not under an --allowed-callbacks prefix", callback))
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.pending >= j.max {
+		w.Header().Set("Retry-After", "60")
+		writeJSONError(w, http.StatusServiceUnavailable, fmt.Errorf("server busy, %d jobs are pending", j.max))
+		return false
+	}
+	j.pending++
+	return true
+}
+
+func (j *jobs) release() {
+	j.mu.Lock()
+	j.pending--
+	j.mu.Unlock()
+}
+
+// allowedCallback reports whether a callback URL is under one of the
+// allowed prefixes: the same scheme and host, and a path at or below the
+// prefix's path. Plain string prefixes would also accept
+// https://hooks.example.com.evil/ and https://hooks.example.com@evil/.
+func (j *jobs) allowedCallback(callback string) bool {
+	u, err := url.Parse(callback)
+	if err != nil || u.User != nil || u.Host == "" || slices.Contains(strings.Split(u.Path, "/"), "..") {
+		return false
+	}
+	for _, prefix := range j.callbacks {
+		p, err := url.Parse(prefix)
+		if err != nil || p.Scheme != u.Scheme || !strings.EqualFold(p.Host, u.Host) {
+			continue
+		}
+		dir := strings.TrimSuffix(p.Path, "/")
+		if u.Path == dir || strings.HasPrefix(u.Path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// submit starts a reserved job for a package, which it removes when done,
+// and answers with the job's ID.
+func (s *server) submit(w http.ResponseWriter, v *validation) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	jb := &job{ID: hex.EncodeToString(id), Status: "queued", owner: v.client, callback: v.callback, changed: make(chan struct{})}
+	s.jobs.mu.Lock()
+	s.jobs.byID[jb.ID] = jb
+	s.jobs.mu.Unlock()
+	s.log(v.remote, v.client, fmt.Sprintf("queued %s as job %s", v.name, jb.ID))
+	go s.runJob(jb, v)
+
+	w.Header().Set("Location", "/v1/jobs/"+jb.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"id": jb.ID, "status": "queued"})
+}
+
+func (s *server) runJob(jb *job, v *validation) {
+	defer s.jobs.release()
+	defer os.Remove(v.file)
+	s.slots <- struct{}{}
+	s.setStatus(jb, func() { jb.Status = "running" })
+	report, err := s.run(v)
+	<-s.slots
+	s.setStatus(jb, func() {
+		if err != nil {
+			jb.Status, jb.Error = "failed", err.Error()
+		} else {
+			jb.Status, jb.Report = "done", &report
+		}
+		jb.finished = time.Now()
+	})
+	if jb.callback != "" {
+		s.notify(jb, v)
+	}
+}
+
+func (s *server) setStatus(jb *job, update func()) {
+	s.jobs.mu.Lock()
+	defer s.jobs.mu.Unlock()
+	update()
+	close(jb.changed)
+	jb.changed = make(chan struct{})
+}
+
+// notify posts the finished job to its callback URL.
+func (s *server) notify(jb *job, v *validation) {
+	body, _ := json.Marshal(jb)
+	// Redirects are not followed, or an allowed host could send the
+	// report on to an address callbacks may not reach.
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Post(jb.callback, "application/json", bytes.NewReader(body))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("status %s", resp.Status)
+		}
+	}
+	if err != nil {
+		s.log(v.remote, v.client, fmt.Sprintf("callback of job %s failed: %v", jb.ID, err))
+	}
+}
+
+// findJob authenticates a request for a job and returns a copy of it and
+// a channel closed on its next change. Only the client that submitted a
+// job may see it.
+func (s *server) findJob(w http.ResponseWriter, r *http.Request) (job, <-chan struct{}, bool) {
+	_, client, ok := s.admit(w, r, false)
+	if !ok {
+		return job{}, nil, false
+	}
+	s.jobs.mu.Lock()
+	defer s.jobs.mu.Unlock()
+	jb := s.jobs.byID[r.PathValue("id")]
+	if jb == nil || jb.owner != client {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("no job '%s'", r.PathValue("id")))
+		return job{}, nil, false
+	}
+	return *jb, jb.changed, true
+}
+
+// handleJob answers with the status of a job, and its report once done.
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	jb, _, ok := s.findJob(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jb)
+}
+
+// handleJobEvents streams the status of a job as server-sent events until
+// it is done or failed.
+func (s *server) handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	jb, changed, ok := s.findJob(w, r)
+	if !ok {
+		return
+	}
+	// The stream lasts as long as the job, however long that is.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for {
+		data, _ := json.Marshal(jb)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", jb.Status, data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if jb.Status == "done" || jb.Status == "failed" {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		s.jobs.mu.Lock()
+		current := s.jobs.byID[jb.ID]
+		if current == nil {
+			s.jobs.mu.Unlock()
+			return
+		}
+		jb, changed = *current, current.changed
+		s.jobs.mu.Unlock()
+	}
+}
+
+// expireJobs removes finished jobs older than the job TTL.
+func (s *server) expireJobs() {
+	for range time.Tick(cmp.Or(s.jobs.ttl/10, time.Second)) {
+		s.jobs.mu.Lock()
+		for id, jb := range s.jobs.byID {
+			if !jb.finished.IsZero() && time.Since(jb.finished) > s.jobs.ttl {
+				delete(s.jobs.byID, id)
+			}
+		}
+		s.jobs.mu.Unlock()
+	}
+}
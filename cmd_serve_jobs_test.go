@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import "testing"
+
+func TestAllowedCallback(t *testing.T) {
+	j := &jobs{callbacks: []string{"https://hooks.example.com", "https://ci.example.org/apg/"}}
+	tests := []struct {
+		callback string
+		allowed  bool
+	}{
+		{"https://hooks.example.com", true},
+		{"https://hooks.example.com/", true},
+		{"https://hooks.example.com/build?id=1", true},
+		{"https://HOOKS.example.com/build", true},
+		{"https://ci.example.org/apg/done", true},
+		{"https://ci.example.org/apg", true},
+		{"https://hooks.example.com.evil/", false},
+		{"https://hooks.example.com@evil/", false},
+		{"https://user@hooks.example.com/", false},
+		{"https://hooks.example.com:8443/", false},
+		{"http://hooks.example.com/", false},
+		{"https://ci.example.org/apgx", false},
+		{"https://ci.example.org/apg/../admin", false},
+		{"https://ci.example.org/apg/%2e%2e/admin", false},
+		{"/relative", false},
+		{"::", false},
+	}
+	for _, tt := range tests {
+		if got := j.allowedCallback(tt.callback); got != tt.allowed {
+			t.Errorf("allowedCallback(%q) = %v, want %v", tt.callback, got, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	checker "apgcheck/src"
+)
+
+type spanKey struct{}
+
+// statusRecorder remembers the status a handler answers with. It keeps
+// the writer flushable for server-sent events.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, so handlers
+// can change its deadlines.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// traced records a span for every request, continuing the trace of a
+// traceparent header, so a validation shows up in the trace of the
+// pipeline that submitted it.
+func (s *server) traced(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent, _ := checker.ParseTraceparent(r.Header.Get("traceparent"))
+		span := s.tracer.Start(r.Method, parent)
+		rec := &statusRecorder{ResponseWriter: w}
+		r = r.WithContext(context.WithValue(r.Context(), spanKey{}, span.Context()))
+		next.ServeHTTP(rec, r)
+
+		if r.Pattern != "" {
+			span.SetName(r.Pattern)
+		}
+		status := cmp.Or(rec.status, http.StatusOK)
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("http.route", r.Pattern)
+		span.SetAttribute("http.response.status_code", status)
+		if status >= 500 {
+			span.SetError(fmt.Errorf("%s", http.StatusText(status)))
+		}
+		span.End()
+	})
+}
+
+// requestSpan returns the context of the span recording a request.
+func requestSpan(r *http.Request) checker.SpanContext {
+	sc, _ := r.Context().Value(spanKey{}).(checker.SpanContext)
+	return sc
+}
+
+// exportSpans exports the recorded spans every few seconds.
+func (s *server) exportSpans() {
+	for range time.Tick(5 * time.Second) {
+		if err := s.tracer.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "%sWarning: %v%s\n", s.colors.Yellow, err, s.colors.Reset)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	checker "apgcheck/src"
+)
+
+// upload is a package uploaded in chunks. Chunks are appended at the
+// offset the client gives, so a client whose connection broke asks for
+// the offset and resumes from there.
+type upload struct {
+	mu      sync.Mutex
+	file    string
+	owner   string
+	size    int64
+	length  int64
+	touched time.Time
+}
+
+// uploads holds the resumable uploads in progress.
+type uploads struct {
+	mu      sync.Mutex
+	byID    map[string]*upload
+	max     int
+	timeout time.Duration
+}
+
+const xzMagic = "\xfd7zXZ\x00"
+
+// handleCreateUpload starts a resumable upload. The client may declare
+// the total size in an Upload-Length header.
+func (s *server) handleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	config, client, ok := s.admit(w, r, true)
+	if !ok {
+		return
+	}
+	limit := config.checker.Policy.Limits.MaxTotalSizeMB * 1024 * 1024
+	length := int64(-1)
+	if v := r.Header.Get("Upload-Length"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid Upload-Length '%s'", v))
+			return
+		}
+		if limit > 0 && n > limit {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("upload is over the %d MB size limit (max_total_size_mb)", limit>>20))
+			return
+		}
+		length = n
+	}
+
+	s.uploads.mu.Lock()
+	defer s.uploads.mu.Unlock()
+	if len(s.uploads.byID) >= s.uploads.max {
+		w.Header().Set("Retry-After", "60")
+		writeJSONError(w, http.StatusServiceUnavailable, fmt.Errorf("server busy, %d uploads are in progress", s.uploads.max))
+		return
+	}
+	f, err := os.CreateTemp(cmp.Or(config.checker.TempDir, "/tmp"), "apgcheck-upload-*.apg")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	f.Close()
+	id := make([]byte, 16)
+	rand.Read(id)
+	u := &upload{file: f.Name(), owner: client, length: length, touched: time.Now()}
+	s.uploads.byID[hex.EncodeToString(id)] = u
+	s.logRequest(r, client, "started upload "+hex.EncodeToString(id))
+
+	w.Header().Set("Location", "/v1/uploads/"+hex.EncodeToString(id))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"id": hex.EncodeToString(id), "offset": 0})
+}
+
+// handleAppendUpload appends the request body at the offset given in the
+// Upload-Offset header, which must be the size received so far. What
+// arrives before a connection breaks is kept. The first bytes are checked
+// to be an xz stream or a tar header, so other files are refused before
+// they are sent in full.
+func (s *server) handleAppendUpload(w http.ResponseWriter, r *http.Request) {
+	config, u, ok := s.findUpload(w, r)
+	if !ok {
+		return
+	}
+	defer u.mu.Unlock()
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != u.size {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.size, 10))
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("expected Upload-Offset %d, the size received so far", u.size))
+		return
+	}
+	// The declared length is a hard cap, even when it is 0, and the
+	// policy limit applies on its own whether a length was declared or not.
+	maxSize := config.checker.Policy.Limits.MaxTotalSizeMB * 1024 * 1024
+	overLimit := func(size int64) error {
+		if u.length >= 0 && size > u.length {
+			return fmt.Errorf("upload is over its declared length of %d bytes", u.length)
+		}
+		if maxSize > 0 && size > maxSize {
+			return fmt.Errorf("upload is over the %d MB size limit (max_total_size_mb)", maxSize>>20)
+		}
+		return nil
+	}
+	if r.ContentLength > 0 {
+		if err := overLimit(u.size + r.ContentLength); err != nil {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+	}
+	limit := maxSize
+	if u.length >= 0 && (limit <= 0 || u.length < limit) {
+		limit = u.length
+	}
+	body := io.Reader(r.Body)
+	if u.length >= 0 || maxSize > 0 {
+		body = io.LimitReader(r.Body, limit-u.size+1)
+	}
+
+	f, err := os.OpenFile(u.file, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	n, err := io.Copy(f, body)
+	f.Close()
+	u.size += n
+	u.touched = time.Now()
+	if err := overLimit(u.size); err != nil {
+		s.removeUpload(r.PathValue("id"))
+		writeJSONError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	if err := checkUploadHead(u); err != nil {
+		s.removeUpload(r.PathValue("id"))
+		writeJSONError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.size, 10))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("chunk interrupted, resume at offset %d: %w", u.size, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkUploadHead refuses uploads that start neither like an xz stream
+// nor with a tar header. A tar header is only recognised once its 512
+// bytes have arrived.
+func checkUploadHead(u *upload) error {
+	f, err := os.Open(u.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	if bytes.HasPrefix(head[:n], []byte(xzMagic)) || bytes.HasPrefix([]byte(xzMagic), head[:n]) {
+		return nil
+	}
+	if n < len(head) || checker.IsTarHeader(head) {
+		return nil
+	}
+	return errors.New("upload is neither an xz-compressed APG archive nor a tar archive")
+}
+
+// handleUploadOffset tells a client where to resume.
+func (s *server) handleUploadOffset(w http.ResponseWriter, r *http.Request) {
+	_, u, ok := s.findUpload(w, r)
+	if !ok {
+		return
+	}
+	defer u.mu.Unlock()
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.size, 10))
+	if u.length >= 0 {
+		w.Header().Set("Upload-Length", strconv.FormatInt(u.length, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleValidateUpload validates a complete upload, taking the same query
+// parameters as POST /v1/validate, and removes it. A job takes the
+// uploaded file over.
+func (s *server) handleValidateUpload(w http.ResponseWriter, r *http.Request) {
+	config, u, ok := s.findUpload(w, r)
+	if !ok {
+		return
+	}
+	defer u.mu.Unlock()
+	if u.length >= 0 && u.size != u.length {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.size, 10))
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("upload is incomplete, %d of %d bytes received", u.size, u.length))
+		return
+	}
+	v, ok := s.parseValidation(w, r, config, u.owner)
+	if !ok {
+		return
+	}
+	v.file = u.file
+	if r.URL.Query().Get("async") == "1" {
+		if !s.jobs.reserve(w, r) {
+			return
+		}
+		s.uploads.mu.Lock()
+		delete(s.uploads.byID, r.PathValue("id"))
+		s.uploads.mu.Unlock()
+		s.submit(w, v)
+		return
+	}
+	if err := s.acquire(r); err != nil {
+		s.logRequest(r, u.owner, "rejected, "+err.Error())
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.queueTimeout.Seconds())+1))
+		writeJSONError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer func() { <-s.slots }()
+	defer s.removeUpload(r.PathValue("id"))
+	s.respond(w, v)
+}
+
+// handleDeleteUpload abandons an upload.
+func (s *server) handleDeleteUpload(w http.ResponseWriter, r *http.Request) {
+	_, u, ok := s.findUpload(w, r)
+	if !ok {
+		return
+	}
+	u.mu.Unlock()
+	s.removeUpload(r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findUpload authenticates a request for an upload and returns the
+// upload locked. Only the client that started an upload may use it.
+func (s *server) findUpload(w http.ResponseWriter, r *http.Request) (*serveConfig, *upload, bool) {
+	config, client, ok := s.admit(w, r, false)
+	if !ok {
+		return nil, nil, false
+	}
+	s.uploads.mu.Lock()
+	u := s.uploads.byID[r.PathValue("id")]
+	s.uploads.mu.Unlock()
+	if u == nil || u.owner != client {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("no upload '%s'", r.PathValue("id")))
+		return nil, nil, false
+	}
+	u.mu.Lock()
+	s.uploads.mu.Lock()
+	current := s.uploads.byID[r.PathValue("id")] == u
+	s.uploads.mu.Unlock()
+	if !current {
+		u.mu.Unlock()
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("no upload '%s'", r.PathValue("id")))
+		return nil, nil, false
+	}
+	return config, u, true
+}
+
+func (s *server) removeUpload(id string) {
+	s.uploads.mu.Lock()
+	defer s.uploads.mu.Unlock()
+	if u, ok := s.uploads.byID[id]; ok {
+		os.Remove(u.file)
+		delete(s.uploads.byID, id)
+	}
+}
+
+// expireUploads removes uploads no chunk has arrived for within the
+// upload timeout.
+func (s *server) expireUploads() {
+	for range time.Tick(cmp.Or(s.uploads.timeout/10, time.Second)) {
+		s.uploads.mu.Lock()
+		for id, u := range s.uploads.byID {
+			if u.mu.TryLock() {
+				if time.Since(u.touched) > s.uploads.timeout {
+					os.Remove(u.file)
+					delete(s.uploads.byID, id)
+				}
+				u.mu.Unlock()
+			}
+		}
+		s.uploads.mu.Unlock()
+	}
+}
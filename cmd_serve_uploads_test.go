@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	checker "apgcheck/src"
+)
+
+func TestAppendUploadLimits(t *testing.T) {
+	xz := "\xfd7zXZ\x00" + strings.Repeat("x", 10)
+	tests := []struct {
+		name    string
+		length  int64
+		maxMB   int64
+		body    string
+		chunked bool
+		status  int
+	}{
+		{"declared length of 0", 0, 0, xz, false, http.StatusRequestEntityTooLarge},
+		{"declared length of 0, chunked", 0, 0, xz, true, http.StatusRequestEntityTooLarge},
+		{"over the declared length", 8, 0, xz, true, http.StatusRequestEntityTooLarge},
+		{"over the policy limit", -1, 1, xz + strings.Repeat("x", 1<<20), true, http.StatusRequestEntityTooLarge},
+		{"over the policy limit with a larger length", 2 << 20, 1, xz + strings.Repeat("x", 1<<20), false, http.StatusRequestEntityTooLarge},
+		{"within both", int64(len(xz)), 1, xz, false, http.StatusNoContent},
+		{"without a length", -1, 0, xz, true, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := checker.New(false, false, checker.Colors{}, 0)
+			c.Policy.Limits.MaxTotalSizeMB = tt.maxMB
+			s := &server{uploads: uploads{byID: map[string]*upload{}}}
+			s.current.Store(&serveConfig{checker: c})
+			file := filepath.Join(t.TempDir(), "upload.apg")
+			if err := os.WriteFile(file, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			s.uploads.byID["u"] = &upload{file: file, owner: "anonymous", length: tt.length}
+
+			r := httptest.NewRequest(http.MethodPatch, "/v1/uploads/u", strings.NewReader(tt.body))
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			r.SetPathValue("id", "u")
+			r.Header.Set("Upload-Offset", "0")
+			w := httptest.NewRecorder()
+			s.handleAppendUpload(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if fi, err := os.Stat(file); tt.status != http.StatusNoContent && err == nil && fi.Size() > 0 {
+				t.Errorf("%d bytes of a refused chunk were kept", fi.Size())
+			}
+		})
+	}
+}
+
+func TestCheckUploadHead(t *testing.T) {
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	tw.WriteHeader(&tar.Header{Name: "metadata.json", Mode: 0644})
+	tw.Close()
+
+	tests := []struct {
+		name string
+		head []byte
+		ok   bool
+	}{
+		{"xz stream", []byte("\xfd7zXZ\x00\x00\x04"), true},
+		{"start of an xz stream", []byte("\xfd7z"), true},
+		{"tar", tarball.Bytes(), true},
+		{"start of a tar", tarball.Bytes()[:100], true},
+		{"zip", append([]byte("PK\x03\x04"), make([]byte, 1020)...), false},
+	}
+	for _, tt := range tests {
+		file := filepath.Join(t.TempDir(), "upload.apg")
+		if err := os.WriteFile(file, tt.head, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkUploadHead(&upload{file: file}); (err == nil) != tt.ok {
+			t.Errorf("%s: checkUploadHead() = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	checker "apgcheck/src"
+)
+
+func runTUI(args []string) int {
+	fs := newFlagSet("tui")
+	apgVersion := fs.IntP("apg-version", "A", 0, "APG format version (1 or 2, 0 to detect)")
+	source := fs.Bool("source", false, "validate an APG source package")
+	skipSums := fs.Bool("skip-checksums", false, "skip verification of MD5 and CRC32 hashes")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	limits := addLimitFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck tui <file.apg> [options]%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	c, ok := limits.newChecker(false, *skipSums, colors)
+	if !ok {
+		return 1
+	}
+	c.SourcePackage = *source
+
+	report, err := c.ValidateFile(fs.Arg(0), *apgVersion)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sExtraction Error: %v%s\n", colors.Red, err, colors.Reset)
+		printHint(err.Error(), "", colors)
+		return 1
+	}
+	payload, _, err := c.NormalizedPayload(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+
+	ui := &tui{
+		report: report,
+		colors: checker.NewColors(*noColor),
+		panes: []*tuiPane{
+			{title: "Metadata", lines: metadataLines(report)},
+			{title: "Files", lines: fileTreeLines(payload)},
+			{title: "Findings", lines: findingLines(report.Findings, colors)},
+		},
+	}
+	if err := ui.run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 1
+	}
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// tuiPane is a scrollable column. view holds lines wrapped to the width
+// of the last draw, which offset indexes into.
+type tuiPane struct {
+	title  string
+	lines  []string
+	view   []string
+	offset int
+}
+
+type tui struct {
+	report checker.ValidationResponse
+	colors checker.Colors
+	panes  []*tuiPane
+	focus  int
+	width  int
+	height int
+}
+
+// run shows the panes full-screen until the user quits. Keys: Tab and the
+// left/right arrows (or h/l) move between panes, up/down (or j/k), PgUp/PgDn
+// and g/G scroll, q or Esc quits.
+func (t *tui) run() error {
+	restore, err := enterRawMode(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	out := bufio.NewWriter(os.Stdout)
+	fmt.Fprint(out, "\033[?1049h\033[?25l")
+	defer func() {
+		fmt.Fprint(out, "\033[?25h\033[?1049l")
+		out.Flush()
+	}()
+
+	resized := notifyResize()
+	keys := make(chan string)
+	go readKeys(keys)
+
+	for {
+		t.width, t.height = terminalSize(int(os.Stdout.Fd()))
+		t.draw(out)
+		out.Flush()
+		select {
+		case <-resized:
+		case key, ok := <-keys:
+			if !ok || !t.handle(key) {
+				return nil
+			}
+		}
+	}
+}
+
+// handle applies a key press and reports whether the UI keeps running.
+func (t *tui) handle(key string) bool {
+	pane := t.panes[t.focus]
+	page := max(t.height-4, 1)
+	switch key {
+	case "q", "\033", "\x03":
+		return false
+	case "\t", "l", "\033[C":
+		t.focus = (t.focus + 1) % len(t.panes)
+	case "\033[Z", "h", "\033[D":
+		t.focus = (t.focus + len(t.panes) - 1) % len(t.panes)
+	case "j", "\033[B":
+		pane.offset++
+	case "k", "\033[A":
+		pane.offset--
+	case " ", "\033[6~":
+		pane.offset += page
+	case "b", "\033[5~":
+		pane.offset -= page
+	case "g", "\033[H":
+		pane.offset = 0
+	case "G", "\033[F":
+		pane.offset = len(pane.view)
+	}
+	pane.offset = max(min(pane.offset, len(pane.view)-page), 0)
+	return true
+}
+
+func (t *tui) draw(out *bufio.Writer) {
+	fmt.Fprint(out, "\033[H\033[2J")
+
+	status := t.colors.Green + "valid" + t.colors.Reset
+	if !t.report.Valid {
+		status = t.colors.Red + "invalid" + t.colors.Reset
+	}
+	fmt.Fprintf(out, "%s%s%s  APG v%d  %s  %d errors, %d warnings\r\n", t.colors.Bold, t.report.File, t.colors.Reset,
+		t.report.Version, status, len(t.report.Errors), len(t.report.Warnings))
+
+	colWidth := max((t.width-len(t.panes)+1)/len(t.panes), 10)
+	rows := max(t.height-3, 1)
+	for _, pane := range t.panes {
+		pane.view = nil
+		for _, line := range pane.lines {
+			pane.view = append(pane.view, wrapText(line, colWidth)...)
+		}
+		pane.offset = max(min(pane.offset, len(pane.view)-rows), 0)
+	}
+	for i, pane := range t.panes {
+		title := fitText(" "+pane.title, colWidth)
+		if i == t.focus {
+			title = "\033[7m" + title + "\033[0m"
+		}
+		if i > 0 {
+			out.WriteString("│")
+		}
+		out.WriteString(title)
+	}
+	out.WriteString("\r\n")
+
+	for row := 0; row < rows; row++ {
+		for i, pane := range t.panes {
+			if i > 0 {
+				out.WriteString("│")
+			}
+			line := ""
+			if n := pane.offset + row; n < len(pane.view) {
+				line = pane.view[n]
+			}
+			out.WriteString(fitText(line, colWidth))
+		}
+		out.WriteString("\r\n")
+	}
+	fmt.Fprint(out, "Tab/←→ switch pane  ↑↓ scroll  PgUp/PgDn page  g/G top/bottom  q quit")
+}
+
+// fitText pads or truncates s to width visible columns. Color escapes are
+// kept but not counted.
+func fitText(s string, width int) string {
+	var b strings.Builder
+	visible := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\033' {
+			end := strings.IndexByte(s[i:], 'm')
+			if end < 0 {
+				break
+			}
+			b.WriteString(s[i : i+end+1])
+			i += end + 1
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if visible == width {
+			break
+		}
+		if r == '\t' {
+			r = ' '
+		}
+		b.WriteRune(r)
+		visible++
+		i += size
+	}
+	b.WriteString(strings.Repeat(" ", width-visible))
+	if strings.Contains(s, "\033") {
+		b.WriteString("\033[0m")
+	}
+	return b.String()
+}
+
+// wrapText splits s into lines of at most width visible columns. A color
+// active at a break is carried over to the next line.
+func wrapText(s string, width int) []string {
+	var lines []string
+	var b strings.Builder
+	style := ""
+	visible := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\033' {
+			end := strings.IndexByte(s[i:], 'm')
+			if end < 0 {
+				break
+			}
+			style = s[i : i+end+1]
+			if style == "\033[0m" {
+				style = ""
+			}
+			b.WriteString(s[i : i+end+1])
+			i += end + 1
+			continue
+		}
+		if visible == width {
+			lines = append(lines, b.String())
+			b.Reset()
+			b.WriteString(style)
+			visible = 0
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		b.WriteRune(r)
+		visible++
+		i += size
+	}
+	return append(lines, b.String())
+}
+
+func metadataLines(report checker.ValidationResponse) []string {
+	if report.Metadata == nil {
+		return []string{"(not shown for invalid packages)"}
+	}
+	keys := make([]string, 0, len(report.Metadata))
+	for k := range report.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var lines []string
+	for _, k := range keys {
+		switch v := report.Metadata[k].(type) {
+		case []interface{}:
+			lines = append(lines, k+":")
+			for _, item := range v {
+				lines = append(lines, fmt.Sprintf("  - %v", item))
+			}
+		default:
+			lines = append(lines, fmt.Sprintf("%s: %v", k, v))
+		}
+	}
+	return lines
+}
+
+// fileTreeLines renders the archive entries as an indented tree. Entries
+// are sorted by path component, so every directory directly precedes its
+// contents.
+func fileTreeLines(payload []checker.PayloadEntry) []string {
+	entries := slices.Clone(payload)
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.ReplaceAll(entries[i].Name, "/", "\x00") < strings.ReplaceAll(entries[j].Name, "/", "\x00")
+	})
+	var lines []string
+	for _, e := range entries {
+		depth := strings.Count(e.Name, "/")
+		name := e.Name[strings.LastIndex(e.Name, "/")+1:]
+		switch e.Type {
+		case "dir":
+			name += "/"
+		case "symlink", "hardlink":
+			name += " -> " + e.Link
+		}
+		lines = append(lines, fmt.Sprintf("%s%s  %s", strings.Repeat("  ", depth), name, e.Mode))
+	}
+	return lines
+}
+
+func findingLines(findings []checker.Finding, colors checker.Colors) []string {
+	if len(findings) == 0 {
+		return []string{"no findings"}
+	}
+	var lines []string
+	for i, f := range findings {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		color := colors.Red
+		if f.Severity == "warning" {
+			color = colors.Yellow
+		}
+		head := color + f.Severity + colors.Reset
+		if f.Rule != "" {
+			head += " [" + f.Code + " " + f.Rule + "]"
+		}
+		lines = append(lines, head, f.Message)
+		if f.Hint != "" {
+			lines = append(lines, colors.Blue+"Hint: "+f.Hint+colors.Reset)
+		}
+	}
+	return lines
+}
+
+// readKeys sends key presses read from stdin, an escape sequence counting
+// as one key. It closes keys when stdin ends.
+func readKeys(keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		keys <- string(buf[:n])
+	}
+}
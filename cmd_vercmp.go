@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	checker "apgcheck/src"
+)
+
+// runVercmp prints -1, 0 or 1 as version A is lower than, equal to or
+// higher than version B, like pacman's vercmp.
+func runVercmp(args []string) int {
+	fs := newFlagSet("vercmp")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck vercmp <version-a> <version-b>%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+	for _, v := range fs.Args() {
+		if err := checker.ValidateVersion(v, nil, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+	}
+	fmt.Println(checker.CompareVersions(fs.Arg(0), fs.Arg(1)))
+	return 0
+}
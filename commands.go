@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	checker "apgcheck/src"
+)
+
+// command is a subcommand of apgcheck; args describes its positional
+// arguments for completion scripts.
+type command struct {
+	name        string
+	summary     string
+	args        argSpec
+	run         func(args []string) int
+	subcommands []command
+}
+
+// argSpec describes what an argument accepts: one of values, files with one
+// of the extensions ("" for any file), or directories.
+type argSpec struct {
+	values []string
+	files  []string
+	dirs   bool
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "index", summary: "verify or build a repository index", run: runIndex, subcommands: []command{
+			{name: "verify", summary: "check a repository index against its packages", args: argSpec{files: []string{"json"}}, run: runIndexVerify},
+			{name: "build", summary: "generate a repository index from a directory of packages", args: argSpec{dirs: true}, run: runIndexBuild},
+		}},
+		{name: "impact", summary: "report reverse dependencies an update would break", args: argSpec{files: []string{"apg"}}, run: runImpact},
+		{name: "delta", summary: "validate a delta package", args: argSpec{files: []string{"apgdelta"}}, run: runDelta},
+		{name: "bundle", summary: "validate the split packages of one build together", args: argSpec{files: []string{"apg"}}, run: runBundle},
+		{name: "lock", summary: "write a lockfile of a package's dependency closure", args: argSpec{files: []string{"apg"}}, run: runLock},
+		{name: "graph", summary: "print the dependency graph of packages", args: argSpec{files: []string{"apg"}}, run: runGraph},
+		{name: "compat", summary: "report how a .deb or .rpm maps onto APG", args: argSpec{files: []string{"deb", "rpm"}}, run: runCompat},
+		{name: "convert", summary: "convert a .deb or .rpm into an APG package skeleton", args: argSpec{files: []string{"deb", "rpm"}}, run: runConvert},
+		{name: "selftest", summary: "run the conformance suite", run: runSelftest},
+		{name: "repro", summary: "check that two builds of a package are reproducible", args: argSpec{files: []string{"apg"}}, run: runRepro},
+		{name: "tui", summary: "explore a package and its findings interactively", args: argSpec{files: []string{"apg"}}, run: runTUI},
+		{name: "rules", summary: "list the validation rules", args: argSpec{values: ruleIDs()}, run: runRules},
+		{name: "vercmp", summary: "compare two package versions", run: runVercmp},
+		{name: "serve", summary: "validate packages uploaded over HTTP", run: runServe},
+		{name: "audit", summary: "verify a validation audit log", run: runAudit, subcommands: []command{
+			{name: "verify", summary: "check the hash chain of an audit log", args: argSpec{files: []string{"jsonl", "log"}}, run: runAuditVerify},
+		}},
+		{name: "config", summary: "show the resolved configuration", run: runConfig, subcommands: []command{
+			{name: "show", summary: "print the effective settings and where each came from", run: runConfigShow},
+		}},
+		{name: "compare-reports", summary: "fail on findings a JSON report adds to an older one", args: argSpec{files: []string{"json"}}, run: runCompareReports},
+		{name: "completion", summary: "print a shell completion script", args: argSpec{values: shells}, run: runCompletion},
+		{name: "gen-man", summary: "print the apgcheck(1) man page", run: runGenMan},
+	}
+}
+
+func ruleIDs() []string {
+	var ids []string
+	for _, r := range checker.Rules() {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+// root describes validation itself, the command run when no subcommand is
+// given.
+var root = command{name: "apgcheck", run: runValidate}
+
+// runSubcommand runs the subcommand of a command named by the first
+// argument. Without a known one it lists the subcommands: on standard
+// output for --help, and as a usage error otherwise.
+func runSubcommand(name string, args []string) int {
+	cmd := commands[slices.IndexFunc(commands, func(c command) bool { return c.name == name })]
+	if len(args) > 0 {
+		for _, sub := range cmd.subcommands {
+			if sub.name == args[0] {
+				return sub.run(args[1:])
+			}
+		}
+	}
+
+	out, status := os.Stderr, 2
+	switch {
+	case len(args) > 0 && (args[0] == "-h" || args[0] == "--help"):
+		out, status = os.Stdout, 0
+	case len(args) > 0:
+		fmt.Fprintf(os.Stderr, "Error: unknown %s command '%s'\n", name, args[0])
+	}
+	fmt.Fprintf(out, "Usage: apgcheck %s <command> [options]\n\nCommands:\n", name)
+	for _, sub := range cmd.subcommands {
+		fmt.Fprintf(out, "  %-8s %s\n", sub.name, sub.summary)
+	}
+	return status
+}
@@ -0,0 +1,369 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	checker "apgcheck/src"
+)
+
+var shells = []string{"bash", "zsh", "fish"}
+
+// flagArgs describes flag values for completion, keyed by "command flag"
+// or by flag name for every command.
+var flagArgs = map[string]argSpec{
+	"apgfile":             {files: []string{"apg"}},
+	"apg-version":         {values: []string{"1", "2"}},
+	"policy":              {files: []string{"json"}},
+	"repo-index":          {files: []string{"json"}},
+	"base-manifest":       {files: []string{""}},
+	"tar-formats":         {values: checker.TarFormats()},
+	"unknown-entries":     {values: checker.UnknownEntryActions()},
+	"static-libs":         {values: checker.PackagingActions()},
+	"cache":               {files: []string{"json"}},
+	"temp-dir":            {dirs: true},
+	"base":                {files: []string{"apg"}},
+	"target":              {files: []string{"apg"}},
+	"suite":               {dirs: true},
+	"output":              {files: []string{""}},
+	"convert output":      {dirs: true},
+	"gen-man output":      {files: []string{"1"}},
+	"graph format":        {values: []string{"dot", "json"}},
+	"rules format":        {values: []string{"text", "json", "markdown"}},
+	" format":             {values: []string{"text", "json", "csv", "template"}},
+	"bundle format":       {values: []string{"text", "json", "csv"}},
+	"index verify format": {values: []string{"text", "json", "csv"}},
+	"template":            {files: []string{"tmpl"}},
+}
+
+func runCompletion(args []string) int {
+	fs := newFlagSet("completion")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	if err := parseFlags(fs, args); err != nil {
+		return usageStatus(err)
+	}
+
+	colors := checker.NewColors(*noColor)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "%sUsage: apgcheck completion bash|zsh|fish%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+
+	switch fs.Arg(0) {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print(zshCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	default:
+		fmt.Fprintf(os.Stderr, "%sError: unknown shell '%s' (expected bash, zsh or fish)%s\n", colors.Red, fs.Arg(0), colors.Reset)
+		return 1
+	}
+	return 0
+}
+
+// completed is a command to complete, with its full name ("index verify")
+// and flags.
+type completed struct {
+	path  string
+	cmd   command
+	flags []*pflag.Flag
+}
+
+// completedCommands returns the root command and every leaf subcommand.
+func completedCommands() []completed {
+	var out []completed
+	var walk func(prefix string, cmds []command)
+	walk = func(prefix string, cmds []command) {
+		for _, cmd := range cmds {
+			if len(cmd.subcommands) > 0 {
+				walk(prefix+cmd.name+" ", cmd.subcommands)
+				continue
+			}
+			out = append(out, completed{path: prefix + cmd.name, cmd: cmd, flags: flagList(describeFlags(cmd))})
+		}
+	}
+	walk("", commands)
+	return append(out, completed{path: "", cmd: root, flags: flagList(describeFlags(root))})
+}
+
+func flagList(fs *pflag.FlagSet) []*pflag.Flag {
+	var flags []*pflag.Flag
+	fs.VisitAll(func(f *pflag.Flag) {
+		if !f.Hidden {
+			flags = append(flags, f)
+		}
+	})
+	return flags
+}
+
+func takesValue(f *pflag.Flag) bool {
+	return f.NoOptDefVal == ""
+}
+
+func flagArg(path string, f *pflag.Flag) argSpec {
+	if spec, ok := flagArgs[path+" "+f.Name]; ok {
+		return spec
+	}
+	return flagArgs[f.Name]
+}
+
+func commandNames(cmds []command) []string {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.name
+	}
+	return names
+}
+
+func bashCompletion() string {
+	var b strings.Builder
+	b.WriteString("# bash completion for apgcheck\n# Generated by `apgcheck completion bash`.\n\n")
+	b.WriteString("_apgcheck() {\n")
+	b.WriteString("    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	b.WriteString("    local cmd=${COMP_WORDS[1]}\n\n")
+	fmt.Fprintf(&b, "    if ((COMP_CWORD == 1)) && [[ $cur != -* ]]; then\n        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n        return\n    fi\n", strings.Join(commandNames(commands), " "))
+	b.WriteString("    case $cmd in\n")
+	var plain []string
+	for _, cmd := range commands {
+		if len(cmd.subcommands) == 0 {
+			plain = append(plain, cmd.name)
+			continue
+		}
+		fmt.Fprintf(&b, "    %s)\n        if ((COMP_CWORD == 2)); then\n            COMPREPLY=($(compgen -W %q -- \"$cur\"))\n            return\n        fi\n        cmd=\"%s ${COMP_WORDS[2]}\"\n        ;;\n",
+			cmd.name, strings.Join(commandNames(cmd.subcommands), " "), cmd.name)
+	}
+	fmt.Fprintf(&b, "    %s)\n        ;;\n    *)\n        cmd=\n        ;;\n", strings.Join(plain, "|"))
+	b.WriteString("    esac\n\n")
+
+	// Flags with the same completion share one case arm.
+	all := completedCommands()
+	var replies []string
+	patterns := map[string][]string{}
+	for _, cc := range all {
+		for _, f := range cc.flags {
+			if !takesValue(f) {
+				continue
+			}
+			reply := bashReply(flagArg(cc.path, f))
+			if _, ok := patterns[reply]; !ok {
+				replies = append(replies, reply)
+			}
+			for _, name := range flagNames(f) {
+				patterns[reply] = append(patterns[reply], fmt.Sprintf("%q", cc.path+" "+name))
+			}
+		}
+	}
+	b.WriteString("    case \"$cmd $prev\" in\n")
+	for _, reply := range replies {
+		fmt.Fprintf(&b, "    %s)\n        %s\n        return\n        ;;\n", strings.Join(patterns[reply], "|"), reply)
+	}
+	b.WriteString("    esac\n\n")
+
+	b.WriteString("    case $cmd in\n")
+	for _, cc := range all {
+		var names []string
+		for _, f := range cc.flags {
+			names = append(names, flagNames(f)...)
+		}
+		pattern := fmt.Sprintf("%q", cc.path)
+		if cc.path == "" {
+			pattern = "*"
+		}
+		fmt.Fprintf(&b, "    %s)\n        if [[ $cur == -* ]]; then\n            COMPREPLY=($(compgen -W %q -- \"$cur\"))\n        else\n            %s\n        fi\n        ;;\n",
+			pattern, strings.Join(names, " "), bashReply(cc.cmd.args))
+	}
+	b.WriteString("    esac\n}\n\ncomplete -F _apgcheck apgcheck\n")
+	return b.String()
+}
+
+func flagNames(f *pflag.Flag) []string {
+	names := []string{"--" + f.Name}
+	if f.Shorthand != "" {
+		names = append(names, "-"+f.Shorthand)
+	}
+	return names
+}
+
+func bashReply(spec argSpec) string {
+	switch {
+	case len(spec.values) > 0:
+		return fmt.Sprintf("COMPREPLY=($(compgen -W %q -- \"$cur\"))", strings.Join(spec.values, " "))
+	case spec.dirs:
+		return "compopt -o filenames 2>/dev/null; COMPREPLY=($(compgen -d -- \"$cur\"))"
+	case len(spec.files) > 0:
+		words := []string{"$(compgen -d -- \"$cur\")"}
+		for _, ext := range spec.files {
+			if ext == "" {
+				words = []string{"$(compgen -f -- \"$cur\")"}
+				break
+			}
+			words = append(words, fmt.Sprintf("$(compgen -f -X '!*.%s' -- \"$cur\")", ext))
+		}
+		return "compopt -o filenames 2>/dev/null; COMPREPLY=(" + strings.Join(words, " ") + ")"
+	}
+	return "COMPREPLY=()"
+}
+
+func zshCompletion() string {
+	var b strings.Builder
+	b.WriteString("#compdef apgcheck\n# Generated by `apgcheck completion zsh`.\n\n")
+	flags := map[string][]*pflag.Flag{}
+	for _, cc := range completedCommands() {
+		flags[cc.path] = cc.flags
+	}
+
+	var arguments func(path string, cmd command, indent string)
+	arguments = func(path string, cmd command, indent string) {
+		specs := []string{"_arguments -s"}
+		for _, f := range flags[path] {
+			specs = append(specs, zshFlagSpec(f, flagArg(path, f)))
+		}
+		if action := zshAction(cmd.args); action != "" {
+			specs = append(specs, fmt.Sprintf("'*:%s:%s'", "argument", action))
+		}
+		b.WriteString(indent + strings.Join(specs, " \\\n"+indent+"    ") + "\n")
+	}
+
+	var dispatch func(prefix string, cmds []command, indent string)
+	dispatch = func(prefix string, cmds []command, indent string) {
+		fmt.Fprintf(&b, "%slocal -a cmds\n%scmds=(\n", indent, indent)
+		for _, cmd := range cmds {
+			fmt.Fprintf(&b, "%s    %s\n", indent, zshQuote(cmd.name+":"+cmd.summary))
+		}
+		fmt.Fprintf(&b, "%s)\n", indent)
+		fmt.Fprintf(&b, "%sif (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then\n%s    _describe -t commands '%scommand' cmds\n%s    return\n%sfi\n", indent, indent, cmp.Or(prefix, "apgcheck "), indent, indent)
+		fmt.Fprintf(&b, "%scase $words[2] in\n", indent)
+		for _, cmd := range cmds {
+			fmt.Fprintf(&b, "%s%s)\n%s    shift words\n%s    (( CURRENT-- ))\n", indent, cmd.name, indent, indent)
+			if len(cmd.subcommands) > 0 {
+				dispatch(prefix+cmd.name+" ", cmd.subcommands, indent+"    ")
+			} else {
+				arguments(prefix+cmd.name, cmd, indent+"    ")
+			}
+			fmt.Fprintf(&b, "%s    ;;\n", indent)
+		}
+		if prefix == "" {
+			fmt.Fprintf(&b, "%s*)\n", indent)
+			arguments("", root, indent+"    ")
+			fmt.Fprintf(&b, "%s    ;;\n", indent)
+		}
+		fmt.Fprintf(&b, "%sesac\n", indent)
+	}
+
+	b.WriteString("_apgcheck() {\n")
+	dispatch("", commands, "    ")
+	b.WriteString("}\n\n_apgcheck \"$@\"\n")
+	return b.String()
+}
+
+func zshFlagSpec(f *pflag.Flag, spec argSpec) string {
+	desc := strings.NewReplacer("[", "\\[", "]", "\\]").Replace(f.Usage)
+	var arg string
+	if takesValue(f) {
+		action := zshAction(spec)
+		if action == "" {
+			action = " "
+		}
+		arg = ":" + f.Name + ":" + action
+	}
+	if f.Shorthand == "" {
+		return zshQuote("--" + f.Name + "[" + desc + "]" + arg)
+	}
+	return fmt.Sprintf("'(-%s --%s)'{-%s,--%s}%s", f.Shorthand, f.Name, f.Shorthand, f.Name, zshQuote("["+desc+"]"+arg))
+}
+
+func zshAction(spec argSpec) string {
+	switch {
+	case len(spec.values) > 0:
+		return "(" + strings.Join(spec.values, " ") + ")"
+	case spec.dirs:
+		return "_files -/"
+	case slices.Contains(spec.files, ""):
+		return "_files"
+	case len(spec.files) == 1:
+		return "_files -g \"*." + spec.files[0] + "\""
+	case len(spec.files) > 1:
+		return "_files -g \"*.(" + strings.Join(spec.files, "|") + ")\""
+	}
+	return ""
+}
+
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString("# fish completion for apgcheck\n# Generated by `apgcheck completion fish`.\n\n")
+	names := strings.Join(commandNames(commands), " ")
+	b.WriteString("complete -c apgcheck -f\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "complete -c apgcheck -n 'not __fish_seen_subcommand_from %s' -a %s -d %s\n", names, cmd.name, fishQuote(cmd.summary))
+		if len(cmd.subcommands) > 0 {
+			subs := strings.Join(commandNames(cmd.subcommands), " ")
+			for _, sub := range cmd.subcommands {
+				fmt.Fprintf(&b, "complete -c apgcheck -n '__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s' -a %s -d %s\n", cmd.name, subs, sub.name, fishQuote(sub.summary))
+			}
+		}
+	}
+
+	for _, cc := range completedCommands() {
+		condition := "not __fish_seen_subcommand_from " + names
+		if cc.path != "" {
+			var parts []string
+			for _, word := range strings.Fields(cc.path) {
+				parts = append(parts, "__fish_seen_subcommand_from "+word)
+			}
+			condition = strings.Join(parts, "; and ")
+		}
+		b.WriteString("\n")
+		for _, f := range cc.flags {
+			line := fmt.Sprintf("complete -c apgcheck -n '%s'", condition)
+			if f.Shorthand != "" {
+				line += " -s " + f.Shorthand
+			}
+			line += " -l " + f.Name
+			if takesValue(f) {
+				line += fishArgs(flagArg(cc.path, f))
+			}
+			fmt.Fprintf(&b, "%s -d %s\n", line, fishQuote(f.Usage))
+		}
+		if args := fishArgs(cc.cmd.args); cc.path != "" && args != " -r" {
+			fmt.Fprintf(&b, "complete -c apgcheck -n '%s'%s\n", condition, strings.Replace(args, " -x", "", 1))
+		}
+	}
+	return b.String()
+}
+
+func fishArgs(spec argSpec) string {
+	switch {
+	case len(spec.values) > 0:
+		return " -x -a " + fishQuote(strings.Join(spec.values, " "))
+	case spec.dirs:
+		return " -x -a '(__fish_complete_directories)'"
+	case slices.Contains(spec.files, ""):
+		return " -r -F"
+	case len(spec.files) > 0:
+		var calls []string
+		for _, ext := range spec.files {
+			calls = append(calls, "(__fish_complete_suffix ."+ext+")")
+		}
+		return " -x -a " + fishQuote(strings.Join(calls, " "))
+	}
+	return " -r"
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,396 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	checker "apgcheck/src"
+)
+
+// limitFlags are the policy and resource limit flags shared by every
+// command that extracts packages. Flags given explicitly override the
+// policy file, which overrides the built-in defaults.
+type limitFlags struct {
+	fs            *pflag.FlagSet
+	policy        *string
+	maxSizeMB     *int64
+	maxFileSizeMB *int64
+	maxEntries    *int
+	deterministic *bool
+	tarFormats    *[]string
+	rejectSparse  *bool
+	xattrs        *[]string
+	unknown       *string
+	staticLibs    *string
+	threads       *int
+	maxDiskMB     *int64
+	maxMemoryMB   *int64
+	maxPathLength *int
+	maxNameLength *int
+	maxPathDepth  *int
+	nestingDepth  *int
+	maxNested     *int
+	cache         *string
+	tempDir       *string
+	sandbox       *bool
+	harden        *bool
+
+	// writable lists the directories a command writes to besides the
+	// temporary and cache directories; --harden keeps them writable.
+	writable []string
+	// resultCache is --cache, opened once for all checkers of a command.
+	resultCache *checker.ResultCache
+}
+
+func addLimitFlags(fs *pflag.FlagSet) *limitFlags {
+	defaults := checker.DefaultPolicy()
+	return &limitFlags{
+		fs:            fs,
+		policy:        fs.String("policy", "", "path to a JSON policy file"),
+		maxSizeMB:     fs.Int64("max-size", defaults.Limits.MaxTotalSizeMB, "maximum allowed total decompression size in MB"),
+		maxFileSizeMB: fs.Int64("max-file-size", defaults.Limits.MaxFileSizeMB, "maximum allowed size of a single archive entry in MB (default --max-size)"),
+		maxEntries:    fs.Int("max-entries", defaults.Limits.MaxEntries, "maximum allowed number of archive entries"),
+		maxDiskMB:     fs.Int64("max-disk", defaults.Limits.MaxDiskMB, "maximum bytes in MB an extraction may write to disk (0 for no quota)"),
+		maxMemoryMB:   fs.Int64("max-memory", defaults.Limits.MaxMemoryMB, "memory budget in MB for decoding archives in memory (0 for no limit)"),
+		maxPathLength: fs.Int("max-path-length", defaults.Limits.MaxPathLength, "maximum length in bytes of an installed path (0 for no limit)"),
+		maxNameLength: fs.Int("max-name-length", defaults.Limits.MaxNameLength, "maximum length in bytes of a path component (0 for no limit)"),
+		maxPathDepth:  fs.Int("max-path-depth", defaults.Limits.MaxPathDepth, "maximum number of components in an installed path (0 for no limit)"),
+		nestingDepth:  fs.Int("max-nesting-depth", defaults.Nested.MaxDepth, "levels of APG packages inside packages to validate (0 to not validate nested packages)"),
+		maxNested:     fs.Int("max-nested-packages", defaults.Nested.MaxPackages, "maximum number of nested packages in one package at all levels (0 for no limit)"),
+		deterministic: fs.Bool("require-deterministic", false, "fail packages whose archive is not built deterministically"),
+		tarFormats:    fs.StringSlice("tar-formats", nil, "tar formats the archive may use (ustar, pax, gnu, v7)"),
+		rejectSparse:  fs.Bool("reject-sparse", false, "fail packages containing sparse file entries"),
+		unknown:       fs.String("unknown-entries", defaults.Archive.UnknownEntries, "what to do with device nodes, FIFOs and other entries apgcheck does not extract (error, warn, skip)"),
+		staticLibs:    fs.String("static-libs", defaults.Packaging.StaticLibraries, "what to do with static libraries outside -dev packages (error, warn, ignore)"),
+		xattrs:        fs.StringSlice("allowed-xattrs", nil, "extended attributes entries may carry, e.g. user.* (default any)"),
+		cache:         fs.String("cache", "", "reuse validation results stored by package SHA-256 in this file, or in this directory if it is one or ends in /"),
+		threads:       fs.Int("threads", 0, "threads for decompressing multi-block xz archives (0 for all CPUs)"),
+		tempDir:       fs.String("temp-dir", "", "directory to extract packages into (default /tmp)"),
+		sandbox:       fs.Bool("sandbox", false, "validate packages in user and mount namespaces with a private tmpfs (Linux)"),
+		harden:        fs.Bool("harden", false, "restrict apgcheck with Landlock and a seccomp syscall filter (Linux)"),
+	}
+}
+
+func (lf *limitFlags) newChecker(verbose, skipSums bool, colors checker.Colors) (*checker.Checker, bool) {
+	return lf.newCheckerWithPolicy(*lf.policy, verbose, skipSums, colors)
+}
+
+// newCheckerWithPolicy is newChecker with another policy file than
+// --policy; the flags still override it.
+func (lf *limitFlags) newCheckerWithPolicy(policyFile string, verbose, skipSums bool, colors checker.Colors) (*checker.Checker, bool) {
+	c := checker.New(verbose, skipSums, colors, *lf.maxSizeMB)
+	c.Threads = *lf.threads
+	c.TempDir = *lf.tempDir
+	c.Sandbox = *lf.sandbox
+
+	fromFile := map[string]bool{}
+	if policyFile != "" {
+		policy, err := checker.LoadPolicy(policyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return nil, false
+		}
+		c.Policy = policy
+		fromFile = policyKeys(policyFile)
+	}
+
+	for _, pf := range policyFlags {
+		if lf.fs.Changed(pf.flag) {
+			pf.apply(lf, &c.Policy)
+		}
+	}
+	// Single entries were capped by --max-size alone before there was a
+	// per-file limit, so it follows the total limit unless set itself.
+	if !lf.fs.Changed("max-file-size") && !fromFile["limits.max_file_size_mb"] {
+		c.Policy.Limits.MaxFileSizeMB = c.Policy.Limits.MaxTotalSizeMB
+	}
+	if err := c.Policy.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return nil, false
+	}
+	cache, err := lf.openCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return nil, false
+	}
+	c.Cache = cache
+	if *lf.harden && !lf.applyHarden(c, colors) {
+		return nil, false
+	}
+	return c, true
+}
+
+// cacheIsDir reports whether --cache names a cache directory rather than
+// a cache file: a directory that exists, or a path ending in a slash.
+func cacheIsDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir() || strings.HasSuffix(path, string(filepath.Separator))
+}
+
+// openCaches are the cache files opened by commands, which saveCaches
+// writes back when the command exits.
+var openCaches []*checker.ResultCache
+
+// openCache opens --cache the first time a checker of the command needs
+// it.
+func (lf *limitFlags) openCache() (*checker.ResultCache, error) {
+	if *lf.cache == "" || lf.resultCache != nil {
+		return lf.resultCache, nil
+	}
+	var err error
+	if cacheIsDir(*lf.cache) {
+		lf.resultCache, err = checker.OpenCacheDir(*lf.cache)
+	} else if lf.resultCache, err = checker.LoadResultCache(*lf.cache); err == nil {
+		openCaches = append(openCaches, lf.resultCache)
+	}
+	return lf.resultCache, err
+}
+
+// saveCaches writes back the cache files commands opened.
+func saveCaches() {
+	for _, cache := range openCaches {
+		if err := cache.Save(); err != nil {
+			colors := checker.NewColors(false)
+			fmt.Fprintf(os.Stderr, "%sWarning: failed to save cache: %v%s\n", colors.Yellow, err, colors.Reset)
+		}
+	}
+	openCaches = nil
+}
+
+// policyKeys returns the dotted keys of the settings a policy file sets.
+func policyKeys(file string) map[string]bool {
+	keys := map[string]bool{}
+	data, _ := os.ReadFile(file)
+	var raw any
+	json.Unmarshal(data, &raw)
+	for key := range flattenJSON("", raw) {
+		keys[key] = true
+	}
+	return keys
+}
+
+// policyFlags are the flags that override a setting of the policy, by
+// its key in the policy file.
+var policyFlags = []struct {
+	flag, key string
+	apply     func(lf *limitFlags, p *checker.Policy)
+}{
+	{"max-size", "limits.max_total_size_mb", func(lf *limitFlags, p *checker.Policy) { p.Limits.MaxTotalSizeMB = *lf.maxSizeMB }},
+	{"max-file-size", "limits.max_file_size_mb", func(lf *limitFlags, p *checker.Policy) { p.Limits.MaxFileSizeMB = *lf.maxFileSizeMB }},
+	{"max-entries", "limits.max_entries", func(lf *limitFlags, p *checker.Policy) { p.Limits.MaxEntries = *lf.maxEntries }},
+	{"max-disk", "limits.max_disk_mb", func(lf *limitFlags, p *checker.Policy) { p.Limits.MaxDiskMB = *lf.maxDiskMB }},
+	{"max-memory", "limits.max_memory_mb", func(lf *limitFlags, p *checker.Policy) { p.Limits.MaxMemoryMB = *lf.maxMemoryMB }},
+	{"max-path-length", "limits.max_path_length", func(lf *limitFlags, p *checker.Policy) { p.Limits.MaxPathLength = *lf.maxPathLength }},
+	{"max-name-length", "limits.max_name_length", func(lf *limitFlags, p *checker.Policy) { p.Limits.MaxNameLength = *lf.maxNameLength }},
+	{"max-path-depth", "limits.max_path_depth", func(lf *limitFlags, p *checker.Policy) { p.Limits.MaxPathDepth = *lf.maxPathDepth }},
+	{"max-nesting-depth", "nested.max_depth", func(lf *limitFlags, p *checker.Policy) { p.Nested.MaxDepth = *lf.nestingDepth }},
+	{"max-nested-packages", "nested.max_packages", func(lf *limitFlags, p *checker.Policy) { p.Nested.MaxPackages = *lf.maxNested }},
+	{"require-deterministic", "archive.require_deterministic", func(lf *limitFlags, p *checker.Policy) { p.Archive.RequireDeterministic = *lf.deterministic }},
+	{"tar-formats", "archive.allowed_formats", func(lf *limitFlags, p *checker.Policy) { p.Archive.AllowedFormats = *lf.tarFormats }},
+	{"reject-sparse", "archive.allow_sparse", func(lf *limitFlags, p *checker.Policy) { p.Archive.AllowSparse = !*lf.rejectSparse }},
+	{"unknown-entries", "archive.unknown_entries", func(lf *limitFlags, p *checker.Policy) { p.Archive.UnknownEntries = *lf.unknown }},
+	{"static-libs", "packaging.static_libraries", func(lf *limitFlags, p *checker.Policy) { p.Packaging.StaticLibraries = *lf.staticLibs }},
+	{"allowed-xattrs", "archive.allowed_xattrs", func(lf *limitFlags, p *checker.Policy) { p.Archive.AllowedXattrs = *lf.xattrs }},
+}
+
+// applyHarden confines the process for --harden. With --sandbox only the
+// sandboxed children are confined, since this process still has to start
+// them.
+func (lf *limitFlags) applyHarden(c *checker.Checker, colors checker.Colors) bool {
+	if c.Sandbox {
+		c.Harden = true
+		return true
+	}
+	writable := append([]string{cmp.Or(c.TempDir, "/tmp")}, lf.writable...)
+	if c.Cache != nil && c.Cache.IsDir() {
+		writable = append(writable, c.Cache.Path())
+	} else if c.Cache != nil {
+		writable = append(writable, filepath.Dir(c.Cache.Path()))
+	}
+	err := checker.Harden(writable)
+	if errors.Is(err, checker.ErrNoLandlock) {
+		fmt.Fprintf(os.Stderr, "%sWarning: %v, filesystem access is not restricted%s\n", colors.Yellow, err, colors.Reset)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: cannot harden: %v%s\n", colors.Red, err, colors.Reset)
+		return false
+	}
+	return true
+}
+
+// envAnnotation marks a flag set from the environment with the variable
+// that set it.
+const envAnnotation = "apgcheck_env"
+
+// formatsAnnotation lists the values a --format flag accepts.
+const formatsAnnotation = "apgcheck_formats"
+
+// formatFlag defines --format with its default and the other values it
+// accepts; APGCHECK_FORMAT only sets it to one of them.
+func formatFlag(fs *pflag.FlagSet, value string, others ...string) *string {
+	formats := append([]string{value}, others...)
+	usage := fmt.Sprintf("output format (%s or %s)", strings.Join(formats[:len(formats)-1], ", "), formats[len(formats)-1])
+	format := fs.StringP("format", "f", value, usage)
+	fs.SetAnnotation("format", formatsAnnotation, formats)
+	return format
+}
+
+// envFlags maps the APGCHECK_* environment variables to the flags they
+// set; APGCHECK_PROFILE selects the policy file. A flag given on the
+// command line overrides the environment, which overrides the settings of
+// the policy file and the built-in defaults.
+var envFlags = []struct{ env, flag string }{
+	{"APGCHECK_FORMAT", "format"},
+	{"APGCHECK_PROFILE", "policy"},
+	{"APGCHECK_TEMPDIR", "temp-dir"},
+	{"APGCHECK_NO_COLOR", "no-color"},
+}
+
+// parseFlags parses the command line and then applies the environment to
+// the flags it did not set. APGCHECK_FORMAT is a default for every
+// command, so a format a command does not support is ignored; commands
+// with a --json switch instead of --format take json or text.
+func parseFlags(fs *pflag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if err != pflag.ErrHelp {
+			fmt.Fprintln(fs.Output(), err)
+		}
+		return err
+	}
+	for _, e := range envFlags {
+		value := os.Getenv(e.env)
+		if value == "" {
+			continue
+		}
+		name := e.flag
+		if name == "format" {
+			if name, value = envFormat(fs, value); name == "" {
+				continue
+			}
+		}
+		if fs.Lookup(name) == nil || fs.Changed(name) {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			err = fmt.Errorf("invalid %s '%s'", e.env, os.Getenv(e.env))
+			fmt.Fprintln(fs.Output(), err)
+			return err
+		}
+		fs.SetAnnotation(name, envAnnotation, []string{e.env})
+	}
+	return nil
+}
+
+// envFormat returns the flag and value APGCHECK_FORMAT sets for a
+// command, or no flag if the command does not support the format. The
+// template format also needs --template, so it is only taken with it.
+func envFormat(fs *pflag.FlagSet, value string) (string, string) {
+	if f := fs.Lookup("format"); f != nil {
+		if !slices.Contains(f.Annotations[formatsAnnotation], value) || value == "template" && !fs.Changed("template") {
+			return "", ""
+		}
+		return "format", value
+	}
+	if fs.Lookup("json") != nil && (value == "json" || value == "text") {
+		return "json", strconv.FormatBool(value == "json")
+	}
+	return "", ""
+}
+
+// usageStatus is the exit status of a command whose flags did not parse:
+// 0 after --help, which pflag answers with the flag list, and 2 for a
+// usage error, as for validation.
+func usageStatus(err error) int {
+	if errors.Is(err, pflag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
+
+// described collects the flag sets created while describeFlags runs a
+// command.
+var described *[]*pflag.FlagSet
+
+func newFlagSet(name string) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	if described != nil {
+		fs.SetOutput(io.Discard)
+		*described = append(*described, fs)
+	}
+	return fs
+}
+
+// describeFlags returns the flags of a command. The command is run with
+// --help, which makes it return as soon as its flags are defined.
+func describeFlags(cmd command) *pflag.FlagSet {
+	var sets []*pflag.FlagSet
+	described = &sets
+	defer func() { described = nil }()
+	cmd.run([]string{"--help"})
+	if len(sets) == 0 {
+		return pflag.NewFlagSet(cmd.name, pflag.ContinueOnError)
+	}
+	return sets[0]
+}
+
+// outputFormat returns the output format a command was asked for: json
+// with --json, and otherwise --format, which must be one of allowed.
+func outputFormat(format string, isJson bool, allowed ...string) (string, error) {
+	if isJson {
+		return "json", nil
+	}
+	if !slices.Contains(allowed, format) {
+		return "", fmt.Errorf("invalid format '%s' (expected %s or %s)", format, strings.Join(allowed[:len(allowed)-1], ", "), allowed[len(allowed)-1])
+	}
+	return format, nil
+}
+
+// traceFlags configure export of OpenTelemetry spans. The standard
+// OTEL_EXPORTER_OTLP_* and OTEL_SERVICE_NAME variables apply when the
+// flags are not given.
+type traceFlags struct {
+	endpoint *string
+	headers  *map[string]string
+}
+
+func addTraceFlags(fs *pflag.FlagSet) *traceFlags {
+	return &traceFlags{
+		endpoint: fs.String("otlp-endpoint", "", "export OpenTelemetry spans to this OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces"),
+		headers:  fs.StringToString("otlp-header", nil, "headers to send with every span export, as key=value pairs"),
+	}
+}
+
+// tracer returns the configured tracer, or nil when no endpoint is set.
+func (t *traceFlags) tracer() *checker.Tracer {
+	endpoint := *t.endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	}
+	if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint == "" && base != "" {
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if endpoint == "" || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return nil
+	}
+	headers := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	maps.Copy(headers, *t.headers)
+	return checker.NewTracer(endpoint, headers, cmp.Or(os.Getenv("OTEL_SERVICE_NAME"), "apgcheck"))
+}
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	checker "apgcheck/src"
+)
+
+func TestEnvFormat(t *testing.T) {
+	tests := []struct {
+		env    string
+		others []string // formats besides text; nil for a --json switch
+		args   []string
+		format string
+	}{
+		{env: "csv", others: []string{"json", "csv"}, format: "csv"},
+		{env: "csv", others: []string{"json", "markdown"}, format: "text"},
+		{env: "xml", others: []string{"json", "csv"}, format: "text"},
+		{env: "csv", others: []string{"json", "csv"}, args: []string{"--format", "json"}, format: "json"},
+		{env: "template", others: []string{"json", "csv", "template"}, format: "text"},
+		{env: "template", others: []string{"json", "csv", "template"}, args: []string{"--template", "t.tmpl"}, format: "template"},
+		{env: "json"},
+		{env: "text"},
+		{env: "csv"},
+		{env: "json", args: []string{"--json=false"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("APGCHECK_FORMAT", tt.env)
+		fs := newFlagSet("test")
+		var format *string
+		var isJson *bool
+		if tt.others != nil {
+			format = formatFlag(fs, "text", tt.others...)
+			fs.String("template", "", "")
+		} else {
+			isJson = fs.BoolP("json", "j", false, "")
+		}
+		if err := parseFlags(fs, tt.args); err != nil {
+			t.Errorf("APGCHECK_FORMAT=%s %v: %v", tt.env, tt.args, err)
+			continue
+		}
+		if format != nil && *format != tt.format {
+			t.Errorf("APGCHECK_FORMAT=%s %v: --format %s, want %s", tt.env, tt.args, *format, tt.format)
+		}
+		if isJson != nil {
+			want := tt.env == "json" && len(tt.args) == 0
+			if *isJson != want {
+				t.Errorf("APGCHECK_FORMAT=%s %v: --json %v, want %v", tt.env, tt.args, *isJson, want)
+			}
+		}
+	}
+}
+
+func TestEnvOverridesDefaultsOnly(t *testing.T) {
+	t.Setenv("APGCHECK_PROFILE", "strict.json")
+	t.Setenv("APGCHECK_TEMPDIR", "/var/tmp")
+
+	fs := newFlagSet("test")
+	limits := addLimitFlags(fs)
+	if err := parseFlags(fs, []string{"--temp-dir", "/scratch"}); err != nil {
+		t.Fatal(err)
+	}
+	if *limits.policy != "strict.json" || flagSource(fs.Lookup("policy")) != "APGCHECK_PROFILE" {
+		t.Errorf("--policy = %q from %s, want strict.json from APGCHECK_PROFILE", *limits.policy, flagSource(fs.Lookup("policy")))
+	}
+	if *limits.tempDir != "/scratch" || flagSource(fs.Lookup("temp-dir")) != "command line" {
+		t.Errorf("--temp-dir = %q from %s, want /scratch from the command line", *limits.tempDir, flagSource(fs.Lookup("temp-dir")))
+	}
+}
+
+func TestMaxFileSizeFollowsMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	policy := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tests := []struct {
+		args []string
+		want int64
+	}{
+		{nil, 500},
+		{[]string{"--max-size", "900"}, 900},
+		{[]string{"--max-size", "900", "--max-file-size", "100"}, 100},
+		{[]string{"--policy", policy("total.json", `{"limits": {"max_total_size_mb": 2048}}`)}, 2048},
+		{[]string{"--policy", policy("total.json", `{"limits": {"max_total_size_mb": 2048}}`), "--max-size", "900"}, 900},
+		{[]string{"--policy", policy("file.json", `{"limits": {"max_file_size_mb": 50}}`), "--max-size", "900"}, 50},
+	}
+	for _, tt := range tests {
+		fs := newFlagSet("test")
+		limits := addLimitFlags(fs)
+		if err := parseFlags(fs, tt.args); err != nil {
+			t.Fatal(err)
+		}
+		c, ok := limits.newChecker(false, false, checker.Colors{})
+		if !ok {
+			t.Fatalf("%v: newChecker failed", tt.args)
+		}
+		if got := c.Policy.Limits.MaxFileSizeMB; got != tt.want {
+			t.Errorf("%v: max_file_size_mb = %d, want %d", tt.args, got, tt.want)
+		}
+	}
+}
@@ -4,10 +4,13 @@
 package main
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"text/template"
 
 	"github.com/spf13/pflag"
 
@@ -15,106 +18,281 @@ import (
 )
 
 func main() {
-	apgFile := pflag.StringP("apgfile", "a", "", "path to APG file to validate")
-	apgVersion := pflag.IntP("apg-version", "A", 1, "APG format version (1 or 2)")
-	version := pflag.BoolP("version", "v", false, "show version information")
-	help := pflag.BoolP("help", "h", false, "show this help message")
-	noColor := pflag.Bool("no-color", false, "disable colored output")
-	quiet := pflag.BoolP("quiet", "q", false, "suppress output")
-	isJson := pflag.BoolP("json", "j", false, "output in JSON format")
-	verbose := pflag.BoolP("verbose", "V", false, "verbose mode")
-	skipSums := pflag.Bool("skip-checksums", false, "skip verification of MD5 and CRC32 hashes")
-	maxSizeMB := pflag.Int64("max-size", 500, "maximum allowed total decompression size in MB")
-
-	pflag.Parse()
+	if len(os.Args) > 1 && os.Args[1] == checker.SandboxCommand {
+		os.Exit(checker.RunSandbox())
+	}
+	if len(os.Args) > 1 {
+		for _, cmd := range commands {
+			if cmd.name == os.Args[1] {
+				status := cmd.run(os.Args[2:])
+				saveCaches()
+				os.Exit(status)
+			}
+		}
+	}
+	status := runValidate(os.Args[1:])
+	saveCaches()
+	os.Exit(status)
+}
+
+func runValidate(args []string) int {
+	fs := newFlagSet("apgcheck")
+	apgFile := fs.StringP("apgfile", "a", "", "path to APG file to validate, or - to read it from standard input")
+	apgVersion := fs.IntP("apg-version", "A", 1, "APG format version (1 or 2)")
+	version := fs.BoolP("version", "v", false, "show version information")
+	help := fs.BoolP("help", "h", false, "show this help message")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	quiet := fs.BoolP("quiet", "q", false, "suppress output")
+	isJson := fs.BoolP("json", "j", false, "output in JSON format")
+	format := formatFlag(fs, "text", "json", "csv", "template")
+	templateFile := fs.String("template", "", "with --format template, render the report through this Go text/template file")
+	verbose := fs.BoolP("verbose", "V", false, "verbose mode")
+	skipSums := fs.Bool("skip-checksums", false, "skip verification of MD5 and CRC32 hashes")
+	limits := addLimitFlags(fs)
+	source := fs.Bool("source", false, "validate an APG source package")
+	repoIndex := fs.String("repo-index", "", "repository index to resolve dependencies against")
+	scanLicenses := fs.Bool("scan-licenses", false, "detect licenses in shipped files and report those the package license does not cover")
+	strictMeta := fs.Bool("strict-metadata", false, "reject metadata keys the APG format does not define")
+	baseManifest := fs.String("base-manifest", "", "base-system file list; fail packages that overwrite files of other packages in it")
+	fix := fs.Bool("fix", false, "repair checksum manifests, metadata formatting and file modes in place")
+	profile := fs.Bool("profile", false, "record phase timings and peak memory in the report")
+	dryRun := fs.Bool("dry-run", false, "with --fix, list the repairs without modifying the package")
+	trace := addTraceFlags(fs)
+	auditLog := fs.String("audit-log", "", "append the decision to this hash-chained audit log")
+	operator := fs.String("operator", "", "who is recorded in the audit log as taking the decision (default: the current user)")
+
+	if err := parseFlags(fs, args); err != nil {
+		printUsage(fs)
+		return 2
+	}
 
 	colors := checker.NewColors(*noColor)
 
 	if *help {
-		pflag.Usage()
-		os.Exit(0)
+		printUsage(fs)
+		return 0
 	}
 
 	if *version {
 		fmt.Printf("%sapgcheck v%s%s\n", colors.Bold, checker.Version, colors.Reset)
 		fmt.Printf("%sAPG file validator for NurOS%s\n", colors.Blue, colors.Reset)
-		os.Exit(0)
+		return 0
+	}
+
+	output, err := outputFormat(*format, *isJson, "text", "json", "csv", "template")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+		return 2
+	}
+	if (output == "template") != (*templateFile != "") {
+		fmt.Fprintf(os.Stderr, "%sError: --template requires --format template, and --format template a --template%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+	*isJson = output == "json"
+	var tmpl *template.Template
+	if *templateFile != "" {
+		var err error
+		if tmpl, err = loadTemplate(*templateFile); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
 	}
 
 	if *verbose {
 		if *isJson {
 			fmt.Fprintf(os.Stderr, "%sError: Verbose mode not compatible with --json%s\n", colors.Red, colors.Reset)
-			os.Exit(1)
+			return 1
+		}
+		if output != "text" {
+			fmt.Fprintf(os.Stderr, "%sError: Verbose mode not compatible with --format %s%s\n", colors.Red, output, colors.Reset)
+			return 1
 		}
 		if *quiet {
 			fmt.Fprintf(os.Stderr, "%sError: Verbose mode not compatible with --quiet%s\n", colors.Red, colors.Reset)
-			os.Exit(1)
+			return 1
 		}
 	}
 
-	if checker.IsEmpty(*apgFile) {
-		fmt.Fprintf(os.Stderr, "%sError: No APG file specified%s\n", colors.Red, colors.Reset)
-		os.Exit(1)
+	if *dryRun && !*fix {
+		fmt.Fprintf(os.Stderr, "%sError: --dry-run requires --fix%s\n", colors.Red, colors.Reset)
+		return 2
 	}
 
-	c := checker.New(*verbose, *skipSums, colors, *maxSizeMB)
-
-	pathToFolderTMP := "/tmp/apgcheck-" + checker.GenerateRandomNumber()
-	if err := checker.ExtractTarXz(*apgFile, pathToFolderTMP, *maxSizeMB*1024*1024, c); err != nil {
-		fmt.Fprintf(os.Stderr, "%sExtraction Error: %v%s\n", colors.Red, err, colors.Reset)
-		os.RemoveAll(pathToFolderTMP)
-		os.Exit(1)
+	if showingConfig {
+		return showConfig(fs, limits, output, colors)
 	}
 
-	report := checker.ValidationResponse{
-		Version:  *apgVersion,
-		File:     *apgFile,
-		Errors:   []string{},
-		Warnings: []string{},
+	if checker.IsEmpty(*apgFile) {
+		fmt.Fprintf(os.Stderr, "%sError: No APG file specified%s\n", colors.Red, colors.Reset)
+		return 1
 	}
 
-	var fileErr, jsonErr error
-	var status string
-
-	if *apgVersion == 2 {
-		fileErr, jsonErr, status = c.CheckV2(pathToFolderTMP)
-	} else {
-		fileErr, jsonErr, status = c.CheckV1(pathToFolderTMP)
+	if *fix && *apgFile == "-" {
+		fmt.Fprintf(os.Stderr, "%sError: --fix cannot rewrite a package read from standard input%s\n", colors.Red, colors.Reset)
+		return 1
+	}
+	tracer := trace.tracer()
+	if tracer != nil && *limits.harden && !*limits.sandbox {
+		fmt.Fprintf(os.Stderr, "%sError: --harden needs --sandbox when spans are exported (--otlp-endpoint or OTEL_EXPORTER_OTLP_*), since its seccomp filter denies the socket the export needs%s\n", colors.Red, colors.Reset)
+		return 2
+	}
+	if *fix {
+		limits.writable = append(limits.writable, filepath.Dir(*apgFile))
+	}
+	if *auditLog != "" {
+		limits.writable = append(limits.writable, filepath.Dir(*auditLog))
+	}
+	c, ok := limits.newChecker(*verbose, *skipSums, colors)
+	if !ok {
+		return 1
+	}
+	c.SourcePackage = *source
+	c.Profiling = *profile
+	c.ScanLicenses = *scanLicenses
+	c.StrictMetadata = *strictMeta
+	if c.Tracer = tracer; c.Tracer != nil {
+		c.TraceParent, _ = checker.ParseTraceparent(os.Getenv("TRACEPARENT"))
+		defer func() {
+			if err := c.Tracer.Flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "%sWarning: %v%s\n", colors.Yellow, err, colors.Reset)
+			}
+		}()
 	}
 
-	if fileErr != nil {
-		report.Errors = append(report.Errors, fileErr.Error())
+	if *repoIndex != "" {
+		idx, err := checker.LoadIndex(*repoIndex)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+		c.RepoIndex = idx
 	}
-	if jsonErr != nil {
-		report.Errors = append(report.Errors, jsonErr.Error())
+	if *baseManifest != "" {
+		manifest, err := checker.LoadBaseManifest(*baseManifest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+		c.BaseManifest = manifest
 	}
 
-	report.Valid = len(report.Errors) == 0 && status == "good"
+	input := *apgFile
+	if input == "-" {
+		var err error
+		if input, err = spoolStdin(c); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+		defer os.Remove(input)
+	}
+
+	var log *checker.AuditLog
+	if *auditLog != "" {
+		var err error
+		if log, err = checker.OpenAuditLog(*auditLog); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+	}
 
-	if *isJson && report.Valid {
-		metaData, _ := os.ReadFile(filepath.Join(pathToFolderTMP, "metadata.json"))
-		var meta map[string]interface{}
-		json.Unmarshal(metaData, &meta)
-		report.Metadata = meta
+	var fixes []checker.FixChange
+	if *fix {
+		var err error
+		fixes, err = c.Fix(*apgFile, *apgVersion, *dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sFix Error: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
 	}
 
-	os.RemoveAll(pathToFolderTMP)
+	report, err := c.ValidateFile(input, *apgVersion)
+	report.File = *apgFile
+	if log != nil {
+		policy := cmp.Or(*limits.policy, "default")
+		if err := recordAudit(log, input, *apgFile, c, policy, cmp.Or(*operator, operatorName()), report, err); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sExtraction Error: %v%s\n", colors.Red, err, colors.Reset)
+		printHint(err.Error(), "", colors)
+		return 1
+	}
+	report.Fixes = fixes
 
 	if *isJson {
 		out, _ := json.MarshalIndent(report, "", "  ")
 		fmt.Println(string(out))
+	} else if output == "csv" {
+		if err := writeCSV([]checker.ValidationResponse{report}); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
+	} else if tmpl != nil {
+		if err := tmpl.Execute(os.Stdout, report); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError: cannot render template: %v%s\n", colors.Red, err, colors.Reset)
+			return 1
+		}
 	} else if !*quiet {
-		if report.Valid {
+		action := "Fixed"
+		if *dryRun {
+			action = "Would fix"
+		}
+		for _, f := range fixes {
+			fmt.Printf("%s%s %s: %s%s\n", colors.Yellow, action, f.File, f.Repair, colors.Reset)
+		}
+		printWarnings(report.Warnings, "", colors)
+		printSuppressed(report.Suppressed, colors)
+		if report.Valid && *source {
+			fmt.Printf("%s✓ APG source package validation successful%s\n", colors.Green, colors.Reset)
+			fmt.Printf("File: %s\n", *apgFile)
+		} else if report.Valid {
 			fmt.Printf("%s✓ APG v%d file validation successful%s\n", colors.Green, *apgVersion, colors.Reset)
 			fmt.Printf("File: %s\n", *apgFile)
 		} else {
-			for _, e := range report.Errors {
-				fmt.Fprintf(os.Stderr, "%sError: %v%s\n", colors.Red, e, colors.Reset)
-			}
+			printErrors(report.Errors, "", colors)
+			printNested(report.Nested, "", colors)
 		}
 	}
 
-	if !report.Valid {
-		os.Exit(1)
+	if *profile && output == "text" && !*quiet {
+		printProfile(report.Profile, colors)
 	}
+
+	return c.Policy.ExitCode(report.Valid, report.Findings)
+}
+
+// spoolStdin copies a package piped to standard input, such as the output
+// of `tar -c`, to a temporary file, up to the size limit of the policy.
+func spoolStdin(c *checker.Checker) (string, error) {
+	f, err := os.CreateTemp(c.TempDir, "apgcheck-stdin-*.apg")
+	if err != nil {
+		return "", fmt.Errorf("cannot read standard input: %w", err)
+	}
+	defer f.Close()
+	var r io.Reader = os.Stdin
+	limit := c.Policy.Limits.MaxTotalSizeMB * 1024 * 1024
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	n, err := io.Copy(f, r)
+	switch {
+	case err != nil:
+		err = fmt.Errorf("cannot read standard input: %w", err)
+	case limit > 0 && n > limit:
+		err = fmt.Errorf("standard input is over the %d MB size limit (max_total_size_mb)", c.Policy.Limits.MaxTotalSizeMB)
+	case n == 0:
+		err = fmt.Errorf("standard input is empty")
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func printUsage(fs *pflag.FlagSet) {
+	fmt.Fprintln(fs.Output(), "Usage of apgcheck:")
+	fs.PrintDefaults()
 }
@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	checker "apgcheck/src"
+)
+
+// printErrors writes each error followed by its remediation hint, if any.
+func printErrors(errs []string, indent string, colors checker.Colors) {
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "%s%sError: %v%s%s\n", colors.Red, indent, e, codeSuffix(e), colors.Reset)
+		printHint(e, indent, colors)
+	}
+}
+
+func printWarnings(warnings []string, indent string, colors checker.Colors) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "%s%sWarning: %v%s%s\n", colors.Yellow, indent, w, codeSuffix(w), colors.Reset)
+		printHint(w, indent, colors)
+	}
+}
+
+// codeSuffix returns the rule code to print after a finding, if any.
+func codeSuffix(message string) string {
+	if code := checker.CodeFor(message); code != "" {
+		return " [" + code + "]"
+	}
+	return ""
+}
+
+func printHint(message, indent string, colors checker.Colors) {
+	if hint := checker.HintFor(message); hint != "" {
+		fmt.Fprintf(os.Stderr, "%s%s  Hint: %s%s\n", colors.Blue, indent, hint, colors.Reset)
+	}
+}
+
+// printSuppressed lists the findings suppressed by the package itself.
+func printSuppressed(suppressed []checker.SuppressedFinding, colors checker.Colors) {
+	for _, s := range suppressed {
+		fmt.Fprintf(os.Stderr, "%sSuppressed %s: %s [%s]: %s%s\n", colors.Blue, s.Severity, s.Message, s.Code, s.Reason, colors.Reset)
+	}
+}
+
+// printNested lists the findings of invalid nested packages under the
+// package they are shipped in.
+func printNested(nested []checker.NestedPackage, indent string, colors checker.Colors) {
+	for _, n := range nested {
+		if n.Report.Valid {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s%s✗ %s%s\n", colors.Red, indent, n.Path, colors.Reset)
+		printErrors(n.Report.Errors, indent+"  ", colors)
+		printNested(n.Report.Nested, indent+"  ", colors)
+	}
+}
+
+func printProfile(p *checker.Profile, colors checker.Colors) {
+	if p == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%sProfile:%s\n", colors.Bold, colors.Reset)
+	for _, t := range p.Timings {
+		fmt.Fprintf(os.Stderr, "  %-26s %10.2f ms  (%d calls)\n", t.Name, t.Milliseconds, t.Calls)
+	}
+	fmt.Fprintf(os.Stderr, "  %-26s %10.1f MiB\n", "peak memory", float64(p.PeakMemoryBytes)/(1024*1024))
+}
+
+// loadTemplate parses a report template for --format template. Besides
+// the text/template builtins, templates can use join, json, upper, lower,
+// and code and hint, which return the rule code and hint of a message.
+func loadTemplate(file string) (*template.Template, error) {
+	t, err := template.New(filepath.Base(file)).Funcs(template.FuncMap{
+		"join":  strings.Join,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"json": func(v any) (string, error) {
+			out, err := json.Marshal(v)
+			return string(out), err
+		},
+		"code": checker.CodeFor,
+		"hint": checker.HintFor,
+	}).ParseFiles(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse template: %w", err)
+	}
+	return t, nil
+}
+
+// writeCSV writes one row per package for spreadsheets. Packages without
+// readable metadata are named by their file.
+func writeCSV(reports []checker.ValidationResponse) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"name", "version", "status", "errors", "warnings", "duration_ms"})
+	for _, r := range reports {
+		status := "valid"
+		if !r.Valid {
+			status = "invalid"
+		}
+		w.Write([]string{
+			cmp.Or(r.Name, filepath.Base(r.File)),
+			r.PackageVersion,
+			status,
+			strconv.Itoa(len(r.Errors)),
+			strconv.Itoa(len(r.Warnings)),
+			strconv.FormatInt(r.Duration.Milliseconds(), 10),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
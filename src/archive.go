@@ -6,18 +6,20 @@ package checker
 import (
 	"archive/tar"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
 	"syscall"
-
-	"github.com/ulikunitz/xz"
 )
 
-func ExtractTarXz(src, dest string, maxTotalSize int64, c *Checker) error {
+// ExtractTarXz extracts an APG archive to dest and returns the headers of
+// all entries in archive order.
+func ExtractTarXz(src, dest string, c *Checker) ([]*tar.Header, error) {
+
 	fi, err := os.Stat(src)
 	if err != nil {
-		return fmt.Errorf("cannot stat archive: %w", err)
+		return nil, fmt.Errorf("cannot stat archive: %w", err)
 	}
 	archiveSize := fi.Size()
 	c.log(fmt.Sprintf("Archive size: %.2f MB", float64(archiveSize)/(1024*1024)))
@@ -25,62 +27,145 @@ func ExtractTarXz(src, dest string, maxTotalSize int64, c *Checker) error {
 	available, err := getAvailableSpace(filepath.Dir(dest))
 	if err == nil {
 		if uint64(archiveSize) > available {
-			return fmt.Errorf("not enough space in destination: need %d, have %d", archiveSize, available)
+			return nil, fmt.Errorf("not enough space in destination: need %d, have %d", archiveSize, available)
 		}
 	}
 
 	f, err := os.Open(src)
 	if err != nil {
-		return fmt.Errorf("cannot open archive: %w", err)
+		return nil, fmt.Errorf("cannot open archive: %w", err)
 	}
 	defer f.Close()
 
-	xzr, err := xz.NewReader(f)
+	xzr, err := c.openXZ(f)
 	if err != nil {
-		return fmt.Errorf("cannot create the XZ-reader: %w", err)
+		return nil, fmt.Errorf("cannot create the XZ-reader: %w", err)
 	}
+	defer xzr.Close()
 
-	tr := tar.NewReader(xzr)
+	cr := &countingReader{r: xzr}
+	tr := tar.NewReader(cr)
 	absDest, _ := filepath.Abs(dest)
+	c.entries = entryIndex{}
 
-	var currentTotalSize int64
+	budget := entryBudget{limits: c.Policy.Limits}
+	var headers []*tar.Header
+	files := map[string]bool{}
+	tree := entryTree{}
 
 	c.log("Processing archive contents...")
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
+			if err := drainXZ(xzr); err != nil {
+				return nil, err
+			}
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("error during reading archive: %w", err)
+			return nil, fmt.Errorf("error during reading archive: %w", err)
 		}
 
-		currentTotalSize += header.Size
-		if currentTotalSize > maxTotalSize {
-			return fmt.Errorf("tar-bomb detected or size limit exceeded (> %d MB)", maxTotalSize/(1024*1024))
+		if err := budget.account(header.Name, header.Size); err != nil {
+			return nil, err
 		}
+		headers = append(headers, header)
 
 		cleanPath := filepath.Clean(header.Name)
-		target := filepath.Join(absDest, cleanPath)
+		target, ok := withinDir(absDest, cleanPath)
+		if !ok {
+			return nil, fmt.Errorf("entry path leaves the package: %s", header.Name)
+		}
+		if err := tree.add(header, cleanPath); err != nil {
+			return nil, err
+		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
 			os.MkdirAll(target, 0755)
-		case tar.TypeReg:
-			if header.Size > maxTotalSize {
-				return fmt.Errorf("file too large: %s", header.Name)
-			}
+		case tar.TypeReg, tar.TypeGNUSparse:
 			os.MkdirAll(filepath.Dir(target), 0755)
 			outFile, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 			if err != nil {
-				return fmt.Errorf("failed to create file: %w", err)
+				return nil, fmt.Errorf("failed to create file: %w", err)
+			}
+			offset := cr.n
+			var head entryHead
+			var w io.Writer = io.MultiWriter(budget.writer(outFile), &head)
+			var hashes map[string]hash.Hash
+			if !c.SkipChecksums {
+				var hw io.Writer
+				hashes, hw = entryHashes(cleanPath)
+				w = io.MultiWriter(w, hw)
 			}
-			_, err = io.CopyN(outFile, tr, header.Size)
+			_, err = io.CopyN(w, tr, header.Size)
 			outFile.Close()
 			if err != nil && err != io.EOF {
-				return fmt.Errorf("failed to write file: %w", err)
+				return nil, fmt.Errorf("failed to write file: %w", err)
+			}
+			c.entries.add(target, offset, header.Size, head, hashes)
+			files[cleanPath] = true
+		case tar.TypeLink:
+			// Hard links may only point at a regular file extracted
+			// earlier, which also keeps them inside the archive.
+			linked := filepath.Clean(header.Linkname)
+			source, ok := withinDir(absDest, linked)
+			if !ok || !files[linked] {
+				return nil, fmt.Errorf("hardlink target is not a regular file earlier in the archive: %s -> %s", header.Name, header.Linkname)
+			}
+			os.MkdirAll(filepath.Dir(target), 0755)
+			if err := os.Link(source, target); err != nil {
+				return nil, fmt.Errorf("failed to create hardlink: %w", err)
+			}
+			if e, ok := c.entries[source]; ok {
+				c.entries[target] = e
+			}
+			files[cleanPath] = true
+		}
+	}
+	return headers, nil
+}
+
+// withinDir joins an entry name onto the extraction directory, and reports
+// whether the result stays inside it.
+func withinDir(root, name string) (string, bool) {
+	target := filepath.Join(root, name)
+	rel, err := filepath.Rel(root, target)
+	return target, err == nil && filepath.IsLocal(rel)
+}
+
+// entryTree maps every path the archive creates, including the parent
+// directories it implies, to the entry that created it, so a name used both
+// as a directory and as anything else is reported as such instead of
+// failing extraction with a bare "not a directory".
+type entryTree map[string]*tar.Header
+
+func (t entryTree) add(h *tar.Header, clean string) error {
+	if prev, ok := t[clean]; ok && (prev.Typeflag == tar.TypeDir) != (h.Typeflag == tar.TypeDir) {
+		file, dir := h, prev
+		if h.Typeflag == tar.TypeDir {
+			file, dir = prev, h
+		}
+		return fmt.Errorf("path collision: %s is a %s in entry %s and a directory in entry %s", clean, entryTypeName(file.Typeflag), file.Name, dir.Name)
+	}
+	for parent := filepath.Dir(clean); parent != "." && parent != "/"; parent = filepath.Dir(parent) {
+		if prev, ok := t[parent]; ok {
+			if prev.Typeflag != tar.TypeDir {
+				return fmt.Errorf("path collision: %s is a %s in entry %s and a directory in entry %s", parent, entryTypeName(prev.Typeflag), prev.Name, h.Name)
 			}
+			break
 		}
+		t[parent] = &tar.Header{Name: h.Name, Typeflag: tar.TypeDir}
+	}
+	t[clean] = h
+	return nil
+}
+
+// drainXZ decodes what follows the end of the tar archive, so corrupt
+// trailing streams are reported instead of silently ignored.
+func drainXZ(r io.Reader) error {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("corrupt xz data after end of tar archive: %w", err)
 	}
 	return nil
 }
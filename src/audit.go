@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditGenesis is the previous hash of the first entry of an audit log.
+var auditGenesis = strings.Repeat("0", 64)
+
+// AuditEntry records one validation decision. Each entry's hash covers the
+// entry and the hash of the one before it, so changing, inserting or
+// removing an entry breaks the chain from there on.
+type AuditEntry struct {
+	Seq          int    `json:"seq"`
+	Time         string `json:"time"`
+	Package      string `json:"package"`
+	SHA256       string `json:"sha256"`
+	Policy       string `json:"policy"`
+	PolicySHA256 string `json:"policy_sha256"`
+	Result       string `json:"result"`
+	Errors       int    `json:"errors"`
+	Warnings     int    `json:"warnings"`
+	Operator     string `json:"operator"`
+	Prev         string `json:"prev"`
+	Hash         string `json:"hash,omitempty"`
+}
+
+// digest returns the hash of the entry, which covers every field but the
+// hash itself.
+func (e AuditEntry) digest() string {
+	e.Hash = ""
+	body, _ := json.Marshal(e)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditResult describes the outcome of a validation for the audit log:
+// valid, invalid, or error when the package could not be validated.
+func AuditResult(report ValidationResponse, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case report.Valid:
+		return "valid"
+	}
+	return "invalid"
+}
+
+// PolicyDigest identifies the exact policy a decision was made under.
+func PolicyDigest(policy Policy) string {
+	body, _ := json.Marshal(policy)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditLog is an append-only, hash-chained log of validation decisions,
+// one JSON entry per line.
+type AuditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// OpenAuditLog opens an audit log, creating it if needed.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open audit log: %w", err)
+	}
+	f.Close()
+	return &AuditLog{path: path}, nil
+}
+
+// Record appends an entry for the decision about a package, filling in
+// the package digest, time, sequence number and chain hashes. The log is
+// locked while appending, so several processes may share it.
+func (l *AuditLog) Record(apgFile string, e AuditEntry) error {
+	digest, _, err := fileSHA256(apgFile)
+	if err != nil {
+		return fmt.Errorf("cannot record audit entry: %w", err)
+	}
+	e.SHA256 = digest
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("cannot record audit entry: %w", err)
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("cannot lock audit log: %w", err)
+	}
+
+	last, err := lastAuditEntry(f)
+	if err != nil {
+		return fmt.Errorf("cannot record audit entry: %w", err)
+	}
+	e.Seq, e.Prev = 1, auditGenesis
+	if last != nil {
+		e.Seq, e.Prev = last.Seq+1, last.Hash
+	}
+	e.Time = time.Now().UTC().Format(time.RFC3339)
+	e.Hash = e.digest()
+	line, _ := json.Marshal(e)
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("cannot record audit entry: %w", err)
+	}
+	return f.Sync()
+}
+
+// lastAuditEntry reads the last entry of a log, or nil for an empty log.
+func lastAuditEntry(f *os.File) (*AuditEntry, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	var tail []byte
+	for offset := size; offset > 0; {
+		n := min(offset, 4096)
+		offset -= n
+		chunk := make([]byte, n)
+		if _, err := f.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		tail = append(chunk, tail...)
+		if i := bytes.LastIndexByte(bytes.TrimRight(tail, "\n"), '\n'); i >= 0 {
+			tail = tail[i+1:]
+			break
+		}
+	}
+	var e AuditEntry
+	if err := json.Unmarshal(bytes.TrimSpace(tail), &e); err != nil {
+		return nil, fmt.Errorf("last entry of the audit log is corrupt: %w", err)
+	}
+	return &e, nil
+}
+
+// VerifyAuditLog checks the hash chain of an audit log and returns its
+// entries. The error names the first entry that does not match. Removing
+// entries from the end leaves a valid chain, so the last hash should be
+// kept elsewhere to compare against.
+func VerifyAuditLog(path string) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	prev := auditGenesis
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; s.Scan(); line++ {
+		var e AuditEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return entries, fmt.Errorf("line %d: cannot parse entry: %w", line, err)
+		}
+		canonical, _ := json.Marshal(e)
+		switch {
+		case e.Seq != len(entries)+1:
+			return entries, fmt.Errorf("line %d: sequence number %d, expected %d", line, e.Seq, len(entries)+1)
+		case e.Prev != prev:
+			return entries, fmt.Errorf("line %d: entry does not follow the one before it", line)
+		case e.Hash != e.digest() || !bytes.Equal(canonical, s.Bytes()):
+			return entries, fmt.Errorf("line %d: entry was modified", line)
+		}
+		entries = append(entries, e)
+		prev = e.Hash
+	}
+	return entries, s.Err()
+}
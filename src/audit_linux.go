@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on a file, released when it is closed.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !linux
+
+package checker
+
+import "os"
+
+// lockFile is a no-op where flock is unavailable; appends from one
+// process are still serialized.
+func lockFile(f *os.File) error {
+	return nil
+}
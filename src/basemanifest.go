@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// BaseManifest maps the files of the base system to the package owning
+// each of them, or to "" when the manifest does not say.
+type BaseManifest map[string]string
+
+// LoadBaseManifest reads a base-system manifest: one installed path per
+// line, optionally followed by the name of the package owning it. Blank
+// lines and lines starting with # are ignored.
+func LoadBaseManifest(file string) (BaseManifest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base manifest: %w", err)
+	}
+	defer f.Close()
+
+	manifest := BaseManifest{}
+	scanner := bufio.NewScanner(f)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 2 || !path.IsAbs(fields[0]) {
+			return nil, fmt.Errorf("invalid base manifest line %d: expected an absolute path and an optional package name", n)
+		}
+		owner := ""
+		if len(fields) == 2 {
+			owner = fields[1]
+		}
+		manifest[path.Clean(fields[0])] = owner
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read base manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// checkBaseOverlap reports files that would overwrite base-system files
+// owned by another package, unless the package declares that it replaces
+// the owner.
+func (c *Checker) checkBaseOverlap(meta MetadataV2, files []string, report *ValidationResponse) {
+	replaces := map[string]bool{}
+	for _, r := range meta.Replaces {
+		if rel, err := ParseRelation(r); err == nil {
+			replaces[rel.Name] = true
+		}
+	}
+	for _, file := range files {
+		owner, ok := c.BaseManifest[file]
+		if !ok || owner == meta.Name || replaces[owner] {
+			continue
+		}
+		if owner == "" {
+			owner = "the base system"
+		}
+		report.Errors = append(report.Errors, fmt.Sprintf("overwrites base system file: %s is owned by %s", file, owner))
+	}
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"fmt"
+	"strings"
+)
+
+type BundleReport struct {
+	Valid    bool                 `json:"valid"`
+	Packages []ValidationResponse `json:"packages"`
+	Errors   []string             `json:"errors"`
+	Findings []Finding            `json:"findings"`
+}
+
+// ValidateBundle validates the related packages produced by one build
+// (foo, foo-dev, foo-doc, ...) and checks that they are consistent with
+// each other.
+func (c *Checker) ValidateBundle(files []string, apgVersion int) (*BundleReport, error) {
+	report := &BundleReport{
+		Valid:    true,
+		Packages: []ValidationResponse{},
+		Errors:   []string{},
+	}
+
+	var metas []MetadataV2
+	var contents []PackageFiles
+	for _, f := range files {
+		c.log(fmt.Sprintf("Validating %s...", f))
+		r, err := c.ValidateFile(f, apgVersion)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		report.Packages = append(report.Packages, r)
+		if !r.Valid {
+			report.Valid = false
+			continue
+		}
+		meta := MetadataFromMap(r.Metadata)
+		metas = append(metas, meta)
+		contents = append(contents, PackageFiles{Name: meta.Name, Files: r.Files})
+	}
+
+	c.log("Checking cross-package consistency...")
+	report.Errors = append(report.Errors, checkBundleConsistency(metas)...)
+	for _, fc := range DetectFileConflicts(contents) {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s is shipped by more than one package: %s", fc.Path, strings.Join(fc.Packages, ", ")))
+	}
+
+	if len(report.Errors) > 0 {
+		report.Valid = false
+	}
+	report.Findings = findingsOf(report.Errors, nil)
+	return report, nil
+}
+
+func checkBundleConsistency(metas []MetadataV2) []string {
+	var errs []string
+	byName := map[string]MetadataV2{}
+	for _, m := range metas {
+		if _, dup := byName[m.Name]; dup {
+			errs = append(errs, fmt.Sprintf("package %s appears more than once", m.Name))
+		}
+		byName[m.Name] = m
+		if m.Version != metas[0].Version {
+			errs = append(errs, fmt.Sprintf("version mismatch: %s is %s, %s is %s", m.Name, m.Version, metas[0].Name, metas[0].Version))
+		}
+	}
+
+	for _, m := range metas {
+		if !strings.HasSuffix(m.Name, "-dev") {
+			continue
+		}
+		main, ok := byName[strings.TrimSuffix(m.Name, "-dev")]
+		if !ok {
+			continue
+		}
+		if !dependsOn(m, main) {
+			errs = append(errs, fmt.Sprintf("%s does not depend on %s %s", m.Name, main.Name, main.Version))
+		}
+	}
+	return errs
+}
+
+func dependsOn(m, target MetadataV2) bool {
+	for _, dep := range m.Dependencies {
+		rel, err := ParseRelation(dep)
+		if err == nil && rel.Name == target.Name && rel.SatisfiedBy(target.Version) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheEntry is a cached validation result, stored under the SHA-256
+// digest of the package and a digest of the options it was validated
+// with.
+type CacheEntry struct {
+	SHA256  string             `json:"sha256"`
+	Options string             `json:"options"`
+	Report  ValidationResponse `json:"report"`
+	Files   []string           `json:"files,omitempty"`
+}
+
+// FileStamp remembers the digest of a package file by its size and mtime,
+// so a cache file can find the result of an unchanged file without
+// reading it.
+type FileStamp struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	SHA256  string `json:"sha256"`
+}
+
+// ResultCache reuses validation results of packages whose content and
+// options are unchanged. A cache file holds every result and is written
+// by Save; a cache directory holds one file per result, written as soon
+// as it is stored, and can be shared by concurrent runs. Both key results
+// the same way, so a package copied to another path is a hit.
+type ResultCache struct {
+	mu      sync.Mutex
+	path    string
+	dir     bool
+	Entries map[string]CacheEntry `json:"entries"`
+	Stamps  map[string]FileStamp  `json:"stamps"`
+}
+
+// LoadResultCache opens the cache file at path, which need not exist yet.
+func LoadResultCache(path string) (*ResultCache, error) {
+	cache := &ResultCache{path: path, Entries: map[string]CacheEntry{}, Stamps: map[string]FileStamp{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, fmt.Errorf("cache invalid JSON: %w", err)
+	}
+	if cache.Entries == nil {
+		cache.Entries = map[string]CacheEntry{}
+	}
+	if cache.Stamps == nil {
+		cache.Stamps = map[string]FileStamp{}
+	}
+	return cache, nil
+}
+
+// OpenCacheDir opens the cache directory at path, creating it if needed.
+func OpenCacheDir(path string) (*ResultCache, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &ResultCache{path: path, dir: true}, nil
+}
+
+// Path is the file or directory the cache is kept in.
+func (rc *ResultCache) Path() string {
+	return rc.path
+}
+
+// IsDir reports whether the cache is a directory.
+func (rc *ResultCache) IsDir() bool {
+	return rc.dir
+}
+
+// Save writes a cache file. A cache directory is always up to date.
+func (rc *ResultCache) Save() error {
+	if rc.dir {
+		return nil
+	}
+	rc.mu.Lock()
+	data, err := json.Marshal(rc)
+	rc.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(rc.path, data)
+}
+
+// cacheKey names the result of a package validated with some options.
+func cacheKey(digest, options string) string {
+	optionsDigest := sha256.Sum256([]byte(options))
+	return fmt.Sprintf("%s-%x", digest, optionsDigest[:8])
+}
+
+// digest returns the SHA-256 digest of a package file. A cache file
+// remembers digests by size and mtime, so unchanged files are never
+// re-read; a touched file is hashed again.
+func (rc *ResultCache) digest(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	key, _ := filepath.Abs(path)
+	if !rc.dir {
+		rc.mu.Lock()
+		stamp, ok := rc.Stamps[key]
+		rc.mu.Unlock()
+		if ok && stamp.Size == fi.Size() && stamp.ModTime == fi.ModTime().UnixNano() {
+			return stamp.SHA256, nil
+		}
+	}
+	digest, _, err := fileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	if !rc.dir {
+		rc.mu.Lock()
+		rc.Stamps[key] = FileStamp{Size: fi.Size(), ModTime: fi.ModTime().UnixNano(), SHA256: digest}
+		rc.mu.Unlock()
+	}
+	return digest, nil
+}
+
+// entryPath is where a cache directory keeps a result.
+func (rc *ResultCache) entryPath(key string) string {
+	return filepath.Join(rc.path, key[:2], key+".json")
+}
+
+func (rc *ResultCache) lookup(path, digest, options string) (ValidationResponse, bool) {
+	key := cacheKey(digest, options)
+	var entry CacheEntry
+	if rc.dir {
+		data, err := os.ReadFile(rc.entryPath(key))
+		if err != nil || json.Unmarshal(data, &entry) != nil {
+			return ValidationResponse{}, false
+		}
+	} else {
+		rc.mu.Lock()
+		entry = rc.Entries[key]
+		rc.mu.Unlock()
+	}
+	if entry.SHA256 != digest || entry.Options != options {
+		return ValidationResponse{}, false
+	}
+	report := entry.Report
+	report.File = path
+	report.Files = entry.Files
+	return report, true
+}
+
+func (rc *ResultCache) store(digest, options string, report ValidationResponse) error {
+	key := cacheKey(digest, options)
+	entry := CacheEntry{SHA256: digest, Options: options, Report: report, Files: report.Files}
+	if !rc.dir {
+		rc.mu.Lock()
+		rc.Entries[key] = entry
+		rc.mu.Unlock()
+		return nil
+	}
+	target := rc.entryPath(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(target, data)
+}
+
+// writeFileAtomic writes a temporary file first, so concurrent runs
+// sharing a cache never read a partial one.
+func writeFileAtomic(target string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".cache-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Chmod(0644); err == nil {
+		_, err = tmp.Write(data)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// cacheOptions describes everything besides the package itself that a
+// validation result depends on.
+func (c *Checker) cacheOptions(apgVersion int) string {
+	policy, _ := json.Marshal(c.Policy)
+	options := fmt.Sprintf("apgcheck=%s apg=%d skip-checksums=%t source=%t scan-licenses=%t strict-metadata=%t policy=%s", Version, apgVersion, c.SkipChecksums, c.SourcePackage, c.ScanLicenses, c.StrictMetadata, policy)
+	if c.RepoIndex != nil {
+		index, _ := json.Marshal(c.RepoIndex)
+		options += fmt.Sprintf(" repo-index=%x", sha256.Sum256(index))
+	}
+	if c.BaseManifest != nil {
+		manifest, _ := json.Marshal(c.BaseManifest)
+		options += fmt.Sprintf(" base-manifest=%x", sha256.Sum256(manifest))
+	}
+	return options
+}
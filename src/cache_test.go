@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestResultCacheBackends(t *testing.T) {
+	for _, dir := range []bool{false, true} {
+		t.Run(map[bool]string{false: "file", true: "directory"}[dir], func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cache")
+			open := func() *ResultCache {
+				t.Helper()
+				load := LoadResultCache
+				if dir {
+					load = OpenCacheDir
+				}
+				cache, err := load(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return cache
+			}
+			pkgs := t.TempDir()
+			apg := writeTar(t, pkgs, "foo.apg", testEntry{name: "metadata.json", body: "{}\n"})
+
+			c := testChecker(t)
+			c.Cache = open()
+			first, err := c.ValidateFile(apg, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Cache.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			// A copy at another path is answered from a reopened cache,
+			// and a cached result can be told apart from a fresh one.
+			c.Cache = open()
+			digest, err := c.Cache.digest(apg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			options := c.cacheOptions(1)
+			marked := first
+			marked.Errors = append(slices.Clone(first.Errors), "cached")
+			if err := c.Cache.store(digest, options, marked); err != nil {
+				t.Fatal(err)
+			}
+			data, _ := os.ReadFile(apg)
+			copied := filepath.Join(pkgs, "copy.apg")
+			os.WriteFile(copied, data, 0644)
+			report, err := c.ValidateFile(copied, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Contains(report.Errors, "cached") || report.File != copied {
+				t.Errorf("ValidateFile() = %q for %s, want the cached result for %s", report.Errors, report.File, copied)
+			}
+
+			// Other options miss.
+			c.SkipChecksums = true
+			if report, _ := c.ValidateFile(copied, 1); slices.Contains(report.Errors, "cached") {
+				t.Error("cached result reused with other options")
+			}
+		})
+	}
+}
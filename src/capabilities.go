@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FileCapability is a security.capability xattr found on an archive entry.
+type FileCapability struct {
+	Path         string   `json:"path"`
+	Capabilities []string `json:"capabilities"`
+	Effective    bool     `json:"effective"`
+}
+
+func (fc FileCapability) String() string {
+	flags := "+p"
+	if fc.Effective {
+		flags = "+ep"
+	}
+	return strings.Join(fc.Capabilities, ",") + flags
+}
+
+// capabilityNames are the capabilities in bit order, as in
+// linux/capability.h.
+var capabilityNames = []string{
+	"cap_chown", "cap_dac_override", "cap_dac_read_search", "cap_fowner",
+	"cap_fsetid", "cap_kill", "cap_setgid", "cap_setuid", "cap_setpcap",
+	"cap_linux_immutable", "cap_net_bind_service", "cap_net_broadcast",
+	"cap_net_admin", "cap_net_raw", "cap_ipc_lock", "cap_ipc_owner",
+	"cap_sys_module", "cap_sys_rawio", "cap_sys_chroot", "cap_sys_ptrace",
+	"cap_sys_pacct", "cap_sys_admin", "cap_sys_boot", "cap_sys_nice",
+	"cap_sys_resource", "cap_sys_time", "cap_sys_tty_config", "cap_mknod",
+	"cap_lease", "cap_audit_write", "cap_audit_control", "cap_setfcap",
+	"cap_mac_override", "cap_mac_admin", "cap_syslog", "cap_wake_alarm",
+	"cap_block_suspend", "cap_audit_read", "cap_perfmon", "cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+const (
+	vfsCapRevisionMask = 0xff000000
+	vfsCapRevision1    = 0x01000000
+	vfsCapRevision2    = 0x02000000
+	vfsCapRevision3    = 0x03000000
+	vfsCapEffective    = 0x000001
+)
+
+// entryCapability returns the raw security.capability xattr of an entry,
+// as stored by GNU tar (SCHILY.xattr) or libarchive (LIBARCHIVE.xattr,
+// base64 encoded).
+func entryCapability(h *tar.Header) ([]byte, bool, error) {
+	if v, ok := h.PAXRecords["SCHILY.xattr.security.capability"]; ok {
+		return []byte(v), true, nil
+	}
+	if v, ok := h.PAXRecords["LIBARCHIVE.xattr.security.capability"]; ok {
+		data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(v, "="))
+		return data, true, err
+	}
+	return nil, false, nil
+}
+
+// parseCapability decodes a struct vfs_cap_data into the names of the
+// permitted and inheritable capabilities.
+func parseCapability(data []byte) ([]string, bool, error) {
+	if len(data) < 4 {
+		return nil, false, fmt.Errorf("only %d bytes", len(data))
+	}
+	magic := binary.LittleEndian.Uint32(data)
+	words := 0
+	switch magic & vfsCapRevisionMask {
+	case vfsCapRevision1:
+		words = 1
+		if len(data) != 12 {
+			return nil, false, fmt.Errorf("revision 1 with %d bytes", len(data))
+		}
+	case vfsCapRevision2:
+		words = 2
+		if len(data) != 20 {
+			return nil, false, fmt.Errorf("revision 2 with %d bytes", len(data))
+		}
+	case vfsCapRevision3:
+		words = 2
+		if len(data) != 24 {
+			return nil, false, fmt.Errorf("revision 3 with %d bytes", len(data))
+		}
+	default:
+		return nil, false, fmt.Errorf("unknown revision 0x%08x", magic&vfsCapRevisionMask)
+	}
+
+	var caps []string
+	for i := 0; i < words; i++ {
+		permitted := binary.LittleEndian.Uint32(data[4+8*i:])
+		inheritable := binary.LittleEndian.Uint32(data[8+8*i:])
+		for bit := 0; bit < 32; bit++ {
+			if (permitted|inheritable)&(1<<bit) == 0 {
+				continue
+			}
+			n := 32*i + bit
+			if n < len(capabilityNames) {
+				caps = append(caps, capabilityNames[n])
+			} else {
+				caps = append(caps, fmt.Sprintf("cap_%d", n))
+			}
+		}
+	}
+	return caps, magic&vfsCapEffective != 0, nil
+}
+
+// payloadPath maps an archive entry to the path it installs to, or returns
+// the entry name when it lies outside the payload trees.
+func payloadPath(name string) string {
+	name = strings.TrimPrefix(name, "./")
+	top, rest, _ := strings.Cut(name, "/")
+	if top == "data" || strings.HasPrefix(top, "data-") {
+		return "/" + strings.TrimSuffix(rest, "/")
+	}
+	return name
+}
+
+// checkCapabilities collects the file capabilities in the archive and
+// reports those the policy does not allow on that path.
+func (c *Checker) checkCapabilities(headers []*tar.Header, report *ValidationResponse) {
+	for _, h := range headers {
+		data, ok, err := entryCapability(h)
+		if !ok {
+			continue
+		}
+		path := payloadPath(h.Name)
+		var caps []string
+		var effective bool
+		if err == nil {
+			caps, effective, err = parseCapability(data)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("malformed security.capability xattr on %s: %v", path, err))
+			continue
+		}
+		fc := FileCapability{Path: path, Capabilities: caps, Effective: effective}
+		report.Archive.Capabilities = append(report.Archive.Capabilities, fc)
+		c.log(fmt.Sprintf("File capabilities: %s %s", path, fc))
+
+		allowed := c.Policy.Archive.AllowedCapabilities[path]
+		var denied []string
+		for _, name := range caps {
+			if !slices.Contains(allowed, name) {
+				denied = append(denied, name)
+			}
+		}
+		if len(denied) > 0 {
+			report.Errors = append(report.Errors, fmt.Sprintf("file capabilities are not allowed by policy: %s has %s", path, strings.Join(denied, ",")))
+		}
+	}
+}
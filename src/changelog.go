@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A changelog uses the Debian format, newest entry first:
+//
+//	foo (1.0-2) stable; urgency=medium
+//
+//	  * Fix the build with GCC 14.
+//
+//	 -- Jane Doe <jane@example.org>  Mon, 01 Jul 2024 12:00:00 +0000
+var (
+	changelogHeader  = regexp.MustCompile(`^(\S+) \(([^()\s]+)\)(?:\s.*)?$`)
+	changelogTrailer = regexp.MustCompile(`^ -- (.+?)  (.+)$`)
+	changelogAuthor  = regexp.MustCompile(`^[^<>]*\S[^<>]* <[^<>@\s]+@[^<>@\s]+>$`)
+)
+
+type changelogEntry struct {
+	line    int
+	version string
+	author  string
+	date    time.Time
+}
+
+// changelogFiles returns the changelogs shipped by a package: the top-level
+// changelog member and usr/share/doc/NAME/changelog in each data tree.
+func changelogFiles(dir, name string) []string {
+	candidates := []string{filepath.Join(dir, "changelog")}
+	for _, tree := range dataTrees(dir) {
+		candidates = append(candidates, filepath.Join(dir, tree, "usr", "share", "doc", name, "changelog"))
+	}
+	var files []string
+	for _, file := range candidates {
+		if fi, err := os.Stat(file); err == nil && fi.Mode().IsRegular() {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// parseChangelog reads the entries of a changelog, failing on the first
+// line that does not fit the format.
+func parseChangelog(file string) ([]changelogEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []changelogEntry
+	var cur *changelogEntry
+	scanner := bufio.NewScanner(f)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+		case cur == nil:
+			m := changelogHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: expected an entry header 'name (version) distribution; urgency=...'", n)
+			}
+			if err := ValidateVersion(m[2], nil, nil); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			cur = &changelogEntry{line: n, version: m[2]}
+		case strings.HasPrefix(line, " -- "):
+			m := changelogTrailer.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: expected a trailer ' -- Name <email>  date'", n)
+			}
+			if !changelogAuthor.MatchString(m[1]) {
+				return nil, fmt.Errorf("line %d: maintainer '%s' is not of the form 'Name <email>'", n, m[1])
+			}
+			date, err := time.Parse(time.RFC1123Z, m[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: unparseable date '%s' (expected e.g. 'Mon, 01 Jul 2024 12:00:00 +0000')", n, m[2])
+			}
+			cur.author, cur.date = m[1], date
+			entries = append(entries, *cur)
+			cur = nil
+		case line[0] != ' ' && line[0] != '\t':
+			return nil, fmt.Errorf("line %d: entry started at line %d has no trailer", n, cur.line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if cur != nil {
+		return nil, fmt.Errorf("line %d: entry has no trailer", cur.line)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no entries")
+	}
+	return entries, nil
+}
+
+// checkChangelogs validates the changelogs a package ships: each must
+// parse, list its entries newest first, and start with the package
+// version.
+func (c *Checker) checkChangelogs(ctx context.Context, dir string, meta MetadataV2, report *ValidationResponse) {
+	for _, file := range changelogFiles(dir, meta.Name) {
+		if ctx.Err() != nil {
+			return
+		}
+		rel, _ := filepath.Rel(dir, file)
+		rel = filepath.ToSlash(rel)
+		c.log(fmt.Sprintf("Checking the changelog %s...", rel))
+		entries, err := parseChangelog(file)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("invalid changelog '%s': %v", rel, err))
+			continue
+		}
+		if entries[0].version != meta.Version {
+			report.Errors = append(report.Errors, fmt.Sprintf("newest entry in changelog '%s' is not for the package version, expected: %s, got: %s", rel, meta.Version, entries[0].version))
+		}
+		for i := 1; i < len(entries); i++ {
+			prev, cur := entries[i-1], entries[i]
+			if CompareVersions(prev.version, cur.version) <= 0 || prev.date.Before(cur.date) {
+				report.Errors = append(report.Errors, fmt.Sprintf("entries in changelog '%s' are not ordered newest first: %s (line %d) is listed before %s (line %d)", rel, prev.version, prev.line, cur.version, cur.line))
+				break
+			}
+		}
+	}
+}
@@ -5,14 +5,22 @@ package checker
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"hash/crc32"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
 func verifyHashes(dir, sumsFile, algo string, c *Checker) error {
+	return verifyHashesIn(dir, sumsFile, "data", algo, c)
+}
+
+func verifyHashesIn(dir, sumsFile, subdir, algo string, c *Checker) error {
+	defer c.track("hash")()
 	filePath := filepath.Join(dir, sumsFile)
 	data, err := os.ReadFile(filePath)
 	if err != nil {
@@ -33,21 +41,20 @@ func verifyHashes(dir, sumsFile, algo string, c *Checker) error {
 
 		relPath := parts[0]
 		expectedHash := parts[1]
-		targetFile := filepath.Join(dir, "data", relPath)
+		if !filepath.IsLocal(relPath) {
+			return fmt.Errorf("%s lists a path outside %s/: %s", sumsFile, subdir, relPath)
+		}
+		targetFile := filepath.Join(dir, subdir, relPath)
 
 		c.log(fmt.Sprintf("Checking %s for %s...", algo, relPath))
 
-		fileData, err := os.ReadFile(targetFile)
-		if err != nil {
-			return fmt.Errorf("file missing or unreadable: %s (checked at %s)", relPath, targetFile)
-		}
-
-		var actualHash string
-		if algo == "MD5" {
-			actualHash = fmt.Sprintf("%x", md5.Sum(fileData))
-		} else if algo == "CRC32" {
-			table := crc32.MakeTable(crc32.IEEE)
-			actualHash = fmt.Sprintf("%08x", crc32.Checksum(fileData, table))
+		actualHash, ok := c.entries.digest(targetFile, algo)
+		if !ok {
+			h := newHash(algo)
+			if err := hashFile(targetFile, h); err != nil {
+				return fmt.Errorf("file missing or unreadable: %s (checked at %s)", relPath, targetFile)
+			}
+			actualHash = hex.EncodeToString(h.Sum(nil))
 		}
 
 		if strings.ToLower(actualHash) != strings.ToLower(expectedHash) {
@@ -56,3 +63,29 @@ func verifyHashes(dir, sumsFile, algo string, c *Checker) error {
 	}
 	return nil
 }
+
+func generateSums(dataDir, algo string) (string, error) {
+	var b strings.Builder
+	err := filepath.WalkDir(dataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		fileData, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dataDir, path)
+		var sum string
+		switch algo {
+		case "MD5":
+			sum = fmt.Sprintf("%x", md5.Sum(fileData))
+		case "CRC32":
+			sum = fmt.Sprintf("%08x", crc32.Checksum(fileData, crc32.MakeTable(crc32.IEEE)))
+		case "SHA256":
+			sum = fmt.Sprintf("%x", sha256.Sum256(fileData))
+		}
+		fmt.Fprintf(&b, "%s %s\n", filepath.ToSlash(rel), sum)
+		return nil
+	})
+	return b.String(), err
+}
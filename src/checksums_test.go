@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyHashesRejectsPathsOutsideTree(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{outside, "../../../../../../../../" + outside, "usr/../../secret"} {
+		dir := t.TempDir()
+		os.Mkdir(filepath.Join(dir, "data"), 0755)
+		line := name + " 00000000000000000000000000000000\n"
+		if err := os.WriteFile(filepath.Join(dir, "md5sums"), []byte(line), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := verifyHashesIn(dir, "md5sums", "data", "MD5", testChecker(t))
+		if err == nil || !strings.HasPrefix(err.Error(), "md5sums lists a path outside data/: ") {
+			t.Errorf("%s: verifyHashesIn() = %v, want a path error", name, err)
+		}
+		if err != nil {
+			if rule, _ := classify(err.Error()); rule == nil || rule.Code != "APG077" {
+				t.Errorf("%s: %v is not classified as APG077", name, err)
+			}
+		}
+	}
+}
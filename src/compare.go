@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ReportComparison lists the findings a newer report adds to and drops
+// from an older one.
+type ReportComparison struct {
+	New       []ComparedFinding `json:"new"`
+	Fixed     []ComparedFinding `json:"fixed"`
+	Unchanged int               `json:"unchanged"`
+}
+
+// ComparedFinding is a finding with the package it was reported for, which
+// is empty for findings about a bundle as a whole.
+type ComparedFinding struct {
+	Package string `json:"package"`
+	Finding
+}
+
+// LoadReportFindings reads a JSON report written by apgcheck, for one
+// package or for several as by bundle and index verify, and returns its
+// findings. Reports written before findings were recorded are classified
+// from their errors and warnings.
+func LoadReportFindings(file string) ([]ComparedFinding, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var report struct {
+		ValidationResponse
+		Packages []ValidationResponse `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("report %s is not valid JSON: %w", file, err)
+	}
+
+	var findings []ComparedFinding
+	add := func(pkg string, r ValidationResponse) {
+		list := r.Findings
+		if list == nil {
+			list = findingsOf(r.Errors, r.Warnings)
+		}
+		for _, f := range list {
+			findings = append(findings, ComparedFinding{Package: pkg, Finding: f})
+		}
+	}
+	if report.Packages != nil {
+		add("", report.ValidationResponse)
+		for _, r := range report.Packages {
+			add(reportPackage(r), r)
+		}
+	} else {
+		add(reportPackage(report.ValidationResponse), report.ValidationResponse)
+	}
+	return findings, nil
+}
+
+// reportPackage names the package of a report: by metadata name, which
+// stays the same across versions, or else by file name.
+func reportPackage(r ValidationResponse) string {
+	if name, ok := r.Metadata["name"].(string); ok && name != "" {
+		return name
+	}
+	return filepath.Base(r.File)
+}
+
+// CompareFindings matches the findings of two reports by package,
+// severity and message, which also determines the rule. A finding reported more often than before counts
+// as new as many times.
+func CompareFindings(old, new []ComparedFinding) ReportComparison {
+	key := func(f ComparedFinding) string {
+		return f.Package + "\x00" + f.Severity + "\x00" + f.Message
+	}
+	remaining := map[string]int{}
+	for _, f := range old {
+		remaining[key(f)]++
+	}
+	cmp := ReportComparison{New: []ComparedFinding{}, Fixed: []ComparedFinding{}}
+	for _, f := range new {
+		if remaining[key(f)] > 0 {
+			remaining[key(f)]--
+			cmp.Unchanged++
+			continue
+		}
+		cmp.New = append(cmp.New, f)
+	}
+	for _, f := range old {
+		if remaining[key(f)] > 0 {
+			remaining[key(f)]--
+			cmp.Fixed = append(cmp.Fixed, f)
+		}
+	}
+	return cmp
+}
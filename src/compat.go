@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"fmt"
+	"strings"
+)
+
+type CompatReport struct {
+	File     string     `json:"file"`
+	Format   string     `json:"format"`
+	Metadata MetadataV2 `json:"metadata"`
+	Missing  []string   `json:"missing"`
+	Notes    []string   `json:"notes"`
+}
+
+// CompatReport describes the APG v2 metadata a .deb or .rpm package would
+// translate to and which required fields cannot be derived from it.
+func (c *Checker) CompatReport(path string) (*CompatReport, error) {
+	c.log(fmt.Sprintf("Reading %s...", path))
+	pkg, err := readForeignPackage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CompatReport{
+		File:     path,
+		Format:   pkg.Format,
+		Metadata: pkg.apgMetadata(),
+		Notes:    pkg.Notes,
+	}
+	if report.Notes == nil {
+		report.Notes = []string{}
+	}
+	if pkg.Arch != "" && archAliases[pkg.Arch] == "" {
+		report.Notes = append(report.Notes, fmt.Sprintf("unknown architecture '%s' kept as is", pkg.Arch))
+	}
+	report.Missing = missingV2Fields(report.Metadata)
+	return report, nil
+}
+
+func (pkg *foreignPackage) apgMetadata() MetadataV2 {
+	meta := MetadataV2{
+		Name:         pkg.Name,
+		Version:      pkg.Version,
+		Description:  pkg.Summary,
+		Maintainer:   pkg.Maintainer,
+		Homepage:     pkg.Homepage,
+		Tags:         []string{},
+		Dependencies: pkg.Depends,
+		Conflicts:    pkg.Conflicts,
+		Provides:     pkg.Provides,
+		Replaces:     pkg.Replaces,
+		Conf:         pkg.Conffiles,
+	}
+	if meta.Conf == nil {
+		meta.Conf = []string{}
+	}
+	if pkg.Description != "" {
+		meta.Description = strings.TrimSpace(pkg.Summary + "\n\n" + pkg.Description)
+	}
+	if pkg.Arch != "" {
+		arch := pkg.Arch
+		if alias, ok := archAliases[arch]; ok {
+			arch = alias
+		}
+		meta.Architecture = &arch
+	}
+	if pkg.License != "" {
+		license := pkg.License
+		meta.License = &license
+	}
+	if pkg.Section != "" && pkg.Section != "Unspecified" {
+		meta.Tags = []string{strings.ToLower(pkg.Section)}
+	}
+	return meta
+}
+
+func missingV2Fields(meta MetadataV2) []string {
+	missing := []string{}
+	if meta.Name == "" {
+		missing = append(missing, "name")
+	}
+	if meta.Version == "" {
+		missing = append(missing, "version")
+	}
+	if meta.Type == "" {
+		missing = append(missing, "type")
+	}
+	if meta.Architecture == nil {
+		missing = append(missing, "architecture")
+	}
+	if meta.Description == "" {
+		missing = append(missing, "description")
+	}
+	if meta.Maintainer == "" {
+		missing = append(missing, "maintainer")
+	}
+	if meta.License == nil {
+		missing = append(missing, "license")
+	}
+	if meta.Homepage == "" {
+		missing = append(missing, "homepage")
+	}
+	if len(meta.Tags) == 0 {
+		missing = append(missing, "tags")
+	}
+	return missing
+}
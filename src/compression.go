@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"strings"
+)
+
+// CompressionInfo describes how the archive is compressed, as read from
+// the xz stream and block headers.
+type CompressionInfo struct {
+	Format         string   `json:"format"`
+	Check          string   `json:"check"`
+	Filters        []string `json:"filters"`
+	DictionarySize int64    `json:"dictionary_size"`
+	// Preset is the xz preset that uses this dictionary size, such as
+	// "5-6"; the level itself is not recorded in the file.
+	Preset string `json:"preset,omitempty"`
+	// Blocks is 0 when the stream index could not be read.
+	Blocks       int   `json:"blocks"`
+	LargestBlock int64 `json:"largest_block,omitempty"`
+}
+
+// CompressionPolicy sets the repository standard for xz settings and how
+// archives that deviate from it are reported ("error", "warn" or
+// "ignore"). A zero size disables the corresponding check.
+type CompressionPolicy struct {
+	Action          string `json:"action"`
+	MaxDictionaryMB int64  `json:"max_dictionary_mb"`
+	MinDictionaryMB int64  `json:"min_dictionary_mb"`
+	MinBlockMB      int64  `json:"min_block_mb"`
+}
+
+var xzCheckNames = map[byte]string{0x00: "none", 0x01: "crc32", 0x04: "crc64", 0x0a: "sha256"}
+
+var xzFilterNames = map[uint64]string{
+	0x03: "delta", 0x04: "x86", 0x05: "powerpc", 0x06: "ia64", 0x07: "arm",
+	0x08: "armthumb", 0x09: "sparc", 0x0a: "arm64", 0x0b: "riscv", 0x21: "lzma2",
+}
+
+// xzPresets lists the dictionary size of each group of xz presets.
+var xzPresets = []struct {
+	dict   int64
+	preset string
+}{
+	{256 << 10, "0"}, {1 << 20, "1"}, {2 << 20, "2"}, {4 << 20, "3-4"},
+	{8 << 20, "5-6"}, {16 << 20, "7"}, {32 << 20, "8"}, {64 << 20, "9"},
+}
+
+// analyzeCompression reads the compression settings of an xz file from its
+// stream header and first block header, and the block layout from the
+// stream indexes. It returns nil for files that are not xz.
+func analyzeCompression(file string) (*CompressionInfo, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 13)
+	if _, err := f.ReadAt(header, 0); err != nil || string(header[:6]) != "\xfd7zXZ\x00" {
+		return nil, nil
+	}
+	info := &CompressionInfo{Format: "xz", Check: xzCheckNames[header[7]&0x0f]}
+	if info.Check == "" {
+		info.Check = fmt.Sprintf("unknown (0x%02x)", header[7]&0x0f)
+	}
+
+	if header[12] == 0 {
+		return info, nil
+	}
+	block := make([]byte, (int(header[12])+1)*4)
+	if _, err := f.ReadAt(block, 12); err != nil {
+		return nil, fmt.Errorf("truncated xz block header")
+	}
+	if crc32.ChecksumIEEE(block[:len(block)-4]) != binary.LittleEndian.Uint32(block[len(block)-4:]) {
+		return nil, fmt.Errorf("corrupt xz block header")
+	}
+	br := bytes.NewReader(block[2 : len(block)-4])
+	if block[1]&0x40 != 0 {
+		binary.ReadUvarint(br)
+	}
+	if block[1]&0x80 != 0 {
+		binary.ReadUvarint(br)
+	}
+	for i := 0; i <= int(block[1]&0x03); i++ {
+		id, err1 := binary.ReadUvarint(br)
+		size, err2 := binary.ReadUvarint(br)
+		if err1 != nil || err2 != nil || size > uint64(br.Len()) {
+			return nil, fmt.Errorf("corrupt xz block header")
+		}
+		props := make([]byte, size)
+		br.Read(props)
+		name := xzFilterNames[id]
+		if name == "" {
+			name = fmt.Sprintf("0x%x", id)
+		}
+		info.Filters = append(info.Filters, name)
+		if id == 0x21 && size == 1 && props[0] < 40 {
+			info.DictionarySize = int64(2|props[0]&1) << (props[0]/2 + 11)
+		}
+	}
+	for _, p := range xzPresets {
+		if p.dict == info.DictionarySize {
+			info.Preset = p.preset
+		}
+	}
+
+	if blocks, err := planXZBlocks(f); err == nil {
+		info.Blocks = len(blocks)
+		for _, b := range blocks {
+			info.LargestBlock = max(info.LargestBlock, b.uncompressed)
+		}
+	}
+	return info, nil
+}
+
+// checkCompression records the compression settings and compares them
+// with the repository standard: dictionaries over the maximum need that
+// much memory to decompress on every device, dictionaries under the
+// minimum and small blocks cost compression ratio, and a missing check
+// leaves corruption in transit undetected until the checksums are read.
+func (c *Checker) checkCompression(apgFile string, report *ValidationResponse) {
+	info, err := analyzeCompression(apgFile)
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("compression settings could not be read: %v", err))
+		return
+	}
+	if info == nil {
+		if f, err := os.Open(apgFile); err == nil {
+			if isTar(f) {
+				report.Archive.Compression = &CompressionInfo{Format: "none"}
+				report.Warnings = append(report.Warnings, "archive is an uncompressed tar; compress it with 'xz -6 -T0 --check=crc64' before publishing")
+			}
+			f.Close()
+		}
+		return
+	}
+	report.Archive.Compression = info
+	c.log(fmt.Sprintf("Compression: %s, filters %s, dictionary %s, %d blocks, check %s", info.Format, strings.Join(info.Filters, "+"), formatMiB(info.DictionarySize), info.Blocks, info.Check))
+
+	p := c.Policy.Compression
+	var problems []string
+	if p.MaxDictionaryMB > 0 && info.DictionarySize > p.MaxDictionaryMB<<20 {
+		problems = append(problems, fmt.Sprintf("the %s dictionary needs as much memory to decompress, over the %d MiB standard", formatMiB(info.DictionarySize), p.MaxDictionaryMB))
+	}
+	if p.MinDictionaryMB > 0 && info.DictionarySize > 0 && info.DictionarySize < p.MinDictionaryMB<<20 && report.Archive.InstalledSize > info.DictionarySize {
+		problems = append(problems, fmt.Sprintf("the %s dictionary is under the %d MiB standard and makes the package larger to download", formatMiB(info.DictionarySize), p.MinDictionaryMB))
+	}
+	if p.MinBlockMB > 0 && info.Blocks > 1 && info.LargestBlock < p.MinBlockMB<<20 {
+		problems = append(problems, fmt.Sprintf("%d blocks of at most %s each compress worse than blocks of %d MiB or more", info.Blocks, formatMiB(info.LargestBlock), p.MinBlockMB))
+	}
+	if info.Check == "none" {
+		problems = append(problems, "the stream has no integrity check")
+	}
+	for _, problem := range problems {
+		c.reportAs(p.Action, "compression settings: "+problem+recommendedXZ(p), report)
+	}
+}
+
+// recommendedXZ suggests the xz command line that meets the standard: the
+// default preset 6, or the highest preset within the dictionary maximum.
+func recommendedXZ(p CompressionPolicy) string {
+	preset := ""
+	for _, x := range xzPresets[:5] {
+		if p.MaxDictionaryMB <= 0 || x.dict <= p.MaxDictionaryMB<<20 {
+			preset = x.preset[len(x.preset)-1:]
+		}
+	}
+	if preset == "" {
+		return ""
+	}
+	return fmt.Sprintf("; recompress with 'xz -%s -T0 --check=crc64'", preset)
+}
+
+func formatMiB(size int64) string {
+	if size < 1<<20 {
+		return fmt.Sprintf("%d KiB", size>>10)
+	}
+	return fmt.Sprintf("%d MiB", size>>20)
+}
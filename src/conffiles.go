@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+func underPrefix(file string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if file == prefix || strings.HasPrefix(file, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConfFiles checks the v2 conf list against the installed files:
+// every entry must be a file, or a directory of files, the package installs
+// under a configuration directory, and files installed there should be
+// listed, or they are overwritten on upgrade instead of preserved. files
+// are the installed files as the entry index recorded them, so nothing is
+// looked up on disk.
+func (c *Checker) checkConfFiles(meta MetadataV2, files []string, report *ValidationResponse) {
+	prefixes := c.Policy.Packaging.ConfigPrefixes
+	for _, conf := range meta.Conf {
+		if !underPrefix(path.Clean(conf), prefixes) {
+			report.Errors = append(report.Errors, fmt.Sprintf("conf entry is outside the configuration directories (%s): %s", strings.Join(prefixes, ", "), conf))
+		} else if !slices.ContainsFunc(files, func(f string) bool { return underPrefix(f, []string{path.Clean(conf)}) }) {
+			report.Errors = append(report.Errors, fmt.Sprintf("conf entry is not installed by the package: %s", conf))
+		}
+	}
+	for _, file := range files {
+		if underPrefix(file, prefixes) && !underPrefix(file, meta.Conf) {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("configuration file is not listed in conf: %s", file))
+		}
+	}
+}
+
+// configTextProblem describes what makes a configuration file hard on
+// naive parsers, or returns "".
+func configTextProblem(data []byte) string {
+	switch {
+	case len(data) == 0:
+		return ""
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")) || bytes.HasPrefix(data, []byte("\xff\xfe")) || bytes.HasPrefix(data, []byte("\xfe\xff")):
+		return "starts with a byte order mark"
+	case bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data):
+		return "contains binary data"
+	case data[len(data)-1] != '\n':
+		return "does not end with a newline"
+	}
+	return ""
+}
+
+// checkConfigText reports files under /etc that are not plain text ending
+// in a newline.
+func (c *Checker) checkConfigText(ctx context.Context, dir string, report *ValidationResponse) {
+	payloadFiles(ctx, dir, func(installed, file string) {
+		if !underPrefix(installed, []string{"/etc"}) {
+			return
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return
+		}
+		if problem := configTextProblem(data); problem != "" {
+			c.reportAs(c.Policy.Packaging.ConfigText, fmt.Sprintf("configuration file is not clean text: %s %s", installed, problem), report)
+		}
+	})
+}
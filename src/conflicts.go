@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+type PackageFiles struct {
+	Name      string
+	Conflicts []string
+	Replaces  []string
+	Files     []string
+}
+
+type FileConflict struct {
+	Path     string   `json:"path"`
+	Packages []string `json:"packages"`
+}
+
+func NewPackageFiles(meta map[string]interface{}, files []string) PackageFiles {
+	m := MetadataFromMap(meta)
+	return PackageFiles{
+		Name:      m.Name,
+		Conflicts: m.Conflicts,
+		Replaces:  m.Replaces,
+		Files:     files,
+	}
+}
+
+func DetectFileConflicts(pkgs []PackageFiles) []FileConflict {
+	owners := map[string][]int{}
+	for i, p := range pkgs {
+		for _, f := range p.Files {
+			owners[f] = append(owners[f], i)
+		}
+	}
+
+	var conflicts []FileConflict
+	for path, idx := range owners {
+		if len(idx) < 2 {
+			continue
+		}
+		clashing := map[string]bool{}
+		for a := 0; a < len(idx); a++ {
+			for b := a + 1; b < len(idx); b++ {
+				pa, pb := pkgs[idx[a]], pkgs[idx[b]]
+				// Versions or architectures of one package are never
+				// installed together.
+				if pa.Name == pb.Name || declaresRelation(pa, pb.Name) || declaresRelation(pb, pa.Name) {
+					continue
+				}
+				clashing[pa.Name] = true
+				clashing[pb.Name] = true
+			}
+		}
+		if len(clashing) == 0 {
+			continue
+		}
+		var names []string
+		for n := range clashing {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		conflicts = append(conflicts, FileConflict{Path: path, Packages: names})
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return conflicts
+}
+
+func declaresRelation(p PackageFiles, name string) bool {
+	for _, rel := range append(append([]string{}, p.Conflicts...), p.Replaces...) {
+		if r, err := ParseRelation(rel); err == nil && r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func MetadataFromMap(meta map[string]interface{}) MetadataV2 {
+	var m MetadataV2
+	data, _ := json.Marshal(meta)
+	json.Unmarshal(data, &m)
+	m.Version = FullVersion(m.Version, m.Epoch, m.Release)
+	return m
+}
@@ -0,0 +1,22 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectFileConflicts(t *testing.T) {
+	pkgs := []PackageFiles{
+		{Name: "foo", Files: []string{"/usr/bin/foo", "/usr/share/doc/shared"}},
+		{Name: "foo", Files: []string{"/usr/bin/foo", "/usr/share/doc/shared"}},
+		{Name: "bar", Files: []string{"/usr/share/doc/shared", "/usr/bin/bar"}},
+		{Name: "bar-ng", Replaces: []string{"bar"}, Files: []string{"/usr/bin/bar"}},
+	}
+	want := []FileConflict{{Path: "/usr/share/doc/shared", Packages: []string{"bar", "foo"}}}
+	if got := DetectFileConflicts(pkgs); !reflect.DeepEqual(got, want) {
+		t.Errorf("DetectFileConflicts() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"debug/elf"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// imageExtensions maps file extensions to the image format files named
+// after them must have.
+var imageExtensions = map[string]string{
+	".png":  "PNG",
+	".jpg":  "JPEG",
+	".jpeg": "JPEG",
+	".gif":  "GIF",
+	".webp": "WebP",
+	".svg":  "SVG",
+	".svgz": "SVGZ",
+	".ico":  "ICO",
+	".xpm":  "XPM",
+}
+
+// scriptExtensions are extensions of text scripts.
+var scriptExtensions = []string{".sh", ".bash", ".py", ".pl", ".rb", ".lua", ".tcl"}
+
+// dataOnlyDirs hold configuration and architecture-independent data, never
+// machine code.
+var dataOnlyDirs = []string{"/etc/", "/usr/share/"}
+
+// contentMismatch describes how a file's content contradicts its path, or
+// returns "".
+func contentMismatch(installed string, head []byte) string {
+	isELF := bytes.HasPrefix(head, []byte(elf.ELFMAG))
+	if isELF {
+		for _, prefix := range dataOnlyDirs {
+			if strings.HasPrefix(installed, prefix) {
+				return "ELF binary in " + strings.TrimSuffix(prefix, "/")
+			}
+		}
+	}
+	ext := strings.ToLower(path.Ext(installed))
+	if want, ok := imageExtensions[ext]; ok {
+		if got := imageFormat(head); got != want {
+			return fmt.Sprintf("%s file is not a %s image", ext, want)
+		}
+		return ""
+	}
+	script := bytes.HasPrefix(head, []byte("#!"))
+	for _, e := range scriptExtensions {
+		script = script || ext == e
+	}
+	if script && (isELF || bytes.IndexByte(head, 0) >= 0) {
+		return "script with binary content"
+	}
+	return ""
+}
+
+// checkContentTypes reports files whose content does not fit their path,
+// such as machine code among configuration files or images that are not
+// images, which suggests a packaging mistake or smuggled content.
+func (c *Checker) checkContentTypes(ctx context.Context, dir string, report *ValidationResponse) {
+	payloadFiles(ctx, dir, func(installed, file string) {
+		if problem := contentMismatch(installed, fileHead(file, 4096)); problem != "" {
+			c.reportAs(c.Policy.Packaging.ContentTypes, fmt.Sprintf("content does not match the path: %s: %s", installed, problem), report)
+		}
+	})
+}
+
+// runtimeDirs are filled at run time by the system; anything a package
+// ships there was captured from the build machine by a broken install step.
+var runtimeDirs = []string{"/run", "/var/run", "/proc", "/sys"}
+
+// checkRuntimePaths reports entries other than directories installed below
+// the runtime directories.
+func (c *Checker) checkRuntimePaths(headers []*tar.Header, report *ValidationResponse) {
+	for _, h := range headers {
+		p := payloadPath(h.Name)
+		if h.Typeflag == tar.TypeDir || !strings.HasPrefix(p, "/") {
+			continue
+		}
+		for _, d := range runtimeDirs {
+			if strings.HasPrefix(p, d+"/") {
+				c.reportAs(c.Policy.Packaging.RuntimePaths, fmt.Sprintf("file in a runtime directory: %s (%s is populated at run time)", p, d), report)
+				break
+			}
+		}
+	}
+}
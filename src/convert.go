@@ -0,0 +1,390 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const todoMarker = "TODO"
+
+type ConvertResult struct {
+	OutDir string   `json:"out_dir"`
+	Files  int      `json:"files"`
+	TODO   []string `json:"todo"`
+	Notes  []string `json:"notes"`
+}
+
+// payloadWriter extracts a foreign payload below root. Links are only
+// created once all regular files are written, and no path is created
+// through a symlink, so no write can be redirected through a link that
+// came from the package itself.
+type payloadWriter struct {
+	root      string
+	budget    entryBudget
+	files     int
+	hardlinks [][2]string
+	symlinks  [][2]string
+	// headers are the tar headers read, in archive order.
+	headers []*tar.Header
+}
+
+func (w *payloadWriter) target(name string) (string, bool) {
+	clean := filepath.Clean("/" + name)
+	if clean == "/" {
+		return "", false
+	}
+	return filepath.Join(w.root, clean), true
+}
+
+func (w *payloadWriter) dir(name string) error {
+	if target, ok := w.target(name); ok {
+		return w.mkdirAll(target)
+	}
+	return nil
+}
+
+// mkdirAll creates dir and its parents below root like os.MkdirAll, but
+// fails instead of following a symlink, so a link from an earlier entry
+// cannot lead a later one out of root.
+func (w *payloadWriter) mkdirAll(dir string) error {
+	rel, err := filepath.Rel(w.root, dir)
+	if err != nil || rel != "." && !filepath.IsLocal(rel) {
+		return fmt.Errorf("entry path leaves the package: %s", dir)
+	}
+	if err := os.MkdirAll(w.root, 0755); err != nil {
+		return err
+	}
+	path := w.root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		path = filepath.Join(path, part)
+		fi, err := os.Lstat(path)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(path, 0755); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case fi.Mode()&os.ModeSymlink != 0:
+			return fmt.Errorf("entry path leaves the package through a symlink: %s", filepath.ToSlash(rel))
+		case !fi.IsDir():
+			return fmt.Errorf("entry path is below a file: %s", filepath.ToSlash(rel))
+		}
+	}
+	return nil
+}
+
+func (w *payloadWriter) file(name string, mode os.FileMode, r io.Reader) error {
+	target, ok := w.target(name)
+	if !ok {
+		return nil
+	}
+	if err := w.mkdirAll(filepath.Dir(target)); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	_, err = io.Copy(w.budget.writer(out), r)
+	out.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Chmod(target, mode.Perm()); err != nil {
+		return err
+	}
+	w.files++
+	return nil
+}
+
+func (w *payloadWriter) symlink(name, linkTarget string) {
+	if target, ok := w.target(name); ok {
+		w.symlinks = append(w.symlinks, [2]string{linkTarget, target})
+	}
+}
+
+// hardlink links name to a regular file of the payload, once it is
+// written.
+func (w *payloadWriter) hardlink(name, linkTarget string) {
+	target, ok := w.target(name)
+	source, ok2 := w.target(linkTarget)
+	if ok && ok2 {
+		w.hardlinks = append(w.hardlinks, [2]string{source, target})
+	}
+}
+
+func (w *payloadWriter) finish() error {
+	for _, l := range w.hardlinks {
+		if fi, err := os.Lstat(l[0]); err != nil || !fi.Mode().IsRegular() {
+			name, _ := filepath.Rel(w.root, l[1])
+			linkTarget, _ := filepath.Rel(w.root, l[0])
+			return fmt.Errorf("hardlink target is not a regular file earlier in the archive: %s -> %s", name, linkTarget)
+		}
+		if err := w.mkdirAll(filepath.Dir(l[1])); err != nil {
+			return err
+		}
+		if err := os.Link(l[0], l[1]); err != nil {
+			return fmt.Errorf("failed to create hardlink: %w", err)
+		}
+		w.files++
+	}
+	for _, l := range w.symlinks {
+		if err := w.mkdirAll(filepath.Dir(l[1])); err != nil {
+			return err
+		}
+		// A path already there is a directory holding later entries or
+		// a duplicate, and a symlink over it would redirect them.
+		if _, err := os.Lstat(l[1]); err == nil {
+			name, _ := filepath.Rel(w.root, l[1])
+			return fmt.Errorf("entry path leaves the package through a symlink: %s", filepath.ToSlash(name))
+		}
+		if err := os.Symlink(l[0], l[1]); err != nil {
+			return fmt.Errorf("failed to create symlink: %w", err)
+		}
+		w.files++
+	}
+	return nil
+}
+
+func (w *payloadWriter) extractTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return w.finish()
+		}
+		if err != nil {
+			return fmt.Errorf("error during reading payload: %w", err)
+		}
+		if err := w.budget.account(h.Name, h.Size); err != nil {
+			return err
+		}
+		w.headers = append(w.headers, h)
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = w.dir(h.Name)
+		case tar.TypeReg, tar.TypeGNUSparse:
+			err = w.file(h.Name, h.FileInfo().Mode(), tr)
+		case tar.TypeLink:
+			w.hardlink(h.Name, h.Linkname)
+		case tar.TypeSymlink:
+			w.symlink(h.Name, h.Linkname)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (w *payloadWriter) extractCpio(r io.Reader) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, 110)
+	var offset int64
+	align := func() error {
+		if rem := offset % 4; rem != 0 {
+			if _, err := br.Discard(int(4 - rem)); err != nil {
+				return err
+			}
+			offset += 4 - rem
+		}
+		return nil
+	}
+
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			return fmt.Errorf("truncated cpio header: %w", err)
+		}
+		offset += 110
+		magic := string(header[:6])
+		if magic != "070701" && magic != "070702" {
+			return fmt.Errorf("unsupported cpio format %q", magic)
+		}
+		field := func(i int) int64 {
+			v, _ := strconv.ParseInt(string(header[6+8*i:14+8*i]), 16, 64)
+			return v
+		}
+		mode, size, nameSize := field(1), field(6), field(11)
+
+		name := make([]byte, nameSize)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return fmt.Errorf("truncated cpio name: %w", err)
+		}
+		offset += nameSize
+		if err := align(); err != nil {
+			return err
+		}
+		entry := strings.TrimRight(string(name), "\x00")
+		if entry == "TRAILER!!!" {
+			return w.finish()
+		}
+
+		if err := w.budget.account(entry, size); err != nil {
+			return err
+		}
+		data := io.LimitReader(br, size)
+		var err error
+		switch mode & 0170000 {
+		case 0040000:
+			err = w.dir(entry)
+		case 0100000:
+			err = w.file(entry, os.FileMode(mode&0777), data)
+		case 0120000:
+			link, _ := io.ReadAll(data)
+			w.symlink(entry, string(link))
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, data); err != nil {
+			return err
+		}
+		offset += size
+		if err := align(); err != nil {
+			return err
+		}
+	}
+}
+
+// Convert writes an APG v2 package skeleton for a .deb or .rpm to outDir:
+// metadata.json with TODO markers where human input is needed, the data/
+// tree and fresh checksum manifests.
+func (c *Checker) Convert(path, outDir string) (*ConvertResult, error) {
+	if entries, err := os.ReadDir(outDir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("output directory is not empty: %s", outDir)
+	}
+
+	pkg, err := readForeignPackage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &payloadWriter{root: filepath.Join(outDir, "data"), budget: entryBudget{limits: c.Policy.Limits}}
+	if err := os.MkdirAll(w.root, 0755); err != nil {
+		return nil, err
+	}
+	c.log("Extracting the payload...")
+	if err := extractForeignPayload(path, pkg.Format, w); err != nil {
+		return nil, err
+	}
+
+	meta := pkg.apgMetadata()
+	result := &ConvertResult{OutDir: outDir, Files: w.files, TODO: missingV2Fields(meta), Notes: pkg.Notes}
+	if result.Notes == nil {
+		result.Notes = []string{}
+	}
+	fillTODO(&meta, result.TODO)
+
+	c.log("Writing metadata.json and checksum manifests...")
+	data, _ := json.MarshalIndent(meta, "", "  ")
+	if err := os.WriteFile(filepath.Join(outDir, "metadata.json"), append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	for file, algo := range map[string]string{"md5sums": "MD5", "crc32sums": "CRC32"} {
+		sums, err := generateSums(w.root, algo)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(outDir, file), []byte(sums), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func extractForeignPayload(path, format string, w *payloadWriter) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open package: %w", err)
+	}
+	defer f.Close()
+
+	if format == "deb" {
+		return extractDebPayload(f, w)
+	}
+	_, h, err := readRPMHeader(f)
+	if err != nil {
+		return err
+	}
+
+	var payload io.Reader
+	switch compressor := h.str(rpmTagPayloadCompress); compressor {
+	case "", "gzip":
+		payload, err = gzip.NewReader(f)
+	case "xz":
+		payload, err = xz.NewReader(f)
+	case "lzma":
+		payload, err = lzma.NewReader(f)
+	default:
+		return fmt.Errorf("unsupported rpm payload compression: %s", compressor)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot decompress rpm payload: %w", err)
+	}
+	return w.extractCpio(payload)
+}
+
+func extractDebPayload(r io.Reader, w *payloadWriter) error {
+	found := false
+	err := arMembers(r, func(name string, data io.Reader) error {
+		if !strings.HasPrefix(name, "data.tar") {
+			return nil
+		}
+		found = true
+		dr, err := decompressMember(name, data)
+		if err != nil {
+			return err
+		}
+		if err := w.extractTar(dr); err != nil {
+			return err
+		}
+		return io.EOF
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("data archive not found in .deb")
+	}
+	return err
+}
+
+func fillTODO(meta *MetadataV2, missing []string) {
+	for _, field := range missing {
+		todo := todoMarker
+		switch field {
+		case "name":
+			meta.Name = todo
+		case "version":
+			meta.Version = todo
+		case "type":
+			meta.Type = todo
+		case "architecture":
+			meta.Architecture = &todo
+		case "description":
+			meta.Description = todo
+		case "maintainer":
+			meta.Maintainer = todo
+		case "license":
+			meta.License = &todo
+		case "homepage":
+			meta.Homepage = todo
+		case "tags":
+			meta.Tags = []string{todo}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPayloadWriterConfinesLinks(t *testing.T) {
+	victim := t.TempDir()
+	tests := []struct {
+		name    string
+		entries []testEntry
+	}{
+		{"symlink chain", []testEntry{
+			{name: "usr/a", link: victim},
+			{name: "usr/a/planted", link: "/etc/shadow"},
+		}},
+		{"file below a symlink", []testEntry{
+			{name: "usr/a", link: victim},
+			{name: "usr/a/planted", body: "x"},
+		}},
+		{"hardlink below a symlink", []testEntry{
+			{name: "usr/file", body: "x"},
+			{name: "usr/a", link: victim},
+			{name: "usr/a/planted", link: "usr/file", typ: '1'},
+		}},
+		{"relative symlink chain", []testEntry{
+			{name: "usr/a", link: "../.."},
+			{name: "usr/a/b", link: victim},
+			{name: "usr/b/planted", link: "/etc/shadow"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &payloadWriter{root: t.TempDir(), budget: entryBudget{limits: DefaultPolicy().Limits}}
+			err := w.extractTar(bytes.NewReader(tarBytes(t, tt.entries...)))
+			if err == nil || !strings.Contains(err.Error(), "leaves the package") {
+				t.Errorf("extractTar() = %v, want an escape error", err)
+			}
+			assertEmpty(t, victim)
+		})
+	}
+}
+
+func TestPayloadWriterKeepsLinks(t *testing.T) {
+	root := t.TempDir()
+	w := &payloadWriter{root: root, budget: entryBudget{limits: DefaultPolicy().Limits}}
+	err := w.extractTar(bytes.NewReader(tarBytes(t,
+		testEntry{name: "usr/bin/tool", body: "x", mode: 0755},
+		testEntry{name: "usr/bin/alias", link: "usr/bin/tool", typ: '1'},
+		testEntry{name: "usr/bin/link", link: "tool"},
+		testEntry{name: "usr/lib/abs", link: "/usr/bin/tool"},
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(root, "usr/bin/link")); err != nil || target != "tool" {
+		t.Errorf("usr/bin/link -> %q, %v", target, err)
+	}
+	a, _ := os.Stat(filepath.Join(root, "usr/bin/tool"))
+	b, _ := os.Stat(filepath.Join(root, "usr/bin/alias"))
+	if a == nil || b == nil || !os.SameFile(a, b) {
+		t.Error("usr/bin/alias is not a hard link to usr/bin/tool")
+	}
+	if w.files != 4 {
+		t.Errorf("files = %d, want 4", w.files)
+	}
+}
@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+type DeltaMetadata struct {
+	Name        string   `json:"name"`
+	FromVersion string   `json:"from_version"`
+	ToVersion   string   `json:"to_version"`
+	FromSHA256  string   `json:"from_sha256"`
+	ToSHA256    string   `json:"to_sha256"`
+	Removed     []string `json:"removed"`
+}
+
+var sha256Re = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ValidateDelta checks a .apgdelta archive. When base is set the delta must
+// apply to it; when target is also set, applying the delta to base must
+// reproduce the data tree of target exactly.
+func (c *Checker) ValidateDelta(deltaFile, base, target string) (ValidationResponse, error) {
+	report := ValidationResponse{
+		Version:  1,
+		File:     deltaFile,
+		Errors:   []string{},
+		Warnings: []string{},
+	}
+
+	deltaDir, _, err := c.extractTemp(deltaFile)
+	defer os.RemoveAll(deltaDir)
+	if err != nil {
+		return report, err
+	}
+
+	delta, err := c.checkDeltaStructure(deltaDir)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		report.annotate()
+		return report, nil
+	}
+
+	if base != "" {
+		baseDir, _, err := c.extractTemp(base)
+		defer os.RemoveAll(baseDir)
+		if err != nil {
+			return report, fmt.Errorf("base package: %w", err)
+		}
+		c.log("Checking delta applicability...")
+		report.Errors = append(report.Errors, checkDeltaSide(base, baseDir, delta.Name, delta.FromVersion, delta.FromSHA256, "base")...)
+		for _, p := range delta.Removed {
+			// A removed path outside the data tree is in no package.
+			target, ok := withinDir(filepath.Join(baseDir, "data"), p)
+			if _, err := os.Lstat(target); !ok || err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("removed path not present in base package: %s", p))
+			}
+		}
+
+		if target != "" && len(report.Errors) == 0 {
+			targetDir, _, err := c.extractTemp(target)
+			defer os.RemoveAll(targetDir)
+			if err != nil {
+				return report, fmt.Errorf("target package: %w", err)
+			}
+			c.log("Verifying reconstruction against the target package...")
+			report.Errors = append(report.Errors, checkDeltaSide(target, targetDir, delta.Name, delta.ToVersion, delta.ToSHA256, "target")...)
+			report.Errors = append(report.Errors, verifyReconstruction(baseDir, deltaDir, targetDir, delta.Removed)...)
+		}
+	} else if target != "" {
+		report.Errors = append(report.Errors, "reconstruction verification requires a base package")
+	}
+
+	report.Valid = len(report.Errors) == 0
+	if report.Valid {
+		data, _ := os.ReadFile(filepath.Join(deltaDir, "delta.json"))
+		json.Unmarshal(data, &report.Metadata)
+	}
+	report.annotate()
+	return report, nil
+}
+
+func (c *Checker) checkDeltaStructure(dir string) (*DeltaMetadata, error) {
+	c.log("Checking the delta structure...")
+	for _, name := range []string{"data", "md5sums", "delta.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			return nil, fmt.Errorf("required file or directory missing: '%s'", name)
+		}
+	}
+
+	if !c.SkipChecksums {
+		c.log("Verifying MD5 checksums...")
+		if err := verifyHashes(dir, "md5sums", "MD5", c); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "delta.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delta metadata: %w", err)
+	}
+	var delta DeltaMetadata
+	if err := json.Unmarshal(data, &delta); err != nil {
+		return nil, fmt.Errorf("delta metadata invalid JSON: %w", err)
+	}
+
+	var missingFields []string
+	if delta.Name == "" {
+		missingFields = append(missingFields, "name")
+	}
+	if delta.FromVersion == "" {
+		missingFields = append(missingFields, "from_version")
+	}
+	if delta.ToVersion == "" {
+		missingFields = append(missingFields, "to_version")
+	}
+	if delta.Removed == nil {
+		missingFields = append(missingFields, "removed")
+	}
+	if len(missingFields) > 0 {
+		return nil, fmt.Errorf("missing or empty required delta fields: %v", missingFields)
+	}
+	if !sha256Re.MatchString(delta.FromSHA256) {
+		return nil, fmt.Errorf("invalid from_sha256: '%s'", delta.FromSHA256)
+	}
+	if !sha256Re.MatchString(delta.ToSHA256) {
+		return nil, fmt.Errorf("invalid to_sha256: '%s'", delta.ToSHA256)
+	}
+	if CompareVersions(delta.FromVersion, delta.ToVersion) >= 0 {
+		return nil, fmt.Errorf("delta does not upgrade: from_version %s is not lower than to_version %s", delta.FromVersion, delta.ToVersion)
+	}
+	return &delta, nil
+}
+
+func checkDeltaSide(path, dir, name, version, digest, side string) []string {
+	var errs []string
+	actual, _, err := fileSHA256(path)
+	if err != nil {
+		return []string{fmt.Sprintf("cannot read %s package: %v", side, err)}
+	}
+	if actual != digest {
+		errs = append(errs, fmt.Sprintf("%s package SHA256 mismatch, expected: %s, got: %s", side, digest, actual))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		return append(errs, fmt.Sprintf("failed to read %s package metadata: %v", side, err))
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return append(errs, fmt.Sprintf("%s package metadata invalid JSON: %v", side, err))
+	}
+	meta := MetadataFromMap(raw)
+	if meta.Name != name || meta.Version != version {
+		errs = append(errs, fmt.Sprintf("%s package is %s %s, delta expects %s %s", side, meta.Name, meta.Version, name, version))
+	}
+	return errs
+}
+
+func verifyReconstruction(baseDir, deltaDir, targetDir string, removed []string) []string {
+	tree, err := dataDigests(filepath.Join(baseDir, "data"))
+	if err != nil {
+		return []string{fmt.Sprintf("failed to read base data: %v", err)}
+	}
+	for _, p := range removed {
+		delete(tree, path.Clean("/"+p))
+	}
+	changed, err := dataDigests(filepath.Join(deltaDir, "data"))
+	if err != nil {
+		return []string{fmt.Sprintf("failed to read delta data: %v", err)}
+	}
+	for p, d := range changed {
+		tree[p] = d
+	}
+	want, err := dataDigests(filepath.Join(targetDir, "data"))
+	if err != nil {
+		return []string{fmt.Sprintf("failed to read target data: %v", err)}
+	}
+
+	var errs []string
+	for p, d := range want {
+		got, ok := tree[p]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("reconstruction is missing %s", p))
+		case got != d:
+			errs = append(errs, fmt.Sprintf("reconstructed %s differs from target", p))
+		}
+	}
+	for p := range tree {
+		if _, ok := want[p]; !ok {
+			errs = append(errs, fmt.Sprintf("reconstruction has extra file %s", p))
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+func dataDigests(dataDir string) (map[string]string, error) {
+	digests := map[string]string{}
+	err := filepath.WalkDir(dataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dataDir, path)
+		digests["/"+filepath.ToSlash(rel)] = fmt.Sprintf("%x", sha256.Sum256(data))
+		return nil
+	})
+	return digests, err
+}
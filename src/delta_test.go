@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree writes files, by path and content, below dir.
+func writeTree(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestVerifyReconstructionRemovedPaths(t *testing.T) {
+	base := writeTree(t, t.TempDir(), map[string]string{"data/usr/a": "a", "data/usr/b": "b", "data/usr/c": "c"})
+	delta := writeTree(t, t.TempDir(), map[string]string{"data/usr/a": "a2"})
+	target := writeTree(t, t.TempDir(), map[string]string{"data/usr/a": "a2"})
+
+	if errs := verifyReconstruction(base, delta, target, []string{"/usr/b", "usr/c"}); len(errs) != 0 {
+		t.Errorf("verifyReconstruction() = %q, want no errors", errs)
+	}
+	errs := verifyReconstruction(base, delta, target, []string{"/usr/b"})
+	if len(errs) != 1 || errs[0] != "reconstruction has extra file /usr/c" {
+		t.Errorf("verifyReconstruction() = %q, want /usr/c reported as extra", errs)
+	}
+}
+
+func TestCheckDeltaSideFoldsVersion(t *testing.T) {
+	dir := writeTree(t, t.TempDir(), map[string]string{
+		"metadata.json": `{"name": "foo", "version": "2.0", "epoch": 1, "release": "3"}`,
+	})
+	pkg := filepath.Join(dir, "metadata.json")
+	digest, _, err := fileSHA256(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := checkDeltaSide(pkg, dir, "foo", "1:2.0-3", digest, "base"); len(errs) != 0 {
+		t.Errorf("checkDeltaSide() = %q, want no errors", errs)
+	}
+	if errs := checkDeltaSide(pkg, dir, "foo", "2.0", digest, "base"); len(errs) != 1 {
+		t.Errorf("checkDeltaSide() = %q, want a version mismatch", errs)
+	}
+}
@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+type Relation struct {
+	Name    string
+	Op      string
+	Version string
+}
+
+// A name may be a namespaced virtual such as soname(libfoo.so.1); the
+// argument cannot start with an operator, so foo(>=1.0) stays a constraint.
+var relationRe = regexp.MustCompile(`^([A-Za-z0-9@._+-]+(?:\([^\s()<>=][^\s()]*\))?)\s*(?:\(?\s*(>=|<=|=|>|<)\s*([^\s()]+)\s*\)?)?$`)
+
+func ParseRelation(s string) (Relation, error) {
+	m := relationRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Relation{}, fmt.Errorf("malformed relation: '%s'", s)
+	}
+	return Relation{Name: m[1], Op: m[2], Version: m[3]}, nil
+}
+
+func (r Relation) String() string {
+	if r.Op == "" {
+		return r.Name
+	}
+	return r.Name + " " + r.Op + " " + r.Version
+}
+
+func (r Relation) SatisfiedBy(version string) bool {
+	if r.Op == "" {
+		return true
+	}
+	if version == "" {
+		return false
+	}
+	c := CompareVersions(version, r.Version)
+	switch r.Op {
+	case "=":
+		return c == 0
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case "<":
+		return c < 0
+	}
+	return false
+}
+
+func (idx *RepoIndex) Satisfies(rel Relation) bool {
+	for _, entry := range idx.Packages {
+		if satisfiesRelation(MetadataFromMap(entry.Metadata), rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func satisfiesRelation(meta MetadataV2, rel Relation) bool {
+	if meta.Name == rel.Name && rel.SatisfiedBy(meta.Version) {
+		return true
+	}
+	for _, p := range meta.Provides {
+		prov, err := ParseRelation(p)
+		if err != nil || prov.Name != rel.Name {
+			continue
+		}
+		if rel.Op == "" || (prov.Op == "=" && rel.SatisfiedBy(prov.Version)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Checker) checkDependencies(dependencies []string) []string {
+	defer c.track("check:dependencies")()
+	var errs []string
+	for _, dep := range dependencies {
+		rel, err := ParseRelation(dep)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid dependency: %v", err))
+			continue
+		}
+		c.log(fmt.Sprintf("Resolving dependency %s...", rel))
+		if !c.RepoIndex.Satisfies(rel) {
+			msg := fmt.Sprintf("unsatisfiable dependency: '%s' is not provided by any package in the repository index", dep)
+			if names := c.RepoIndex.names(); !slices.Contains(names, rel.Name) {
+				switch similar := similarPackages(rel.Name, names); len(similar) {
+				case 0:
+				case 1:
+					msg += fmt.Sprintf("; did you mean '%s'?", similar[0])
+				default:
+					msg += fmt.Sprintf("; did you mean one of '%s'?", strings.Join(similar, "', '"))
+				}
+			}
+			errs = append(errs, msg)
+		}
+	}
+	return errs
+}
+
+// names returns the package names and provided names in the index.
+func (idx *RepoIndex) names() []string {
+	var names []string
+	for _, entry := range idx.Packages {
+		meta := MetadataFromMap(entry.Metadata)
+		names = append(names, meta.Name)
+		for _, p := range meta.Provides {
+			if prov, err := ParseRelation(p); err == nil {
+				names = append(names, prov.Name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// packageStem reduces a package name to what distributions agree on, so
+// that libssl3, libssl-dev and openssl-libs all contain "ssl".
+func packageStem(name string) string {
+	name = strings.ToLower(name)
+	for _, suffix := range []string{"-devel", "-dev", "-libs", "-lib"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	name = strings.TrimPrefix(name, "lib")
+	return strings.TrimRightFunc(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name), unicode.IsDigit)
+}
+
+// similarPackages returns up to three names from the index that a
+// dependency on an unknown name was probably meant to be: names within a
+// small edit distance, and names sharing its stem.
+func similarPackages(name string, names []string) []string {
+	stem := packageStem(name)
+	type candidate struct {
+		name string
+		dist int
+	}
+	var found []candidate
+	for _, n := range names {
+		dist := levenshtein(strings.ToLower(name), strings.ToLower(n))
+		other := packageStem(n)
+		related := len(stem) >= 3 && len(other) >= 3 && (strings.Contains(other, stem) || strings.Contains(stem, other))
+		if dist <= max(2, len(name)/3) || related {
+			found = append(found, candidate{n, dist})
+		}
+	}
+	slices.SortStableFunc(found, func(a, b candidate) int { return a.dist - b.dist })
+	var similar []string
+	for _, f := range found[:min(3, len(found))] {
+		similar = append(similar, f.name)
+	}
+	return similar
+}
+
+// checkSelfRelations reports relations a package has with itself, which
+// solvers either ignore or trip over: depending on itself or on a virtual
+// it provides, providing its own name, and replacing or conflicting with
+// itself.
+func checkSelfRelations(meta MetadataV2) []string {
+	var warnings []string
+	provided := map[string]bool{}
+	for _, p := range meta.Provides {
+		if rel, err := ParseRelation(p); err == nil {
+			provided[rel.Name] = true
+			if rel.Name == meta.Name {
+				warnings = append(warnings, fmt.Sprintf("trivial relation: %s provides its own name ('%s')", meta.Name, p))
+			}
+		}
+	}
+	for _, list := range []struct {
+		verb      string
+		relations []string
+	}{
+		{"depends on", meta.Dependencies},
+		{"replaces", meta.Replaces},
+		{"conflicts with", meta.Conflicts},
+	} {
+		for _, r := range list.relations {
+			rel, err := ParseRelation(r)
+			switch {
+			case err != nil:
+			case rel.Name == meta.Name:
+				warnings = append(warnings, fmt.Sprintf("trivial relation: %s %s itself ('%s')", meta.Name, list.verb, r))
+			case list.verb == "depends on" && provided[rel.Name]:
+				warnings = append(warnings, fmt.Sprintf("trivial relation: %s depends on '%s', which it provides itself", meta.Name, r))
+			}
+		}
+	}
+	return warnings
+}
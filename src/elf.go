@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// payloadELFs calls fn with every ELF file in the data trees that parses,
+// until ctx is cancelled. ELF files are found by the magic the entry index
+// recorded while extracting, so other files are never opened.
+func (c *Checker) payloadELFs(ctx context.Context, dir string, fn func(installed string, f *elf.File)) {
+	for _, tree := range dataTrees(dir) {
+		c.entries.walk(dir, tree, func(installed, file string, e *indexedEntry) {
+			if ctx.Err() != nil || !bytes.HasPrefix(e.head, []byte(elf.ELFMAG)) {
+				return
+			}
+			f, err := elf.Open(file)
+			if err != nil {
+				return
+			}
+			defer f.Close()
+			fn(installed, f)
+		})
+	}
+}
+
+// buildDirPrefixes are directories builds run in; a search path into them
+// finds nothing on the target system, or whatever a local user put there.
+var buildDirPrefixes = []string{"/home/", "/root/", "/tmp/", "/var/tmp/", "/build/", "/builddir/", "/usr/src/", "/dev/shm/"}
+
+// checkRunpaths reports DT_RPATH and DT_RUNPATH entries that make the
+// dynamic loader search somewhere other than the system and the package:
+// relative and empty entries resolve against the working directory, build
+// directories may be writable by anyone, and $ORIGIN paths must stay inside
+// the directories the package installs.
+func (c *Checker) checkRunpaths(ctx context.Context, dir string, report *ValidationResponse) {
+	dirs := map[string]bool{}
+	payloadFiles(ctx, dir, func(installed, _ string) {
+		for d := path.Dir(installed); !dirs[d]; d = path.Dir(d) {
+			dirs[d] = true
+		}
+	})
+
+	c.payloadELFs(ctx, dir, func(installed string, f *elf.File) {
+		for _, tag := range []elf.DynTag{elf.DT_RPATH, elf.DT_RUNPATH} {
+			values, _ := f.DynString(tag)
+			for _, value := range values {
+				for _, entry := range strings.Split(value, ":") {
+					if problem := runpathProblem(installed, entry, dirs); problem != "" {
+						c.reportAs(c.Policy.Packaging.Runpaths, fmt.Sprintf("insecure %s in %s: '%s' %s", strings.TrimPrefix(tag.String(), "DT_"), installed, entry, problem), report)
+					}
+				}
+			}
+		}
+	})
+}
+
+func runpathProblem(installed, entry string, dirs map[string]bool) string {
+	if entry == "" {
+		return "is empty and resolves to the working directory"
+	}
+	rest, ok := strings.CutPrefix(entry, "$ORIGIN")
+	if !ok {
+		rest, ok = strings.CutPrefix(entry, "${ORIGIN}")
+	}
+	if ok {
+		if rest != "" && rest[0] != '/' {
+			return "is not a path below $ORIGIN"
+		}
+		origin := strings.TrimPrefix(path.Dir(installed), "/")
+		resolved := path.Clean(origin + rest)
+		if origin == "" {
+			resolved = path.Clean("." + rest)
+		}
+		if resolved == ".." || strings.HasPrefix(resolved, "../") {
+			return "escapes the root directory"
+		}
+		if resolved = path.Join("/", resolved); !dirs[resolved] && !slices.Contains(systemLibraryDirs, resolved) {
+			return fmt.Sprintf("resolves to %s, which the package does not install", resolved)
+		}
+		return ""
+	}
+	if !path.IsAbs(entry) {
+		return "is relative and resolves against the working directory"
+	}
+	for _, prefix := range buildDirPrefixes {
+		if strings.HasPrefix(entry+"/", prefix) {
+			return "points into a build or temporary directory"
+		}
+	}
+	return ""
+}
+
+// checkHardening reports ELF executables and libraries built without the
+// usual hardening features, each with the severity the policy gives it.
+func (c *Checker) checkHardening(ctx context.Context, dir string, report *ValidationResponse) {
+	policy := c.Policy.Packaging.Hardening
+	c.payloadELFs(ctx, dir, func(installed string, f *elf.File) {
+		if f.Type != elf.ET_EXEC && f.Type != elf.ET_DYN {
+			return
+		}
+		missing := func(action, feature string) {
+			c.reportAs(action, fmt.Sprintf("missing hardening in %s: %s", installed, feature), report)
+		}
+
+		var interp, dynamic, relro, stack, execStack bool
+		for _, p := range f.Progs {
+			switch p.Type {
+			case elf.PT_INTERP:
+				interp = true
+			case elf.PT_DYNAMIC:
+				dynamic = true
+			case elf.PT_GNU_RELRO:
+				relro = true
+			case elf.PT_GNU_STACK:
+				stack = true
+				execStack = p.Flags&elf.PF_X != 0
+			}
+		}
+
+		if f.Type == elf.ET_EXEC {
+			missing(policy.PIE, "not a position-independent executable (PIE)")
+		}
+		if dynamic && !relro {
+			missing(policy.RELRO, "no RELRO")
+		}
+		if !stack || execStack {
+			missing(policy.NX, "executable stack (no NX)")
+		}
+		if (interp || f.Type == elf.ET_EXEC) && !hasStackProtector(f) {
+			missing(policy.StackProtector, "no stack protector")
+		}
+	})
+}
+
+// hasStackProtector reports whether a binary calls __stack_chk_fail, which
+// -fstack-protector inserts into every protected function.
+func hasStackProtector(f *elf.File) bool {
+	dyn, _ := f.DynamicSymbols()
+	syms, _ := f.Symbols()
+	for _, s := range append(dyn, syms...) {
+		if s.Name == "__stack_chk_fail" || strings.HasPrefix(s.Name, "__stack_chk_fail@") {
+			return true
+		}
+	}
+	return false
+}
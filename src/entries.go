@@ -0,0 +1,238 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ArchiveInfo struct {
+	Formats      []string         `json:"formats"`
+	Extensions   []string         `json:"extensions"`
+	Xattrs       []EntryXattrs    `json:"xattrs,omitempty"`
+	Capabilities []FileCapability `json:"capabilities,omitempty"`
+	Hardlinks    int              `json:"hardlinks,omitempty"`
+	// CompressedSize is the size of the package file and InstalledSize the
+	// total size of the files it installs, in bytes.
+	CompressedSize int64            `json:"compressed_size"`
+	InstalledSize  int64            `json:"installed_size"`
+	Compression    *CompressionInfo `json:"compression,omitempty"`
+}
+
+// checkEntries inspects the raw archive headers for problems that do not
+// survive extraction.
+func (c *Checker) checkEntries(headers []*tar.Header, report *ValidationResponse) {
+	c.log("Checking archive construction...")
+	defer c.track("check:entries")()
+	if problems := checkDeterministic(headers); len(problems) > 0 {
+		if c.Policy.Archive.RequireDeterministic {
+			report.Errors = append(report.Errors, problems...)
+		} else {
+			report.Warnings = append(report.Warnings, problems...)
+		}
+	}
+
+	if !c.Policy.Archive.AllowSparse {
+		for _, h := range headers {
+			if isSparse(h) {
+				report.Errors = append(report.Errors, fmt.Sprintf("sparse file entry is not allowed by policy: %s", h.Name))
+			}
+		}
+	}
+
+	c.checkEntryTypes(headers, report)
+	checkEntryNames(headers, report)
+	checkCaseCollisions(headers, report)
+
+	report.Archive = archiveInfo(headers)
+	c.log(fmt.Sprintf("Tar formats: %s; extensions: %v", strings.Join(report.Archive.Formats, ", "), report.Archive.Extensions))
+	report.Errors = append(report.Errors, c.checkTarFormats(headers)...)
+	c.checkXattrs(headers, report)
+	c.checkCapabilities(headers, report)
+}
+
+// checkEntryTypes reports entries of a type extraction skips, as the
+// policy's unknown_entries setting asks.
+func (c *Checker) checkEntryTypes(headers []*tar.Header, report *ValidationResponse) {
+	for _, h := range headers {
+		switch h.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeGNUSparse, tar.TypeSymlink, tar.TypeLink, tar.TypeXGlobalHeader:
+			continue
+		}
+		message := fmt.Sprintf("unsupported entry type %s: %s", entryTypeName(h.Typeflag), h.Name)
+		switch c.Policy.Archive.UnknownEntries {
+		case "error":
+			report.Errors = append(report.Errors, message)
+		case "warn":
+			report.Warnings = append(report.Warnings, message)
+		default:
+			c.log("Skipping " + message)
+		}
+	}
+}
+
+func entryTypeName(flag byte) string {
+	switch flag {
+	case tar.TypeReg, tar.TypeGNUSparse:
+		return "file"
+	case tar.TypeDir:
+		return "directory"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hard link"
+	case tar.TypeChar:
+		return "character device"
+	case tar.TypeBlock:
+		return "block device"
+	case tar.TypeFifo:
+		return "fifo"
+	case tar.TypeCont:
+		return "contiguous file"
+	}
+	return fmt.Sprintf("'%c'", flag)
+}
+
+// isSparse reports whether an entry is stored as a GNU sparse file, either
+// in the old GNU format or with GNU.sparse PAX records. The tar reader
+// expands the holes, so sparse entries extract and hash like regular files.
+func isSparse(h *tar.Header) bool {
+	if h.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range h.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+func tarFormat(h *tar.Header) string {
+	switch {
+	case h.Format&tar.FormatGNU != 0:
+		return "gnu"
+	case h.Format&tar.FormatPAX != 0:
+		return "pax"
+	case h.Format&tar.FormatUSTAR != 0:
+		return "ustar"
+	}
+	return "v7"
+}
+
+// tarExtensions names the format extensions a header relies on. PAX
+// records are grouped by vendor namespace.
+func tarExtensions(h *tar.Header) []string {
+	var exts []string
+	if isSparse(h) {
+		exts = append(exts, "gnu-sparse")
+	}
+	if tarFormat(h) == "gnu" && (len(h.Name) > 100 || len(h.Linkname) > 100) {
+		exts = append(exts, "gnu-longname")
+	}
+	for key := range h.PAXRecords {
+		if i := strings.LastIndex(key, "."); i > 0 {
+			key = key[:i]
+		}
+		exts = append(exts, "pax:"+key)
+	}
+	return exts
+}
+
+func archiveInfo(headers []*tar.Header) *ArchiveInfo {
+	info := &ArchiveInfo{Formats: []string{}, Extensions: []string{}}
+	for _, h := range headers {
+		info.Formats = append(info.Formats, tarFormat(h))
+		info.Extensions = append(info.Extensions, tarExtensions(h)...)
+		if h.Typeflag == tar.TypeLink {
+			info.Hardlinks++
+		}
+	}
+	slices.Sort(info.Formats)
+	info.Formats = slices.Compact(info.Formats)
+	slices.Sort(info.Extensions)
+	info.Extensions = slices.Compact(info.Extensions)
+	return info
+}
+
+func (c *Checker) checkTarFormats(headers []*tar.Header) []string {
+	allowed := c.Policy.Archive.AllowedFormats
+	if len(allowed) == 0 {
+		return nil
+	}
+	var errs []string
+	seen := map[string]bool{}
+	for _, h := range headers {
+		format := tarFormat(h)
+		if seen[format] || slices.Contains(allowed, format) {
+			continue
+		}
+		seen[format] = true
+		errs = append(errs, fmt.Sprintf("tar format %s is not allowed by policy (allowed: %s): first used by %s", format, strings.Join(allowed, ", "), h.Name))
+	}
+	return errs
+}
+
+// checkDeterministic reports archive properties that make a package
+// impossible to rebuild bit for bit: entries out of order, varying or
+// unclamped mtimes, and build-user ownership.
+func checkDeterministic(headers []*tar.Header) []string {
+	var problems []string
+
+	for i := 1; i < len(headers); i++ {
+		if compareEntryNames(headers[i-1].Name, headers[i].Name) > 0 {
+			problems = append(problems, fmt.Sprintf("archive entries are not sorted: %s comes after %s", headers[i].Name, headers[i-1].Name))
+			break
+		}
+	}
+
+	if epoch, ok := sourceDateEpoch(); ok {
+		for _, h := range headers {
+			if !h.ModTime.Equal(epoch) {
+				problems = append(problems, fmt.Sprintf("entry mtime is not SOURCE_DATE_EPOCH (%d): %s has %d", epoch.Unix(), h.Name, h.ModTime.Unix()))
+				break
+			}
+		}
+	} else {
+		for _, h := range headers {
+			if !h.ModTime.Equal(headers[0].ModTime) {
+				problems = append(problems, fmt.Sprintf("entry mtimes are not fixed: %s has %s, %s has %s",
+					headers[0].Name, headers[0].ModTime.UTC().Format(time.RFC3339Nano), h.Name, h.ModTime.UTC().Format(time.RFC3339Nano)))
+				break
+			}
+		}
+	}
+
+	for _, h := range headers {
+		if h.Uid != 0 || h.Gid != 0 || (h.Uname != "" && h.Uname != "root") || (h.Gname != "" && h.Gname != "root") {
+			problems = append(problems, fmt.Sprintf("entry ownership is not zeroed: %s is owned by %d:%d (%s:%s)", h.Name, h.Uid, h.Gid, h.Uname, h.Gname))
+			break
+		}
+	}
+	return problems
+}
+
+// compareEntryNames orders paths component by component, the order in
+// which a sorted directory walk emits them.
+func compareEntryNames(a, b string) int {
+	clean := func(s string) []string {
+		return strings.Split(strings.TrimPrefix(path.Clean("/"+s), "/"), "/")
+	}
+	return slices.Compare(clean(a), clean(b))
+}
+
+func sourceDateEpoch() (time.Time, bool) {
+	v, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(v, 0), true
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// indexedAlgos returns the digests computed while a file is extracted:
+// those of the flat manifests of its tree. Digests only checksums.json
+// uses are computed when it is verified.
+func indexedAlgos(name string) []string {
+	switch tree, _, _ := strings.Cut(filepath.ToSlash(name), "/"); {
+	case tree == "data" || strings.HasPrefix(tree, "data-"):
+		return []string{"md5", "crc32"}
+	case tree == "sources":
+		return []string{"sha256"}
+	}
+	return nil
+}
+
+// headSize is how many leading bytes of a file the index keeps, enough
+// for the magic numbers the content checks sniff file types by.
+const headSize = 8
+
+// indexedEntry records a regular file as seen in the extraction pass:
+// where its content starts in the decompressed tar stream, its size, its
+// first bytes and its digests.
+type indexedEntry struct {
+	offset  int64
+	size    int64
+	modTime time.Time
+	head    []byte
+	digests map[string]string
+}
+
+// entryIndex maps the absolute path a file was extracted to to its entry,
+// so checksum verification does not read the extracted files again, and
+// the content checks find installed files and ELF objects without walking
+// and sniffing the extracted tree.
+type entryIndex map[string]*indexedEntry
+
+// countingReader counts the bytes read through it, which for a tar reader
+// is the offset of the current entry's content.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// entryHead keeps the first headSize bytes written to it.
+type entryHead []byte
+
+func (h *entryHead) Write(p []byte) (int, error) {
+	if n := headSize - len(*h); n > 0 {
+		*h = append(*h, p[:min(n, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// entryHashes returns hashes for the algorithms indexed for an entry and
+// a writer feeding all of them.
+func entryHashes(name string) (map[string]hash.Hash, io.Writer) {
+	hashes := map[string]hash.Hash{}
+	var writers []io.Writer
+	for _, algo := range indexedAlgos(name) {
+		hashes[algo] = newHash(algo)
+		writers = append(writers, hashes[algo])
+	}
+	return hashes, io.MultiWriter(writers...)
+}
+
+// add records an extracted file once it is written and closed.
+func (idx entryIndex) add(target string, offset, size int64, head []byte, hashes map[string]hash.Hash) {
+	fi, err := os.Stat(target)
+	if err != nil {
+		return
+	}
+	e := &indexedEntry{offset: offset, size: size, modTime: fi.ModTime(), head: head, digests: map[string]string{}}
+	for algo, h := range hashes {
+		e.digests[algo] = hex.EncodeToString(h.Sum(nil))
+	}
+	idx[target] = e
+}
+
+// installed returns the installed paths of the files extracted into the
+// given trees of dir, sorted.
+func (idx entryIndex) installed(dir string, trees []string) []string {
+	var files []string
+	for _, tree := range trees {
+		idx.walk(dir, tree, func(installed, _ string, _ *indexedEntry) {
+			files = append(files, installed)
+		})
+	}
+	slices.Sort(files)
+	return files
+}
+
+// walk calls fn with the installed path, extracted path and entry of every
+// file extracted into one tree of dir, in order of their extracted paths.
+func (idx entryIndex) walk(dir, tree string, fn func(installed, file string, e *indexedEntry)) {
+	root, err := filepath.Abs(filepath.Join(dir, tree))
+	if err != nil {
+		return
+	}
+	var files []string
+	for file := range idx {
+		if strings.HasPrefix(file, root+string(filepath.Separator)) {
+			files = append(files, file)
+		}
+	}
+	slices.Sort(files)
+	for _, file := range files {
+		fn(filepath.ToSlash(strings.TrimPrefix(file, root)), file, idx[file])
+	}
+}
+
+// digest returns the digest of an extracted file recorded during
+// extraction, unless the file has changed since.
+func (idx entryIndex) digest(file, algo string) (string, bool) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", false
+	}
+	e, ok := idx[abs]
+	if !ok {
+		return "", false
+	}
+	sum, ok := e.digests[strings.ToLower(algo)]
+	if !ok {
+		return "", false
+	}
+	if fi, err := os.Stat(abs); err != nil || fi.Size() != e.size || !fi.ModTime().Equal(e.modTime) {
+		return "", false
+	}
+	return sum, true
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExtractIndexesEntries(t *testing.T) {
+	c := testChecker(t)
+	src := writeTar(t, t.TempDir(), "p.apg",
+		testEntry{name: "metadata.json", body: "{}"},
+		testEntry{name: "data/usr/bin/tool", body: "\x7fELF\x02\x01\x01rest"},
+		testEntry{name: "data/usr/bin/alias", link: "data/usr/bin/tool", typ: tar.TypeLink},
+		testEntry{name: "data/etc/tool.conf", body: "key=value\n"},
+	)
+	dir := filepath.Join(t.TempDir(), "x")
+	if _, err := ExtractTarXz(src, dir, c); err != nil {
+		t.Fatal(err)
+	}
+	abs, _ := filepath.Abs(dir)
+
+	tool := c.entries[filepath.Join(abs, "data/usr/bin/tool")]
+	if tool == nil {
+		t.Fatal("data/usr/bin/tool is not indexed")
+	}
+	// metadata.json takes a header and a padded block, so the tool's
+	// content starts after its own header at 3*512.
+	if tool.offset != 3*512 || tool.size != 11 || string(tool.head) != "\x7fELF\x02\x01\x01r" {
+		t.Errorf("tool = offset %d, size %d, head %q", tool.offset, tool.size, tool.head)
+	}
+	if c.entries[filepath.Join(abs, "data/usr/bin/alias")] != tool {
+		t.Error("hard link does not share the entry of its target")
+	}
+
+	// The installed files come from the index, not from the extracted tree.
+	os.RemoveAll(filepath.Join(dir, "data"))
+	want := []string{"/etc/tool.conf", "/usr/bin/alias", "/usr/bin/tool"}
+	if got := c.entries.installed(dir, []string{"data"}); !slices.Equal(got, want) {
+		t.Errorf("installed() = %q, want %q", got, want)
+	}
+}
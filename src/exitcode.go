@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import "fmt"
+
+// ExitCode returns the exit status for a result. Without exit_codes in
+// the policy it is 1 for an invalid result and 0 otherwise. With them,
+// each finding maps to the code given for its rule, by ID or code, or
+// else for its severity (error 1, warning 0 unless given), and the
+// highest code wins.
+func (p Policy) ExitCode(valid bool, findings []Finding) int {
+	if len(p.ExitCodes) == 0 {
+		if !valid {
+			return 1
+		}
+		return 0
+	}
+	code := 0
+	for _, f := range findings {
+		code = max(code, p.exitCodeFor(f))
+	}
+	return code
+}
+
+func (p Policy) exitCodeFor(f Finding) int {
+	if f.Rule != "" {
+		for key, code := range p.ExitCodes {
+			if rule, ok := RuleByID(key); ok && rule.ID == f.Rule {
+				return code
+			}
+		}
+	}
+	if code, ok := p.ExitCodes[f.Severity]; ok {
+		return code
+	}
+	if f.Severity == "error" {
+		return 1
+	}
+	return 0
+}
+
+func validateExitCodes(codes map[string]int) error {
+	for key, code := range codes {
+		if _, ok := RuleByID(key); !ok && key != "error" && key != "warning" {
+			return fmt.Errorf("unknown severity or rule in policy exit_codes: '%s'", key)
+		}
+		if code < 0 || code > 125 {
+			return fmt.Errorf("exit code for %s in policy must be between 0 and 125", key)
+		}
+	}
+	return nil
+}
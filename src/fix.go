@@ -0,0 +1,392 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// FixChange is one repair applied to a file inside the package.
+type FixChange struct {
+	File   string `json:"file"`
+	Repair string `json:"repair"`
+}
+
+// Fix repairs the mechanically fixable problems of an APG package in place:
+// metadata.json formatting, group and world writable files and checksum
+// manifests. The archive is only re-packed when something changed, and
+// then every entry keeps its header: type, mode, owner, mtime and PAX
+// records. Packages with entries that cannot be re-packed as they are
+// are refused. With dryRun the repairs are computed on a scratch copy and
+// the package is left untouched.
+func (c *Checker) Fix(apgFile string, apgVersion int, dryRun bool) ([]FixChange, error) {
+	dir := c.tempPath("apgcheck-fix-")
+	defer os.RemoveAll(dir)
+	headers, err := c.extractPreserving(apgFile, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if apgVersion == 0 && !c.SourcePackage {
+		apgVersion = detectAPGVersion(dir)
+	}
+
+	var changes []FixChange
+	c.log("Normalizing metadata.json...")
+	change, err := fixMetadata(dir)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, change...)
+
+	c.log("Normalizing file modes...")
+	changes = append(changes, fixModes(headers)...)
+
+	c.log("Regenerating checksum manifests...")
+	change, err = c.fixManifests(dir, apgVersion, headers)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, change...)
+
+	if len(changes) == 0 {
+		return changes, nil
+	}
+	headers, change = addedEntries(headers, changes)
+	changes = append(changes, change...)
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeGNUSparse || h.PAXRecords["GNU.sparse.map"] != "" || h.PAXRecords["GNU.sparse.major"] != "" {
+			changes = append(changes, FixChange{File: entryName(h.Name), Repair: "stored the sparse file as a regular file"})
+		}
+	}
+	if dryRun {
+		return changes, nil
+	}
+	c.log("Re-packing the archive...")
+	return changes, repack(dir, apgFile, headers)
+}
+
+// extractPreserving extracts a package for repairs and returns its
+// headers. Files on disk are made readable and writable, since their
+// modes are taken from the headers when re-packing.
+func (c *Checker) extractPreserving(apgFile, dir string) ([]*tar.Header, error) {
+	f, err := os.Open(apgFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open archive: %w", err)
+	}
+	defer f.Close()
+
+	xzr, err := c.openXZ(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the XZ-reader: %w", err)
+	}
+	defer xzr.Close()
+	w := &payloadWriter{root: dir, budget: entryBudget{limits: c.Policy.Limits}}
+	if err := w.extractTar(xzr); err != nil {
+		return nil, err
+	}
+	for _, h := range w.headers {
+		if !repackable[h.Typeflag] {
+			return nil, fmt.Errorf("cannot re-pack %s: %s entries are not supported, the package was not changed", h.Name, entryTypeName(h.Typeflag))
+		}
+		if h.Typeflag == tar.TypeReg || h.Typeflag == tar.TypeGNUSparse {
+			if err := os.Chmod(entryPath(dir, h.Name), 0644); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return w.headers, nil
+}
+
+// repackable lists the entry types a repaired archive can keep: regular
+// files and links are extracted, the others are written back from their
+// headers alone.
+var repackable = map[byte]bool{
+	tar.TypeReg: true, tar.TypeGNUSparse: true, tar.TypeLink: true, tar.TypeSymlink: true,
+	tar.TypeDir: true, tar.TypeChar: true, tar.TypeBlock: true, tar.TypeFifo: true,
+	tar.TypeXGlobalHeader: true,
+}
+
+// entryPath returns where an entry was extracted below dir.
+func entryPath(dir, name string) string {
+	return filepath.Join(dir, filepath.Clean("/"+name))
+}
+
+// entryName returns the path of an entry within the package, without a
+// leading "./".
+func entryName(name string) string {
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+name)), "/")
+}
+
+func fixMetadata(dir string) ([]FixChange, error) {
+	path := filepath.Join(dir, "metadata.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(data), "", "  "); err != nil {
+		return nil, fmt.Errorf("metadata.json is not valid JSON and cannot be fixed: %w", err)
+	}
+	buf.WriteByte('\n')
+	if bytes.Equal(buf.Bytes(), data) {
+		return nil, nil
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	return []FixChange{{File: "metadata.json", Repair: "normalized JSON formatting"}}, nil
+}
+
+// fixModes drops group and world write permissions from files. Special
+// bits and owner-only modes are kept.
+func fixModes(headers []*tar.Header) []FixChange {
+	var changes []FixChange
+	for _, h := range headers {
+		if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeGNUSparse || h.Mode&0022 == 0 {
+			continue
+		}
+		old := h.Mode & 07777
+		h.Mode &^= 0022
+		changes = append(changes, FixChange{
+			File:   entryName(h.Name),
+			Repair: fmt.Sprintf("changed mode %04o to %04o", old, h.Mode&07777),
+		})
+	}
+	return changes
+}
+
+func (c *Checker) fixManifests(dir string, apgVersion int, headers []*tar.Header) ([]FixChange, error) {
+	manifests := map[string]string{}
+	trees := map[string]string{}
+	if c.SourcePackage {
+		manifests["sha256sums"], trees["sha256sums"] = "SHA256", "sources"
+	} else {
+		kinds := []string{"md5sums"}
+		if apgVersion == 2 {
+			kinds = append(kinds, "crc32sums")
+		}
+		for _, tree := range dataTrees(dir) {
+			for _, kind := range kinds {
+				name := kind + strings.TrimPrefix(tree, "data")
+				// A structured manifest makes the flat ones optional, so
+				// only those the package ships are kept up to date.
+				if _, err := os.Stat(filepath.Join(dir, name)); err != nil && hasManifest(dir, tree) {
+					continue
+				}
+				manifests[name], trees[name] = sumsAlgos[kind], tree
+			}
+		}
+	}
+
+	names := make([]string, 0, len(manifests))
+	for name := range manifests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []FixChange
+	for _, name := range names {
+		tree := filepath.Join(dir, trees[name])
+		if _, err := os.Stat(tree); err != nil {
+			continue
+		}
+		sums, err := generateSums(tree, manifests[name])
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, name)
+		old, readErr := os.ReadFile(path)
+		if readErr == nil && string(old) == sums {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(sums), 0644); err != nil {
+			return nil, err
+		}
+		repair := "regenerated " + manifests[name] + " checksums"
+		if os.IsNotExist(readErr) {
+			repair = "created missing " + manifests[name] + " manifest"
+		}
+		changes = append(changes, FixChange{File: name, Repair: repair})
+	}
+
+	if c.SourcePackage {
+		return changes, nil
+	}
+	for _, tree := range dataTrees(dir) {
+		if !hasManifest(dir, tree) {
+			continue
+		}
+		path := filepath.Join(dir, manifestName(tree))
+		modes := map[string]int64{}
+		for _, h := range headers {
+			if rel, ok := strings.CutPrefix(entryName(h.Name), tree+"/"); ok {
+				modes[rel] = h.Mode & 07777
+			}
+		}
+		data, err := generateManifest(filepath.Join(dir, tree), manifestAlgorithms(path), modes)
+		if err != nil {
+			return nil, err
+		}
+		if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+			continue
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return nil, err
+		}
+		changes = append(changes, FixChange{File: manifestName(tree), Repair: "regenerated checksum manifest"})
+	}
+	return changes, nil
+}
+
+// dataTrees returns the payload trees of a package: data, or data-ARCH
+// for each architecture of a multi-architecture package.
+func dataTrees(dir string) []string {
+	arches := archTrees(dir)
+	if len(arches) == 0 {
+		return []string{"data"}
+	}
+	trees := make([]string, len(arches))
+	for i, arch := range arches {
+		trees[i] = "data-" + arch
+	}
+	return trees
+}
+
+// addedEntries adds headers for the manifests a repair created, in the
+// position that keeps a sorted archive sorted. They take the owner, mtime
+// and naming of the archive's metadata.json.
+func addedEntries(headers []*tar.Header, changes []FixChange) ([]*tar.Header, []FixChange) {
+	known := map[string]bool{}
+	template := &tar.Header{Uname: "root", Gname: "root", ModTime: time.Now().Truncate(time.Second)}
+	if mtime, ok := sourceDateEpoch(); ok {
+		template.ModTime = mtime
+	}
+	for _, h := range headers {
+		known[entryName(h.Name)] = true
+		if entryName(h.Name) == "metadata.json" {
+			template = h
+		}
+	}
+	prefix := ""
+	if strings.HasPrefix(template.Name, "./") {
+		prefix = "./"
+	}
+
+	var added []FixChange
+	for _, change := range changes {
+		if known[change.File] {
+			continue
+		}
+		known[change.File] = true
+		h := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     prefix + change.File,
+			Mode:     0644,
+			Uid:      template.Uid,
+			Gid:      template.Gid,
+			Uname:    template.Uname,
+			Gname:    template.Gname,
+			ModTime:  template.ModTime,
+		}
+		i := slices.IndexFunc(headers, func(e *tar.Header) bool { return entryName(e.Name) > change.File })
+		if i < 0 {
+			i = len(headers)
+		}
+		headers = slices.Insert(headers, i, h)
+		added = append(added, FixChange{File: change.File, Repair: "added to the archive with mode 0644"})
+	}
+	return headers, added
+}
+
+// repack replaces apgFile with an archive of the entries, taking the
+// content of regular files from dir. Sparse files are stored as regular
+// files. The new archive is written next to the original and renamed over
+// it, so a failure leaves the original package untouched. An uncompressed
+// package stays uncompressed.
+func repack(dir, apgFile string, headers []*tar.Header) error {
+	fi, err := os.Stat(apgFile)
+	if err != nil {
+		return err
+	}
+	plain := false
+	if f, err := os.Open(apgFile); err == nil {
+		plain = isTar(f)
+		f.Close()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(apgFile), ".apgcheck-fix-*")
+	if err != nil {
+		return fmt.Errorf("cannot create archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var out io.WriteCloser = nopWriteCloser{tmp}
+	if !plain {
+		if out, err = xz.NewWriter(tmp); err != nil {
+			return fmt.Errorf("cannot create the XZ-writer: %w", err)
+		}
+	}
+	tw := tar.NewWriter(out)
+	for _, h := range headers {
+		if err := writeEntry(tw, dir, h); err != nil {
+			return fmt.Errorf("cannot re-pack %s: %w", h.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), apgFile)
+}
+
+func writeEntry(tw *tar.Writer, dir string, h *tar.Header) error {
+	if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeGNUSparse {
+		return tw.WriteHeader(h)
+	}
+	f, err := os.Open(entryPath(dir, h.Name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	h.Typeflag, h.Size = tar.TypeReg, fi.Size()
+	for key := range h.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			delete(h.PAXRecords, key)
+		}
+	}
+	if err := tw.WriteHeader(h); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
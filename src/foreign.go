@@ -0,0 +1,465 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// foreignPackage holds the metadata of a .deb or .rpm package, already
+// translated to APG conventions where that is mechanical.
+type foreignPackage struct {
+	Format      string
+	Name        string
+	Version     string
+	Arch        string
+	Summary     string
+	Description string
+	Maintainer  string
+	License     string
+	Homepage    string
+	Section     string
+	Depends     []string
+	Conflicts   []string
+	Provides    []string
+	Replaces    []string
+	Conffiles   []string
+	Notes       []string
+}
+
+var archAliases = map[string]string{
+	"amd64":   "x86_64",
+	"x86_64":  "x86_64",
+	"arm64":   "aarch64",
+	"aarch64": "aarch64",
+	"riscv64": "riscv64",
+	"i386":    "i686",
+	"i686":    "i686",
+	"all":     "any",
+	"noarch":  "any",
+}
+
+func readForeignPackage(path string) (*foreignPackage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open package: %w", err)
+	}
+	defer f.Close()
+
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return nil, fmt.Errorf("cannot read package: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case string(magic) == "!<arch>\n":
+		return readDeb(f)
+	case bytes.Equal(magic[:4], []byte{0xed, 0xab, 0xee, 0xdb}):
+		pkg, _, err := readRPMHeader(f)
+		return pkg, err
+	default:
+		return nil, fmt.Errorf("not a .deb or .rpm package")
+	}
+}
+
+// arMembers calls fn for every member of an ar archive, stopping early
+// when fn returns io.EOF.
+func arMembers(r io.Reader, fn func(name string, data io.Reader) error) error {
+	br := bufio.NewReader(r)
+	if _, err := br.Discard(8); err != nil {
+		return fmt.Errorf("truncated ar archive: %w", err)
+	}
+	header := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(br, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("truncated ar header: %w", err)
+		}
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ar member size for %s", name)
+		}
+
+		member := io.LimitReader(br, size)
+		if err := fn(name, member); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if _, err := io.Copy(io.Discard, member); err != nil {
+			return err
+		}
+		if size%2 == 1 {
+			br.Discard(1)
+		}
+	}
+}
+
+func decompressMember(name string, r io.Reader) (io.Reader, error) {
+	switch path.Ext(name) {
+	case ".tar":
+		return r, nil
+	case ".gz":
+		return gzip.NewReader(r)
+	case ".xz":
+		return xz.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported compression for %s", name)
+	}
+}
+
+func readDeb(r io.Reader) (*foreignPackage, error) {
+	var control, conffiles []byte
+	err := arMembers(r, func(name string, data io.Reader) error {
+		if !strings.HasPrefix(name, "control.tar") {
+			return nil
+		}
+		dr, err := decompressMember(name, data)
+		if err != nil {
+			return err
+		}
+		tr := tar.NewReader(dr)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("error reading %s: %w", name, err)
+			}
+			switch path.Clean(h.Name) {
+			case "control":
+				control, _ = io.ReadAll(tr)
+			case "conffiles":
+				conffiles, _ = io.ReadAll(tr)
+			}
+		}
+		return io.EOF
+	})
+	if err != nil {
+		return nil, err
+	}
+	if control == nil {
+		return nil, fmt.Errorf("control file not found in .deb")
+	}
+
+	fields := parseControl(string(control))
+	pkg := &foreignPackage{
+		Format:     "deb",
+		Name:       fields["Package"],
+		Version:    fields["Version"],
+		Arch:       fields["Architecture"],
+		Maintainer: fields["Maintainer"],
+		Homepage:   fields["Homepage"],
+		Section:    fields["Section"],
+	}
+	if desc := fields["Description"]; desc != "" {
+		lines := strings.SplitN(desc, "\n", 2)
+		pkg.Summary = lines[0]
+		if len(lines) > 1 {
+			pkg.Description = lines[1]
+		}
+	}
+
+	if fields["Pre-Depends"] != "" {
+		pkg.Notes = append(pkg.Notes, "Pre-Depends merged into dependencies")
+	}
+	pkg.Depends = pkg.debRelations(fields["Pre-Depends"] + "," + fields["Depends"])
+	if fields["Breaks"] != "" {
+		pkg.Notes = append(pkg.Notes, "Breaks merged into conflicts")
+	}
+	pkg.Conflicts = pkg.debRelations(fields["Conflicts"] + "," + fields["Breaks"])
+	pkg.Provides = pkg.debRelations(fields["Provides"])
+	pkg.Replaces = pkg.debRelations(fields["Replaces"])
+	if fields["Recommends"] != "" || fields["Suggests"] != "" {
+		pkg.Notes = append(pkg.Notes, "Recommends/Suggests have no APG equivalent and were dropped")
+	}
+	for _, line := range strings.Split(string(conffiles), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			pkg.Conffiles = append(pkg.Conffiles, line)
+		}
+	}
+	return pkg, nil
+}
+
+func parseControl(text string) map[string]string {
+	fields := map[string]string{}
+	var last string
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			cont := strings.TrimSpace(line)
+			if cont == "." {
+				cont = ""
+			}
+			fields[last] += "\n" + cont
+			continue
+		}
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			last = strings.TrimSpace(k)
+			fields[last] = strings.TrimSpace(v)
+		}
+	}
+	return fields
+}
+
+var debRelationRe = regexp.MustCompile(`^([^\s(:\[]+)(?::\S+)?\s*(?:\(\s*(<<|<=|=|>=|>>|<|>)\s*([^\s)]+)\s*\))?`)
+
+var debOps = map[string]string{
+	"<<": "<",
+	">>": ">",
+	"<":  "<=",
+	">":  ">=",
+	"<=": "<=",
+	">=": ">=",
+	"=":  "=",
+}
+
+func (pkg *foreignPackage) debRelations(field string) []string {
+	rels := []string{}
+	for _, item := range strings.Split(field, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if alts := strings.Split(item, "|"); len(alts) > 1 {
+			pkg.Notes = append(pkg.Notes, fmt.Sprintf("alternative '%s' reduced to its first choice", item))
+			item = strings.TrimSpace(alts[0])
+		}
+		m := debRelationRe.FindStringSubmatch(item)
+		if m == nil {
+			pkg.Notes = append(pkg.Notes, fmt.Sprintf("could not translate relation '%s'", item))
+			continue
+		}
+		rel := Relation{Name: m[1], Op: debOps[m[2]], Version: m[3]}
+		rels = append(rels, rel.String())
+	}
+	return rels
+}
+
+const (
+	rpmTagName            = 1000
+	rpmTagVersion         = 1001
+	rpmTagRelease         = 1002
+	rpmTagEpoch           = 1003
+	rpmTagSummary         = 1004
+	rpmTagDescription     = 1005
+	rpmTagLicense         = 1014
+	rpmTagPackager        = 1015
+	rpmTagGroup           = 1016
+	rpmTagURL             = 1020
+	rpmTagArch            = 1022
+	rpmTagFileFlags       = 1037
+	rpmTagProvideName     = 1047
+	rpmTagRequireFlags    = 1048
+	rpmTagRequireName     = 1049
+	rpmTagRequireVersion  = 1050
+	rpmTagConflictFlags   = 1053
+	rpmTagConflictName    = 1054
+	rpmTagConflictVersion = 1055
+	rpmTagObsoleteName    = 1090
+	rpmTagProvideFlags    = 1112
+	rpmTagProvideVersion  = 1113
+	rpmTagObsoleteFlags   = 1114
+	rpmTagObsoleteVersion = 1115
+	rpmTagDirIndexes      = 1116
+	rpmTagBaseNames       = 1117
+	rpmTagDirNames        = 1118
+	rpmTagPayloadCompress = 1125
+
+	rpmFileConfig = 1
+)
+
+type rpmHeader struct {
+	strings map[int][]string
+	ints    map[int][]int32
+}
+
+func readRPMHeaderSection(r io.Reader, pad bool) (*rpmHeader, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return nil, fmt.Errorf("truncated rpm header: %w", err)
+	}
+	if !bytes.Equal(intro[:3], []byte{0x8e, 0xad, 0xe8}) {
+		return nil, fmt.Errorf("bad rpm header magic")
+	}
+	nindex := binary.BigEndian.Uint32(intro[8:12])
+	hsize := binary.BigEndian.Uint32(intro[12:16])
+	if nindex > 1<<16 || hsize > 256<<20 {
+		return nil, fmt.Errorf("rpm header too large")
+	}
+
+	index := make([]byte, 16*nindex)
+	if _, err := io.ReadFull(r, index); err != nil {
+		return nil, fmt.Errorf("truncated rpm header index: %w", err)
+	}
+	store := make([]byte, hsize)
+	if _, err := io.ReadFull(r, store); err != nil {
+		return nil, fmt.Errorf("truncated rpm header store: %w", err)
+	}
+	if pad {
+		if rem := (16 + 16*int(nindex) + int(hsize)) % 8; rem != 0 {
+			io.ReadFull(r, make([]byte, 8-rem))
+		}
+	}
+
+	h := &rpmHeader{strings: map[int][]string{}, ints: map[int][]int32{}}
+	for i := 0; i < int(nindex); i++ {
+		e := index[i*16 : i*16+16]
+		tag := int(binary.BigEndian.Uint32(e[0:4]))
+		typ := binary.BigEndian.Uint32(e[4:8])
+		off := int(binary.BigEndian.Uint32(e[8:12]))
+		count := int(binary.BigEndian.Uint32(e[12:16]))
+		if off >= len(store) {
+			continue
+		}
+		switch typ {
+		case 4:
+			for j := 0; j < count && off+4*j+4 <= len(store); j++ {
+				h.ints[tag] = append(h.ints[tag], int32(binary.BigEndian.Uint32(store[off+4*j:])))
+			}
+		case 6, 8, 9:
+			if typ != 8 {
+				count = 1
+			}
+			data := store[off:]
+			for j := 0; j < count; j++ {
+				end := bytes.IndexByte(data, 0)
+				if end < 0 {
+					break
+				}
+				h.strings[tag] = append(h.strings[tag], string(data[:end]))
+				data = data[end+1:]
+			}
+		}
+	}
+	return h, nil
+}
+
+func (h *rpmHeader) str(tag int) string {
+	if v := h.strings[tag]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// readRPMHeader parses the lead, signature and main header of an rpm and
+// leaves r positioned at the start of the payload.
+func readRPMHeader(r io.Reader) (*foreignPackage, *rpmHeader, error) {
+	if _, err := io.ReadFull(r, make([]byte, 96)); err != nil {
+		return nil, nil, fmt.Errorf("truncated rpm lead: %w", err)
+	}
+	if _, err := readRPMHeaderSection(r, true); err != nil {
+		return nil, nil, fmt.Errorf("signature: %w", err)
+	}
+	h, err := readRPMHeaderSection(r, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := h.str(rpmTagVersion)
+	if rel := h.str(rpmTagRelease); rel != "" {
+		version += "-" + rel
+	}
+	if epoch := h.ints[rpmTagEpoch]; len(epoch) > 0 && epoch[0] != 0 {
+		version = fmt.Sprintf("%d:%s", epoch[0], version)
+	}
+
+	pkg := &foreignPackage{
+		Format:      "rpm",
+		Name:        h.str(rpmTagName),
+		Version:     version,
+		Arch:        h.str(rpmTagArch),
+		Summary:     h.str(rpmTagSummary),
+		Description: h.str(rpmTagDescription),
+		Maintainer:  h.str(rpmTagPackager),
+		License:     h.str(rpmTagLicense),
+		Homepage:    h.str(rpmTagURL),
+		Section:     h.str(rpmTagGroup),
+	}
+	pkg.Depends = pkg.rpmRelations(h, rpmTagRequireName, rpmTagRequireFlags, rpmTagRequireVersion)
+	pkg.Conflicts = pkg.rpmRelations(h, rpmTagConflictName, rpmTagConflictFlags, rpmTagConflictVersion)
+	pkg.Provides = pkg.rpmRelations(h, rpmTagProvideName, rpmTagProvideFlags, rpmTagProvideVersion)
+	pkg.Replaces = pkg.rpmRelations(h, rpmTagObsoleteName, rpmTagObsoleteFlags, rpmTagObsoleteVersion)
+
+	dirs := h.strings[rpmTagDirNames]
+	dirIdx := h.ints[rpmTagDirIndexes]
+	flags := h.ints[rpmTagFileFlags]
+	for i, base := range h.strings[rpmTagBaseNames] {
+		if i < len(flags) && flags[i]&rpmFileConfig != 0 && i < len(dirIdx) && int(dirIdx[i]) < len(dirs) {
+			pkg.Conffiles = append(pkg.Conffiles, dirs[dirIdx[i]]+base)
+		}
+	}
+	return pkg, h, nil
+}
+
+func (pkg *foreignPackage) rpmRelations(h *rpmHeader, nameTag, flagsTag, versionTag int) []string {
+	names := h.strings[nameTag]
+	flags := h.ints[flagsTag]
+	versions := h.strings[versionTag]
+
+	rels := []string{}
+	seen := map[string]bool{}
+	for i, name := range names {
+		switch {
+		case strings.HasPrefix(name, "rpmlib("):
+			continue
+		case strings.HasPrefix(name, "/"):
+			pkg.Notes = append(pkg.Notes, fmt.Sprintf("file relation '%s' has no APG equivalent and was dropped", name))
+			continue
+		case nameTag == rpmTagProvideName && name == pkg.Name:
+			continue
+		}
+
+		rel := Relation{Name: name}
+		if i < len(flags) && i < len(versions) && versions[i] != "" {
+			switch flags[i] & 0xe {
+			case 2:
+				rel.Op = "<"
+			case 4:
+				rel.Op = ">"
+			case 8:
+				rel.Op = "="
+			case 10:
+				rel.Op = "<="
+			case 12:
+				rel.Op = ">="
+			}
+			if rel.Op != "" {
+				rel.Version = versions[i]
+			}
+		}
+		s := rel.String()
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		if _, err := ParseRelation(s); err != nil {
+			pkg.Notes = append(pkg.Notes, fmt.Sprintf("relation '%s' is not valid in APG and needs manual mapping", s))
+		}
+		rels = append(rels, s)
+	}
+	return rels
+}
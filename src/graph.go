@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type GraphNode struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+}
+
+type GraphEdge struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Dependency string `json:"dependency"`
+}
+
+type DepGraph struct {
+	Nodes  []GraphNode `json:"nodes"`
+	Edges  []GraphEdge `json:"edges"`
+	Cycles [][]string  `json:"cycles"`
+}
+
+// BuildGraph builds the dependency graph of roots. With an index,
+// dependencies are resolved to concrete packages and followed
+// transitively; without one, edges point at the named dependency.
+func BuildGraph(roots []MetadataV2, idx *RepoIndex) *DepGraph {
+	g := &DepGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}, Cycles: [][]string{}}
+	nodes := map[string]*GraphNode{}
+	addNode := func(n GraphNode) {
+		if existing, ok := nodes[n.Name]; ok {
+			if existing.Missing && !n.Missing {
+				*existing = n
+			}
+			return
+		}
+		nodes[n.Name] = &n
+	}
+
+	queue := append([]MetadataV2{}, roots...)
+	seen := map[string]bool{}
+	for _, r := range roots {
+		seen[r.Name] = true
+	}
+	for len(queue) > 0 {
+		meta := queue[0]
+		queue = queue[1:]
+		addNode(GraphNode{Name: meta.Name, Version: meta.Version})
+
+		for _, dep := range meta.Dependencies {
+			rel, err := ParseRelation(dep)
+			if err != nil {
+				continue
+			}
+			target := rel.Name
+			if provider, ok := satisfiedAmong(roots, rel); ok {
+				target = provider.Name
+			} else if idx != nil {
+				entry, ok := idx.bestCandidate(rel)
+				if !ok {
+					addNode(GraphNode{Name: rel.Name, Missing: true})
+				} else {
+					resolved := MetadataFromMap(entry.Metadata)
+					target = resolved.Name
+					if !seen[target] {
+						seen[target] = true
+						queue = append(queue, resolved)
+					}
+				}
+			} else {
+				addNode(GraphNode{Name: rel.Name})
+			}
+			g.Edges = append(g.Edges, GraphEdge{From: meta.Name, To: target, Dependency: dep})
+		}
+	}
+
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, *n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Name < g.Nodes[j].Name })
+	g.Cycles = findCycles(g)
+	return g
+}
+
+func satisfiedAmong(pkgs []MetadataV2, rel Relation) (MetadataV2, bool) {
+	for _, m := range pkgs {
+		if satisfiesRelation(m, rel) {
+			return m, true
+		}
+	}
+	return MetadataV2{}, false
+}
+
+// findCycles returns the strongly connected components that contain a
+// cycle, using Tarjan's algorithm.
+func findCycles(g *DepGraph) [][]string {
+	adj := map[string][]string{}
+	selfLoop := map[string]bool{}
+	for _, e := range g.Edges {
+		adj[e.From] = append(adj[e.From], e.To)
+		if e.From == e.To {
+			selfLoop[e.From] = true
+		}
+	}
+
+	index := map[string]int{}
+	low := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var cycles [][]string
+	counter := 0
+
+	var strongConnect func(v string)
+	strongConnect = func(v string) {
+		index[v] = counter
+		low[v] = counter
+		counter++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range adj[v] {
+			if _, visited := index[w]; !visited {
+				strongConnect(w)
+				low[v] = min(low[v], low[w])
+			} else if onStack[w] {
+				low[v] = min(low[v], index[w])
+			}
+		}
+
+		if low[v] == index[v] {
+			var scc []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				scc = append(scc, w)
+				if w == v {
+					break
+				}
+			}
+			if len(scc) > 1 || selfLoop[v] {
+				sort.Strings(scc)
+				cycles = append(cycles, scc)
+			}
+		}
+	}
+
+	for _, n := range g.Nodes {
+		if _, visited := index[n.Name]; !visited {
+			strongConnect(n.Name)
+		}
+	}
+	if cycles == nil {
+		return [][]string{}
+	}
+	return cycles
+}
+
+func (g *DepGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph dependencies {\n")
+	for _, n := range g.Nodes {
+		label := n.Name
+		if n.Version != "" {
+			label += "\n" + n.Version
+		}
+		style := ""
+		if n.Missing {
+			style = ", style=dashed, color=red"
+		}
+		fmt.Fprintf(&b, "  %q [label=%q%s];\n", n.Name, label, style)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %q -> %q [label=%q];\n", e.From, e.To, e.Dependency)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
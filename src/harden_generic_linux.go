@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux && (arm64 || riscv64)
+
+package checker
+
+// arm64 and riscv64 share the generic syscall table.
+const (
+	sysSeccomp  = 277
+	sysClone    = 220
+	x32Syscalls = 0
+)
+
+// deniedSyscalls are the syscalls Harden fails with EPERM.
+var deniedSyscalls = []uint32{
+	221, 281, // execve, execveat
+	117, 270, 271, // ptrace, process_vm_readv, process_vm_writev
+	198, 199, 200, 201, 202, 203, 242, // socket, socketpair, bind, listen, accept, connect, accept4
+	40, 39, 41, 51, 97, 268, // mount, umount2, pivot_root, chroot, unshare, setns
+	104, 294, 105, 273, 106, 142, // kexec_load, kexec_file_load, init_module, finit_module, delete_module, reboot
+	224, 225, 89, // swapon, swapoff, acct
+	280, 241, 282, 262, // bpf, perf_event_open, userfaultfd, fanotify_init
+	217, 218, 219, // add_key, request_key, keyctl
+	170, 112, 161, 162, // settimeofday, clock_settime, sethostname, setdomainname
+	264, 265, // name_to_handle_at, open_by_handle_at
+	435, 438, // clone3, pidfd_getfd
+	425, 426, 427, // io_uring_setup, io_uring_enter, io_uring_register
+	428, 429, 430, 431, 432, 433, 442, // open_tree, move_mount, fsopen, fsconfig, fsmount, fspick, mount_setattr
+}
@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux && (amd64 || arm64 || riscv64)
+
+package checker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// ErrNoLandlock is returned by Harden when Landlock cannot be used, either
+// because the kernel lacks it or because the binary was built with cgo. The
+// seccomp filter is still installed.
+var ErrNoLandlock = errors.New("landlock is unavailable")
+
+// Harden restricts the current process for the rest of its life. Landlock
+// leaves the filesystem read-only except below the writable directories,
+// and a seccomp filter denies the syscalls apgcheck never needs, such as
+// execve, sockets, mount, io_uring, ptrace and clone into new namespaces,
+// so a subverted extractor can do little beyond reading files.
+func Harden(writable []string) error {
+	_, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0)
+	if errno == syscall.ENOTSUP {
+		// cgo builds cannot change all threads at once. The seccomp filter
+		// passes no_new_privs on to the other threads when it syncs them.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		_, _, errno = syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0)
+	}
+	if errno != 0 {
+		return fmt.Errorf("set no_new_privs: %w", errno)
+	}
+	landlockErr := restrictPaths(writable)
+	if landlockErr != nil && !errors.Is(landlockErr, ErrNoLandlock) {
+		return landlockErr
+	}
+	if err := filterSyscalls(); err != nil {
+		return err
+	}
+	return landlockErr
+}
+
+const (
+	prSetNoNewPrivs = 38
+	oPath           = 0x200000
+
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+
+	accessExecute    = 1 << 0
+	accessWriteFile  = 1 << 1
+	accessReadFile   = 1 << 2
+	accessReadDir    = 1 << 3
+	accessRemoveDir  = 1 << 4
+	accessRemoveFile = 1 << 5
+	accessMakeChar   = 1 << 6
+	accessMakeDir    = 1 << 7
+	accessMakeReg    = 1 << 8
+	accessMakeSock   = 1 << 9
+	accessMakeFifo   = 1 << 10
+	accessMakeBlock  = 1 << 11
+	accessMakeSym    = 1 << 12
+	accessRefer      = 1 << 13
+	accessTruncate   = 1 << 14
+)
+
+// restrictPaths installs a Landlock ruleset allowing reads everywhere and
+// writes only below the writable directories.
+func restrictPaths(writable []string) error {
+	abi, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		if errno == syscall.ENOSYS || errno == syscall.EOPNOTSUPP {
+			return fmt.Errorf("%w in this kernel", ErrNoLandlock)
+		}
+		return fmt.Errorf("landlock: %w", errno)
+	}
+
+	handled := uint64(accessExecute | accessWriteFile | accessReadFile | accessReadDir |
+		accessRemoveDir | accessRemoveFile | accessMakeChar | accessMakeDir | accessMakeReg |
+		accessMakeSock | accessMakeFifo | accessMakeBlock | accessMakeSym)
+	if abi >= 2 {
+		handled |= accessRefer
+	}
+	if abi >= 3 {
+		handled |= accessTruncate
+	}
+	read := uint64(accessReadFile | accessReadDir)
+	write := handled &^ (accessExecute | accessMakeChar | accessMakeBlock)
+
+	attr := handled
+	fd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock: create ruleset: %w", errno)
+	}
+	ruleset := int(fd)
+	defer syscall.Close(ruleset)
+
+	if err := allowBeneath(ruleset, "/", read); err != nil {
+		return err
+	}
+	for _, dir := range writable {
+		if dir == "" {
+			continue
+		}
+		if err := allowBeneath(ruleset, existingAncestor(dir), write); err != nil {
+			return err
+		}
+	}
+
+	_, _, errno = syscall.AllThreadsSyscall(sysLandlockRestrictSelf, uintptr(ruleset), 0, 0)
+	if errno == syscall.ENOTSUP {
+		return fmt.Errorf("%w in builds with cgo", ErrNoLandlock)
+	}
+	if errno != 0 {
+		return fmt.Errorf("landlock: restrict self: %w", errno)
+	}
+	return nil
+}
+
+// allowBeneath grants access to everything below path.
+func allowBeneath(ruleset int, path string, access uint64) error {
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("landlock: %s: %w", path, err)
+	}
+	defer syscall.Close(fd)
+
+	// struct landlock_path_beneath_attr is packed: a u64 and an s32.
+	var attr [12]byte
+	binary.NativeEndian.PutUint64(attr[0:], access)
+	binary.NativeEndian.PutUint32(attr[8:], uint32(fd))
+	if _, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(ruleset), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock: %s: %w", path, errno)
+	}
+	return nil
+}
+
+// existingAncestor returns dir, or its closest existing parent when dir is
+// yet to be created.
+func existingAncestor(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+const (
+	bpfLd   = 0x00
+	bpfW    = 0x00
+	bpfAbs  = 0x20
+	bpfJmp  = 0x05
+	bpfJeq  = 0x10
+	bpfJge  = 0x30
+	bpfJset = 0x40
+	bpfK    = 0x00
+	bpfRet  = 0x06
+
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+
+	// Offsets of nr, arch and the low half of the first argument in
+	// struct seccomp_data, on little-endian machines.
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArg0 = 16
+
+	// cloneNamespaces are the clone flags that create namespaces:
+	// CLONE_NEWNS, CLONE_NEWCGROUP, CLONE_NEWUTS, CLONE_NEWIPC,
+	// CLONE_NEWUSER, CLONE_NEWPID and CLONE_NEWNET.
+	cloneNamespaces = 0x7e020000
+)
+
+// filterSyscalls installs a seccomp filter on every thread that fails the
+// syscalls in deniedSyscalls and clone with namespace flags with EPERM, and
+// kills the process on a foreign syscall ABI. clone3 passes its flags in
+// memory the filter cannot read, so it is denied outright; the Go runtime
+// starts threads with clone.
+func filterSyscalls() error {
+	deny := uint8(len(deniedSyscalls))
+	if x32Syscalls != 0 {
+		deny++
+	}
+
+	prog := []syscall.SockFilter{
+		{Code: bpfLd | bpfW | bpfAbs, K: seccompDataArch},
+		{Code: bpfJmp | bpfJeq | bpfK, Jt: 1, K: auditArch},
+		{Code: bpfRet | bpfK, K: seccompRetKillProcess},
+		{Code: bpfLd | bpfW | bpfAbs, K: seccompDataNr},
+		{Code: bpfJmp | bpfJeq | bpfK, Jf: 4, K: sysClone},
+		{Code: bpfLd | bpfW | bpfAbs, K: seccompDataArg0},
+		{Code: bpfJmp | bpfJset | bpfK, Jf: 1, K: cloneNamespaces},
+		{Code: bpfRet | bpfK, K: seccompRetErrno | uint32(syscall.EPERM)},
+		{Code: bpfRet | bpfK, K: seccompRetAllow},
+	}
+	if x32Syscalls != 0 {
+		prog = append(prog, syscall.SockFilter{Code: bpfJmp | bpfJge | bpfK, Jt: deny, K: x32Syscalls})
+		deny--
+	}
+	for _, nr := range deniedSyscalls {
+		prog = append(prog, syscall.SockFilter{Code: bpfJmp | bpfJeq | bpfK, Jt: deny, K: nr})
+		deny--
+	}
+	prog = append(prog,
+		syscall.SockFilter{Code: bpfRet | bpfK, K: seccompRetAllow},
+		syscall.SockFilter{Code: bpfRet | bpfK, K: seccompRetErrno | uint32(syscall.EPERM)},
+	)
+
+	fprog := syscall.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	if _, _, errno := syscall.Syscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&fprog))); errno != 0 {
+		return fmt.Errorf("seccomp: %w", errno)
+	}
+	return nil
+}
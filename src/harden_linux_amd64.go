@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+const (
+	auditArch   = 0xc000003e // AUDIT_ARCH_X86_64
+	sysSeccomp  = 317
+	sysClone    = 56
+	x32Syscalls = 0x40000000
+)
+
+// deniedSyscalls are the syscalls Harden fails with EPERM.
+var deniedSyscalls = []uint32{
+	57, 58, 59, 322, // fork, vfork, execve, execveat
+	101, 310, 311, // ptrace, process_vm_readv, process_vm_writev
+	41, 42, 43, 49, 50, 53, 288, // socket, connect, accept, bind, listen, socketpair, accept4
+	165, 166, 155, 161, 272, 308, // mount, umount2, pivot_root, chroot, unshare, setns
+	246, 320, 175, 313, 176, 169, // kexec_load, kexec_file_load, init_module, finit_module, delete_module, reboot
+	167, 168, 163, 172, 173, // swapon, swapoff, acct, iopl, ioperm
+	321, 298, 323, 300, // bpf, perf_event_open, userfaultfd, fanotify_init
+	248, 249, 250, // add_key, request_key, keyctl
+	164, 227, 170, 171, // settimeofday, clock_settime, sethostname, setdomainname
+	303, 304, // name_to_handle_at, open_by_handle_at
+	435, 438, // clone3, pidfd_getfd
+	425, 426, 427, // io_uring_setup, io_uring_enter, io_uring_register
+	428, 429, 430, 431, 432, 433, 442, // open_tree, move_mount, fsopen, fsconfig, fsmount, fspick, mount_setattr
+}
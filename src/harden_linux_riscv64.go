@@ -0,0 +1,6 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+const auditArch = 0xc00000f3 // AUDIT_ARCH_RISCV64
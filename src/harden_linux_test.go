@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux && (amd64 || arm64 || riscv64)
+
+package checker
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+// TestHardenFiltersSyscalls hardens a child process, since the filter
+// cannot be lifted again, and checks which syscalls it fails.
+func TestHardenFiltersSyscalls(t *testing.T) {
+	if os.Getenv("APGCHECK_TEST_HARDEN") == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHardenFiltersSyscalls$", "-test.v")
+		cmd.Env = append(os.Environ(), "APGCHECK_TEST_HARDEN=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("hardened child failed: %v\n%s", err, out)
+		}
+		return
+	}
+
+	if err := Harden(nil); err != nil && !errors.Is(err, ErrNoLandlock) {
+		t.Fatal(err)
+	}
+	denied := []struct {
+		name string
+		nr   uintptr
+		args [3]uintptr
+	}{
+		{"io_uring_setup", 425, [3]uintptr{1, 0, 0}},
+		{"fsopen", 430, [3]uintptr{0, 0, 0}},
+		{"open_tree", 428, [3]uintptr{0, 0, 0}},
+		{"clone3", 435, [3]uintptr{0, 0, 0}},
+		{"clone with CLONE_NEWUSER", sysClone, [3]uintptr{syscall.CLONE_NEWUSER | uintptr(syscall.SIGCHLD), 0, 0}},
+		{"clone with CLONE_NEWNET", sysClone, [3]uintptr{syscall.CLONE_NEWNET | uintptr(syscall.SIGCHLD), 0, 0}},
+	}
+	for _, d := range denied {
+		pid, _, errno := syscall.RawSyscall(d.nr, d.args[0], d.args[1], d.args[2])
+		if errno == 0 && pid == 0 && d.nr == sysClone {
+			syscall.RawSyscall(syscall.SYS_EXIT_GROUP, 0, 0, 0)
+		}
+		if errno != syscall.EPERM {
+			t.Errorf("%s: errno %v, want EPERM", d.name, errno)
+		}
+	}
+
+	// Goroutines on new threads and plain file reads still work.
+	done := make(chan bool)
+	go func() { done <- true }()
+	<-done
+	if _, err := os.ReadFile("/proc/self/status"); err != nil {
+		t.Error(err)
+	}
+}
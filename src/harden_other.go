@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !linux || !(amd64 || arm64 || riscv64)
+
+package checker
+
+import "errors"
+
+var ErrNoLandlock = errors.New("landlock is unavailable")
+
+func Harden(writable []string) error {
+	return errors.New("hardening is only supported on Linux (amd64, arm64, riscv64)")
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// mmapThreshold is the size from which files are hashed through a memory
+// mapping instead of being read, which saves copying every byte through a
+// buffer on multi-gigabyte payloads.
+const mmapThreshold = 64 << 20
+
+// newHash returns the hash for a checksum algorithm name, in either case,
+// or nil for an unknown one.
+func newHash(algo string) hash.Hash {
+	switch algo {
+	case "md5", "MD5":
+		return md5.New()
+	case "crc32", "CRC32":
+		return crc32.NewIEEE()
+	case "sha256", "SHA256":
+		return sha256.New()
+	case "sha512", "SHA512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// hashFile writes the content of a file to w, mapping large files into
+// memory where the platform allows and streaming the rest.
+func hashFile(file string, w io.Writer) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() && fi.Size() >= mmapThreshold {
+		if data, unmap, err := mapFile(f, fi.Size()); err == nil {
+			defer unmap()
+			_, err = w.Write(data)
+			return err
+		}
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,23 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps a file read-only and tells the kernel it is read once,
+// front to back.
+func mapFile(f *os.File, size int64) ([]byte, func(), error) {
+	if int64(int(size)) != size {
+		return nil, nil, syscall.EFBIG
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	syscall.Madvise(data, syscall.MADV_SEQUENTIAL)
+	return data, func() { syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,15 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !linux
+
+package checker
+
+import (
+	"errors"
+	"os"
+)
+
+func mapFile(f *os.File, size int64) ([]byte, func(), error) {
+	return nil, nil, errors.New("memory mapping is unavailable")
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testEntry is an archive entry for tarBytes. A link makes it a symlink,
+// unless typ says otherwise; without either it is a regular file.
+type testEntry struct {
+	name, body, link string
+	typ              byte
+	mode             int64
+}
+
+func tarBytes(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: e.mode, Linkname: e.link, Typeflag: e.typ}
+		if h.Mode == 0 {
+			h.Mode = 0644
+		}
+		if h.Typeflag == 0 {
+			h.Typeflag = tar.TypeReg
+			if e.link != "" {
+				h.Typeflag = tar.TypeSymlink
+			}
+		}
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeTar writes an uncompressed package, which apgcheck reads like an
+// xz-compressed one, and returns its path.
+func writeTar(t *testing.T, dir, name string, entries ...testEntry) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, tarBytes(t, entries...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testChecker(t *testing.T) *Checker {
+	t.Helper()
+	c := New(false, false, Colors{}, 1024)
+	c.TempDir = t.TempDir()
+	return c
+}
+
+// assertEmpty fails if a package wrote anything into dir.
+func assertEmpty(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("%s was written outside the extraction directory", filepath.Join(dir, e.Name()))
+	}
+}
@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// localeCode matches POSIX (pt_BR, sr_RS@latin) and BCP 47 (pt-BR,
+// zh-Hans) style locale codes: a language, an optional script and region,
+// and an optional modifier.
+var localeCode = regexp.MustCompile(`^[a-z]{2,3}(?:[_-][A-Z][a-z]{3})?(?:[_-](?:[A-Z]{2}|[0-9]{3}))?(?:@[a-z0-9]+)?$`)
+
+// validateDescriptions checks the optional description_i18n map of
+// translated descriptions, keyed by locale.
+func validateDescriptions(descriptions map[string]string) error {
+	for _, locale := range slices.Sorted(maps.Keys(descriptions)) {
+		text := descriptions[locale]
+		if !localeCode.MatchString(locale) {
+			return fmt.Errorf("invalid description_i18n: '%s' is not a locale code such as 'de' or 'pt_BR'", locale)
+		}
+		if strings.TrimSpace(text) == "" {
+			return fmt.Errorf("invalid description_i18n: empty translation for '%s'", locale)
+		}
+		// encoding/json replaces invalid UTF-8 and lone surrogates with
+		// U+FFFD instead of failing.
+		if !utf8.ValidString(text) || strings.ContainsRune(text, utf8.RuneError) {
+			return fmt.Errorf("invalid description_i18n: translation for '%s' is not valid UTF-8", locale)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// imageMagic are the signatures of the image formats software centers
+// display.
+var imageMagic = []struct {
+	format string
+	magic  []byte
+}{
+	{"PNG", []byte("\x89PNG\r\n\x1a\n")},
+	{"JPEG", []byte("\xff\xd8\xff")},
+	{"GIF", []byte("GIF87a")},
+	{"GIF", []byte("GIF89a")},
+	{"ICO", []byte("\x00\x00\x01\x00")},
+	{"XPM", []byte("/* XPM */")},
+	{"SVGZ", []byte("\x1f\x8b")},
+}
+
+// imageFormat names the format of an image from its first bytes, or returns
+// "" when it is not one apgcheck recognizes.
+func imageFormat(head []byte) string {
+	for _, m := range imageMagic {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.format
+		}
+	}
+	if len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WEBP")) {
+		return "WebP"
+	}
+	text := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if bytes.HasPrefix(text, []byte("<")) && bytes.Contains(text, []byte("<svg")) {
+		return "SVG"
+	}
+	return ""
+}
+
+// validateImages checks the icons or screenshots listed in metadata: URLs
+// must be well-formed http(s) URLs, and paths must name an image installed
+// by one of the data trees.
+func validateImages(dir, field string, refs []string) error {
+	for _, ref := range refs {
+		if strings.Contains(ref, "://") {
+			u, err := url.Parse(ref)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid %s entry '%s': not a well-formed http(s) URL", field, ref)
+			}
+			continue
+		}
+		if !path.IsAbs(ref) || path.Clean(ref) != ref {
+			return fmt.Errorf("invalid %s entry '%s': expected a URL or an absolute installed path", field, ref)
+		}
+		found := false
+		for _, tree := range dataTrees(dir) {
+			file := filepath.Join(dir, tree, filepath.FromSlash(ref))
+			fi, err := os.Stat(file)
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			found = true
+			if imageFormat(fileHead(file, 1024)) == "" {
+				return fmt.Errorf("invalid %s entry '%s': not a PNG, JPEG, GIF, WebP, SVG, ICO or XPM image", field, ref)
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid %s entry '%s': file not found in the package", field, ref)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"fmt"
+	"sort"
+)
+
+type ReverseDependency struct {
+	Package    string `json:"package"`
+	Version    string `json:"version"`
+	Dependency string `json:"dependency"`
+	Broken     bool   `json:"broken"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+type ImpactReport struct {
+	Package             string              `json:"package"`
+	Version             string              `json:"version"`
+	PublishedVersion    string              `json:"published_version,omitempty"`
+	RemovedProvides     []string            `json:"removed_provides"`
+	ReverseDependencies []ReverseDependency `json:"reverse_dependencies"`
+}
+
+func (r *ImpactReport) Broken() bool {
+	for _, rd := range r.ReverseDependencies {
+		if rd.Broken {
+			return true
+		}
+	}
+	return false
+}
+
+func (idx *RepoIndex) Impact(candidate MetadataV2) *ImpactReport {
+	report := &ImpactReport{
+		Package:             candidate.Name,
+		Version:             candidate.Version,
+		RemovedProvides:     []string{},
+		ReverseDependencies: []ReverseDependency{},
+	}
+
+	var others []MetadataV2
+	oldProvides := map[string]bool{}
+	for _, entry := range idx.Packages {
+		meta := MetadataFromMap(entry.Metadata)
+		if meta.Name != candidate.Name {
+			others = append(others, meta)
+			continue
+		}
+		report.PublishedVersion = meta.Version
+		for _, p := range meta.Provides {
+			if rel, err := ParseRelation(p); err == nil {
+				oldProvides[rel.Name] = true
+			}
+		}
+	}
+
+	newProvides := map[string]bool{}
+	for _, p := range candidate.Provides {
+		if rel, err := ParseRelation(p); err == nil {
+			newProvides[rel.Name] = true
+		}
+	}
+	for name := range oldProvides {
+		if !newProvides[name] {
+			report.RemovedProvides = append(report.RemovedProvides, name)
+		}
+	}
+	sort.Strings(report.RemovedProvides)
+
+	for _, meta := range others {
+		for _, dep := range meta.Dependencies {
+			rel, err := ParseRelation(dep)
+			if err != nil || (rel.Name != candidate.Name && !oldProvides[rel.Name] && !newProvides[rel.Name]) {
+				continue
+			}
+			rd := ReverseDependency{Package: meta.Name, Version: meta.Version, Dependency: dep}
+			if !satisfiesRelation(candidate, rel) && !satisfiedByAny(others, rel) {
+				rd.Broken = true
+				if rel.Name == candidate.Name {
+					rd.Reason = fmt.Sprintf("version %s does not satisfy '%s'", candidate.Version, dep)
+				} else {
+					rd.Reason = fmt.Sprintf("'%s' is no longer provided", rel.Name)
+				}
+			}
+			report.ReverseDependencies = append(report.ReverseDependencies, rd)
+		}
+	}
+	return report
+}
+
+func satisfiedByAny(pkgs []MetadataV2, rel Relation) bool {
+	for _, meta := range pkgs {
+		if satisfiesRelation(meta, rel) {
+			return true
+		}
+	}
+	return false
+}
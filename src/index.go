@@ -0,0 +1,235 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+type IndexEntry struct {
+	Filename   string                 `json:"filename"`
+	Size       int64                  `json:"size"`
+	SHA256     string                 `json:"sha256"`
+	APGVersion int                    `json:"apg_version"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Files      []string               `json:"files,omitempty"`
+}
+
+type RepoIndex struct {
+	Packages []IndexEntry `json:"packages"`
+}
+
+type IndexReport struct {
+	Valid         bool                 `json:"valid"`
+	Packages      []ValidationResponse `json:"packages"`
+	FileConflicts []FileConflict       `json:"file_conflicts"`
+}
+
+func LoadIndex(path string) (*RepoIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	var idx RepoIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("index invalid JSON: %w", err)
+	}
+	return &idx, nil
+}
+
+func (c *Checker) BuildIndex(dir string, apgVersion int) (*RepoIndex, []ValidationResponse, []FileConflict, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	idx := &RepoIndex{Packages: []IndexEntry{}}
+	var rejected []ValidationResponse
+	var contents []PackageFiles
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".apg" {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		c.log(fmt.Sprintf("Indexing %s...", e.Name()))
+
+		report, err := c.ValidateFile(path, apgVersion)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("extraction error: %v", err))
+			report.annotate()
+		}
+		if !report.Valid {
+			rejected = append(rejected, report)
+			continue
+		}
+
+		digest, size, err := fileSHA256(path)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to hash %s: %w", e.Name(), err)
+		}
+		idx.Packages = append(idx.Packages, IndexEntry{
+			Filename:   e.Name(),
+			Size:       size,
+			SHA256:     digest,
+			APGVersion: report.Version,
+			Metadata:   report.Metadata,
+			Files:      report.Files,
+		})
+		contents = append(contents, NewPackageFiles(report.Metadata, report.Files))
+	}
+
+	c.log("Checking for file conflicts between packages...")
+	return idx, rejected, DetectFileConflicts(contents), nil
+}
+
+func (c *Checker) VerifyIndex(indexPath string) (*IndexReport, error) {
+	idx, err := LoadIndex(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	baseDir := filepath.Dir(indexPath)
+
+	report := &IndexReport{
+		Valid:         true,
+		Packages:      []ValidationResponse{},
+		FileConflicts: []FileConflict{},
+	}
+	var contents []PackageFiles
+	for _, entry := range idx.Packages {
+		c.log(fmt.Sprintf("Verifying %s...", entry.Filename))
+		result := c.verifyIndexEntry(baseDir, entry)
+		if result.Valid {
+			contents = append(contents, NewPackageFiles(result.Metadata, result.Files))
+		} else {
+			report.Valid = false
+		}
+		report.Packages = append(report.Packages, result)
+	}
+
+	c.log("Checking for file conflicts between packages...")
+	if conflicts := DetectFileConflicts(contents); len(conflicts) > 0 {
+		report.FileConflicts = conflicts
+		report.Valid = false
+	}
+	return report, nil
+}
+
+func (c *Checker) verifyIndexEntry(baseDir string, entry IndexEntry) ValidationResponse {
+	apgVersion := entry.APGVersion
+	if apgVersion == 0 {
+		apgVersion = 1
+	}
+	path := entry.Filename
+	if filepath.IsLocal(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	fail := func(format string, a ...interface{}) ValidationResponse {
+		report := ValidationResponse{
+			Version:  apgVersion,
+			File:     path,
+			Errors:   []string{fmt.Sprintf(format, a...)},
+			Warnings: []string{},
+		}
+		report.annotate()
+		return report
+	}
+	// The index is untrusted: a filename must not reach outside its
+	// directory.
+	if !filepath.IsLocal(entry.Filename) {
+		return fail("index filename is not a path within the index directory: %s", entry.Filename)
+	}
+
+	digest, size, err := fileSHA256(path)
+	if err != nil {
+		return fail("referenced package missing or unreadable: %s", entry.Filename)
+	}
+	if size != entry.Size {
+		return fail("index size mismatch for %s, expected: %d, got: %d", entry.Filename, entry.Size, size)
+	}
+	if digest != entry.SHA256 {
+		return fail("index SHA256 mismatch for %s, expected: %s, got: %s", entry.Filename, entry.SHA256, digest)
+	}
+
+	report, err := c.ValidateFile(path, apgVersion)
+	if err != nil {
+		return fail("extraction error: %v", err)
+	}
+	if !report.Valid {
+		return report
+	}
+
+	if diff := diffMetadata(entry.Metadata, report.Metadata); len(diff) > 0 {
+		report.Errors = append(report.Errors, fmt.Sprintf("index metadata differs from package metadata in fields: %v", diff))
+		report.Valid = false
+	}
+	if entry.Files != nil && !reflect.DeepEqual(entry.Files, report.Files) {
+		report.Errors = append(report.Errors, "index file list differs from package contents")
+		report.Valid = false
+	}
+	report.annotate()
+	return report
+}
+
+func diffMetadata(indexed, actual map[string]interface{}) []string {
+	keys := map[string]bool{}
+	for k := range indexed {
+		keys[k] = true
+	}
+	for k := range actual {
+		keys[k] = true
+	}
+
+	var diff []string
+	for k := range keys {
+		if !reflect.DeepEqual(indexed[k], actual[k]) {
+			diff = append(diff, k)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), size, nil
+}
+
+func (c *Checker) checkVersionRegression(meta MetadataV2) []string {
+	defer c.track("check:version-regression")()
+	var errs []string
+	for _, entry := range c.RepoIndex.Packages {
+		published := MetadataFromMap(entry.Metadata)
+		if published.Name != meta.Name {
+			continue
+		}
+		if published.Architecture != nil && meta.Architecture != nil && *published.Architecture != *meta.Architecture {
+			continue
+		}
+		c.log(fmt.Sprintf("Comparing against published %s %s...", published.Name, published.Version))
+		switch cmp := CompareVersions(meta.Version, published.Version); {
+		case cmp < 0:
+			errs = append(errs, fmt.Sprintf("version regression: %s is lower than published version %s", meta.Version, published.Version))
+		case cmp == 0:
+			errs = append(errs, fmt.Sprintf("version %s is already published, bump the version or revision", meta.Version))
+		}
+	}
+	return errs
+}
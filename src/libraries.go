@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// reportAs files a finding as an error or a warning, or only logs it, as a
+// packaging policy setting asks.
+func (c *Checker) reportAs(action, message string, report *ValidationResponse) {
+	switch action {
+	case "error":
+		report.Errors = append(report.Errors, message)
+	case "warn":
+		report.Warnings = append(report.Warnings, message)
+	default:
+		c.log("Ignoring " + message)
+	}
+}
+
+// isDevPackage reports whether a package is meant to carry headers and
+// static libraries.
+func isDevPackage(name string) bool {
+	return strings.HasSuffix(name, "-dev") || strings.HasSuffix(name, "-devel") || strings.HasSuffix(name, "-static")
+}
+
+// payloadFiles calls fn with the installed path and location on disk of
+// every regular file in the data trees, until ctx is cancelled.
+func payloadFiles(ctx context.Context, dir string, fn func(installed, file string)) {
+	for _, tree := range dataTrees(dir) {
+		root := filepath.Join(dir, tree)
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return filepath.SkipAll
+			}
+			if err != nil || !d.Type().IsRegular() {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, p)
+			fn("/"+filepath.ToSlash(rel), p)
+			return nil
+		})
+	}
+}
+
+// fileHead returns up to n bytes from the start of a file.
+func fileHead(file string, n int) []byte {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	head := make([]byte, n)
+	read, _ := io.ReadFull(f, head)
+	return head[:read]
+}
+
+// checkStaticLibraries reports static libraries shipped outside development
+// packages, which belong in a -dev split.
+func (c *Checker) checkStaticLibraries(ctx context.Context, dir string, meta MetadataV2, report *ValidationResponse) {
+	if isDevPackage(meta.Name) {
+		return
+	}
+	payloadFiles(ctx, dir, func(installed, file string) {
+		if strings.HasSuffix(installed, ".a") && bytes.Equal(fileHead(file, 8), []byte("!<arch>\n")) {
+			c.reportAs(c.Policy.Packaging.StaticLibraries, fmt.Sprintf("static library in a non-development package: %s", installed), report)
+		}
+	})
+}
+
+// bundledLibraries are system libraries that packages commonly carry
+// private copies of, keyed by the soname stem.
+var bundledLibraries = map[string]string{
+	"libssl":        "OpenSSL",
+	"libcrypto":     "OpenSSL",
+	"libgnutls":     "GnuTLS",
+	"libz":          "zlib",
+	"libcurl":       "curl",
+	"libpng16":      "libpng",
+	"libjpeg":       "libjpeg",
+	"libxml2":       "libxml2",
+	"libsqlite3":    "SQLite",
+	"libexpat":      "Expat",
+	"libbz2":        "bzip2",
+	"liblzma":       "xz",
+	"libzstd":       "zstd",
+	"libffi":        "libffi",
+	"libpcre2-8":    "PCRE2",
+	"libfreetype":   "FreeType",
+	"libstdc++":     "libstdc++",
+	"libgcc_s":      "libgcc",
+	"libnss3":       "NSS",
+	"libarchive":    "libarchive",
+	"libyaml-0":     "libyaml",
+	"libuv":         "libuv",
+	"libnghttp2":    "nghttp2",
+	"libssh2":       "libssh2",
+	"libgcrypt":     "libgcrypt",
+	"libtiff":       "libtiff",
+	"libwebp":       "libwebp",
+	"libicuuc":      "ICU",
+	"libicudata":    "ICU",
+	"libharfbuzz":   "HarfBuzz",
+	"libfontconfig": "Fontconfig",
+}
+
+// systemLibraryDirs are where the distribution's own libraries live; a copy
+// anywhere else is private to the package.
+var systemLibraryDirs = []string{"/lib", "/lib64", "/usr/lib", "/usr/lib64", "/usr/local/lib"}
+
+// libraryStem returns the part of a shared library name before ".so", or
+// "" if the name is not a shared library.
+func libraryStem(name string) string {
+	stem, rest, ok := strings.Cut(name, ".so")
+	if !ok || (rest != "" && rest[0] != '.') {
+		return ""
+	}
+	return stem
+}
+
+// checkBundledLibraries reports private copies of common system libraries,
+// which do not receive the distribution's security updates.
+func (c *Checker) checkBundledLibraries(ctx context.Context, dir string, report *ValidationResponse) {
+	payloadFiles(ctx, dir, func(installed, file string) {
+		project, ok := bundledLibraries[libraryStem(path.Base(installed))]
+		if !ok || slices.Contains(systemLibraryDirs, path.Dir(installed)) {
+			return
+		}
+		if !bytes.HasPrefix(fileHead(file, 4), []byte("\x7fELF")) {
+			return
+		}
+		c.reportAs(c.Policy.Packaging.BundledLibraries, fmt.Sprintf("bundled copy of a system library (%s): %s", project, installed), report)
+	})
+}
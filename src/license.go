@@ -0,0 +1,304 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var licenseToken = regexp.MustCompile(`\(|\)|[^\s()]+`)
+
+// licenseAlternatives expands an SPDX license expression into the sets of
+// licenses that may be chosen to comply with it, e.g. "MIT OR (GPL-2.0-only
+// AND BSD-3-Clause)" into [[MIT] [GPL-2.0-only BSD-3-Clause]]. A license
+// with an exception is kept as one term, "GPL-2.0-only WITH
+// Classpath-exception-2.0".
+func licenseAlternatives(expr string) ([][]string, error) {
+	p := &licenseParser{tokens: licenseToken.FindAllString(expr, -1)}
+	alts, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected '%s'", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid license expression '%s': %w", expr, err)
+	}
+	return alts, nil
+}
+
+type licenseParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *licenseParser) next() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *licenseParser) or() ([][]string, error) {
+	alts, err := p.and()
+	for err == nil && strings.EqualFold(p.next(), "OR") {
+		p.pos++
+		var more [][]string
+		more, err = p.and()
+		alts = append(alts, more...)
+	}
+	return alts, err
+}
+
+func (p *licenseParser) and() ([][]string, error) {
+	alts, err := p.term()
+	for err == nil && strings.EqualFold(p.next(), "AND") {
+		p.pos++
+		var right [][]string
+		if right, err = p.term(); err != nil {
+			break
+		}
+		var product [][]string
+		for _, l := range alts {
+			for _, r := range right {
+				product = append(product, append(append([]string{}, l...), r...))
+			}
+		}
+		alts = product
+	}
+	return alts, err
+}
+
+func (p *licenseParser) term() ([][]string, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end")
+	case tok == "(":
+		p.pos++
+		alts, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return alts, nil
+	case tok == ")" || strings.EqualFold(tok, "AND") || strings.EqualFold(tok, "OR") || strings.EqualFold(tok, "WITH"):
+		return nil, fmt.Errorf("unexpected '%s'", tok)
+	}
+	p.pos++
+	if strings.EqualFold(p.next(), "WITH") {
+		p.pos++
+		exception := p.next()
+		if exception == "" || exception == "(" || exception == ")" {
+			return nil, fmt.Errorf("missing exception after WITH")
+		}
+		p.pos++
+		tok += " WITH " + exception
+	}
+	return [][]string{{tok}}, nil
+}
+
+func isProprietary(license string) bool {
+	return strings.EqualFold(license, "Proprietary") || strings.EqualFold(license, "Commercial") ||
+		strings.HasPrefix(strings.ToLower(license), "licenseref-proprietary")
+}
+
+// licensesConflict reports the well-known cases in which a program under
+// license a may not link a library under license b: proprietary programs
+// and GPL or AGPL libraries, and GPLv2-only programs and libraries under
+// Apache-2.0 or version 3 of the GNU licenses. Licenses with exceptions,
+// such as linking exceptions, never conflict.
+func licensesConflict(a, b string) bool {
+	if strings.Contains(a, " WITH ") || strings.Contains(b, " WITH ") {
+		return false
+	}
+	switch {
+	case isProprietary(a):
+		return strings.HasPrefix(b, "GPL-") || strings.HasPrefix(b, "AGPL-")
+	case a == "GPL-2.0-only" || a == "GPL-2.0":
+		return b == "Apache-2.0" || strings.HasPrefix(b, "GPL-3.0") || strings.HasPrefix(b, "LGPL-3.0") || strings.HasPrefix(b, "AGPL-3.0")
+	}
+	return false
+}
+
+// licensesCompatible reports whether some choice of licenses from each
+// expression avoids every conflict.
+func licensesCompatible(pkg, lib [][]string) bool {
+	for _, a := range pkg {
+		for _, b := range lib {
+			conflict := false
+			for _, x := range a {
+				for _, y := range b {
+					conflict = conflict || licensesConflict(x, y)
+				}
+			}
+			if !conflict {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isLibraryPackage guesses whether a dependency is linked rather than run.
+func isLibraryPackage(meta MetadataV2) bool {
+	return meta.Type == "library" || strings.HasPrefix(meta.Name, "lib")
+}
+
+// checkLicenses compares the package license with the licenses of the
+// libraries it depends on, as recorded in the repository index, and
+// reports obvious incompatibilities for legal review.
+func (c *Checker) checkLicenses(meta MetadataV2) []string {
+	if meta.License == nil {
+		return nil
+	}
+	defer c.track("check:licenses")()
+	own, err := licenseAlternatives(*meta.License)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var warnings []string
+	for _, dep := range meta.Dependencies {
+		rel, err := ParseRelation(dep)
+		if err != nil {
+			continue
+		}
+		var conflicting *MetadataV2
+		compatible := false
+		for _, entry := range c.RepoIndex.Packages {
+			lib := MetadataFromMap(entry.Metadata)
+			if !satisfiesRelation(lib, rel) || !isLibraryPackage(lib) || lib.License == nil {
+				continue
+			}
+			theirs, err := licenseAlternatives(*lib.License)
+			if err != nil {
+				continue
+			}
+			if licensesCompatible(own, theirs) {
+				compatible = true
+				break
+			}
+			if conflicting == nil {
+				conflicting = &lib
+			}
+		}
+		if conflicting != nil && !compatible {
+			warnings = append(warnings, fmt.Sprintf("license incompatibility: %s (%s) depends on library %s (%s)", meta.Name, *meta.License, conflicting.Name, *conflicting.License))
+		}
+	}
+	return warnings
+}
+
+// FileLicense is a license found in a shipped file by --scan-licenses.
+type FileLicense struct {
+	Path    string `json:"path"`
+	License string `json:"license"`
+}
+
+var spdxHeader = regexp.MustCompile(`SPDX-License-Identifier:\s*([^\r\n*]+?)\s*(?:\*/|-->)?\s*(?:\r?\n|$)`)
+
+// licenseTexts are phrases from the text or standard header of common
+// licenses, most specific first.
+var licenseTexts = []struct {
+	license string
+	phrases []string
+}{
+	{"AGPL-3.0", []string{"GNU AFFERO GENERAL PUBLIC LICENSE"}},
+	{"LGPL-3.0", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"LGPL-2.1", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 2.1"}},
+	{"LGPL-2.1", []string{"GNU Lesser General Public License", "version 2.1"}},
+	{"LGPL-3.0", []string{"GNU Lesser General Public License", "version 3"}},
+	{"GPL-3.0", []string{"GNU GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"GPL-2.0", []string{"GNU GENERAL PUBLIC LICENSE", "Version 2"}},
+	{"GPL-3.0", []string{"GNU General Public License", "version 3"}},
+	{"GPL-2.0", []string{"GNU General Public License", "version 2"}},
+	{"Apache-2.0", []string{"Apache License", "Version 2.0"}},
+	{"MPL-2.0", []string{"Mozilla Public License", "2.0"}},
+	{"MIT", []string{"Permission is hereby granted, free of charge"}},
+	{"BSD-3-Clause", []string{"Redistribution and use in source and binary forms", "Neither the name"}},
+	{"BSD-2-Clause", []string{"Redistribution and use in source and binary forms"}},
+	{"ISC", []string{"Permission to use, copy, modify, and/or distribute this software for any"}},
+	{"Zlib", []string{"This software is provided 'as-is', without any express or implied"}},
+}
+
+// detectLicense returns the license a file declares with an SPDX tag or
+// through the text of a common license, or "" if it finds none.
+func detectLicense(head []byte) string {
+	if bytes.IndexByte(head, 0) >= 0 {
+		return ""
+	}
+	if m := spdxHeader.FindSubmatch(head); m != nil {
+		return string(m[1])
+	}
+	text := string(head)
+	for _, l := range licenseTexts {
+		found := true
+		for _, phrase := range l.phrases {
+			found = found && strings.Contains(text, phrase)
+		}
+		if found {
+			return l.license
+		}
+	}
+	return ""
+}
+
+// licenseBase strips the version qualifiers, since a license text does not
+// say whether "or later" applies.
+func licenseBase(id string) string {
+	id = strings.TrimSuffix(id, "+")
+	id = strings.TrimSuffix(id, "-only")
+	return strings.TrimSuffix(id, "-or-later")
+}
+
+// licenseCovered reports whether every license a file may be under is one
+// of those the package declares.
+func licenseCovered(declared, found [][]string) bool {
+	names := map[string]bool{}
+	for _, alt := range declared {
+		for _, id := range alt {
+			names[licenseBase(id)] = true
+		}
+	}
+	for _, alt := range found {
+		covered := true
+		for _, id := range alt {
+			id, _, _ = strings.Cut(id, " WITH ")
+			covered = covered && names[licenseBase(id)]
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+// scanLicenses looks for license tags and texts in the start of every
+// shipped text file, records them, and reports files whose license the
+// package license does not cover, as they need attribution.
+func (c *Checker) scanLicenses(ctx context.Context, dir string, meta MetadataV2, report *ValidationResponse) {
+	defer c.track("check:licenses")()
+	var declared [][]string
+	if meta.License != nil {
+		declared, _ = licenseAlternatives(*meta.License)
+	}
+	payloadFiles(ctx, dir, func(installed, file string) {
+		license := detectLicense(fileHead(file, 16*1024))
+		if license == "" {
+			return
+		}
+		c.log(fmt.Sprintf("License of %s: %s", installed, license))
+		report.FileLicenses = append(report.FileLicenses, FileLicense{Path: installed, License: license})
+		found, err := licenseAlternatives(license)
+		if err != nil || declared == nil || licenseCovered(declared, found) {
+			return
+		}
+		report.Warnings = append(report.Warnings, fmt.Sprintf("file under a different license than the package: %s is %s, the package is %s", installed, license, *meta.License))
+	})
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"fmt"
+	"sort"
+)
+
+type LockedPackage struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	Filename   string   `json:"filename"`
+	SHA256     string   `json:"sha256"`
+	RequiredBy []string `json:"required_by"`
+}
+
+type Lockfile struct {
+	Package  string          `json:"package"`
+	Version  string          `json:"version"`
+	Packages []LockedPackage `json:"packages"`
+}
+
+func (idx *RepoIndex) Find(name string) (IndexEntry, bool) {
+	var best IndexEntry
+	found := false
+	for _, entry := range idx.Packages {
+		meta := MetadataFromMap(entry.Metadata)
+		if meta.Name != name {
+			continue
+		}
+		if !found || CompareVersions(meta.Version, MetadataFromMap(best.Metadata).Version) > 0 {
+			best, found = entry, true
+		}
+	}
+	return best, found
+}
+
+// Resolve computes the transitive dependency closure of root. Packages
+// already in the closure are preferred; otherwise the highest version
+// satisfying a relation wins, with real packages preferred over providers.
+func (idx *RepoIndex) Resolve(root MetadataV2) (*Lockfile, []string) {
+	lock := &Lockfile{Package: root.Name, Version: root.Version, Packages: []LockedPackage{}}
+	locked := map[string]int{}
+	var errs []string
+
+	type pending struct {
+		from string
+		dep  string
+	}
+	var queue []pending
+	for _, dep := range root.Dependencies {
+		queue = append(queue, pending{root.Name, dep})
+	}
+
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+
+		rel, err := ParseRelation(item.dep)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: invalid dependency: %v", item.from, err))
+			continue
+		}
+		if satisfiesRelation(root, rel) {
+			continue
+		}
+
+		if i, ok := lockedSatisfying(lock, locked, idx, rel); ok {
+			lock.Packages[i].RequiredBy = appendUnique(lock.Packages[i].RequiredBy, item.from)
+			continue
+		}
+
+		entry, ok := idx.bestCandidate(rel)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: unsatisfiable dependency '%s'", item.from, item.dep))
+			continue
+		}
+		meta := MetadataFromMap(entry.Metadata)
+		if i, ok := locked[meta.Name]; ok {
+			errs = append(errs, fmt.Sprintf("%s: '%s' conflicts with %s %s already required by %v",
+				item.from, item.dep, meta.Name, lock.Packages[i].Version, lock.Packages[i].RequiredBy))
+			continue
+		}
+
+		locked[meta.Name] = len(lock.Packages)
+		lock.Packages = append(lock.Packages, LockedPackage{
+			Name:       meta.Name,
+			Version:    meta.Version,
+			Filename:   entry.Filename,
+			SHA256:     entry.SHA256,
+			RequiredBy: []string{item.from},
+		})
+		for _, dep := range meta.Dependencies {
+			queue = append(queue, pending{meta.Name, dep})
+		}
+	}
+
+	sort.Slice(lock.Packages, func(i, j int) bool { return lock.Packages[i].Name < lock.Packages[j].Name })
+	return lock, errs
+}
+
+func lockedSatisfying(lock *Lockfile, locked map[string]int, idx *RepoIndex, rel Relation) (int, bool) {
+	for _, i := range locked {
+		for _, entry := range idx.Packages {
+			if entry.SHA256 != lock.Packages[i].SHA256 {
+				continue
+			}
+			if satisfiesRelation(MetadataFromMap(entry.Metadata), rel) {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (idx *RepoIndex) bestCandidate(rel Relation) (IndexEntry, bool) {
+	var best IndexEntry
+	var bestMeta MetadataV2
+	found := false
+	for _, entry := range idx.Packages {
+		meta := MetadataFromMap(entry.Metadata)
+		if !satisfiesRelation(meta, rel) {
+			continue
+		}
+		better := !found ||
+			(meta.Name == rel.Name && bestMeta.Name != rel.Name) ||
+			(meta.Name == bestMeta.Name && CompareVersions(meta.Version, bestMeta.Version) > 0)
+		if better {
+			best, bestMeta, found = entry, meta, true
+		}
+	}
+	return best, found
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,306 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ChecksumManifest is the structured checksums.json manifest, an
+// alternative to the flat md5sums and crc32sums files. Paths are relative
+// to the data tree.
+type ChecksumManifest struct {
+	Format int             `json:"format"`
+	Files  []ManifestEntry `json:"files"`
+}
+
+type ManifestEntry struct {
+	Path    string            `json:"path"`
+	Size    int64             `json:"size"`
+	Mode    string            `json:"mode"`
+	Digests map[string]string `json:"digests"`
+}
+
+const manifestFormat = 1
+
+// manifestAlgos are the digest algorithms a manifest may use, with the
+// length of their hex digests. At least one strong algorithm is required
+// per file.
+var manifestAlgos = map[string]int{
+	"sha256": 64,
+	"sha512": 128,
+	"md5":    32,
+	"crc32":  8,
+}
+
+var strongAlgos = []string{"sha256", "sha512"}
+
+// manifestName returns the structured manifest covering a data tree:
+// checksums.json for data/, checksums-ARCH.json for data-ARCH/.
+func manifestName(tree string) string {
+	if arch, ok := strings.CutPrefix(tree, "data-"); ok {
+		return "checksums-" + arch + ".json"
+	}
+	return "checksums.json"
+}
+
+func hasManifest(dir, tree string) bool {
+	_, err := os.Stat(filepath.Join(dir, manifestName(tree)))
+	return err == nil
+}
+
+// loadManifest reads a manifest and rejects anything it does not define:
+// unknown fields, formats or algorithms, malformed digests, modes and
+// paths, and files listed twice.
+func loadManifest(file string) (*ChecksumManifest, error) {
+	name := filepath.Base(file)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var m ChecksumManifest
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid checksum manifest %s: %w", name, err)
+	}
+	if m.Format != manifestFormat {
+		return nil, fmt.Errorf("invalid checksum manifest %s: unsupported format %d (expected %d)", name, m.Format, manifestFormat)
+	}
+	seen := map[string]bool{}
+	for _, e := range m.Files {
+		if e.Path == "" || path.IsAbs(e.Path) || path.Clean(e.Path) != e.Path || e.Path == ".." || strings.HasPrefix(e.Path, "../") {
+			return nil, fmt.Errorf("invalid checksum manifest %s: bad path '%s'", name, e.Path)
+		}
+		if seen[e.Path] {
+			return nil, fmt.Errorf("invalid checksum manifest %s: %s is listed twice", name, e.Path)
+		}
+		seen[e.Path] = true
+		if e.Size < 0 {
+			return nil, fmt.Errorf("invalid checksum manifest %s: negative size for %s", name, e.Path)
+		}
+		if _, err := parseManifestMode(e.Mode); err != nil {
+			return nil, fmt.Errorf("invalid checksum manifest %s: bad mode '%s' for %s", name, e.Mode, e.Path)
+		}
+		strong := false
+		for algo, digest := range e.Digests {
+			length, ok := manifestAlgos[algo]
+			if !ok {
+				return nil, fmt.Errorf("invalid checksum manifest %s: unknown algorithm '%s' for %s", name, algo, e.Path)
+			}
+			if _, err := hex.DecodeString(digest); err != nil || len(digest) != length {
+				return nil, fmt.Errorf("invalid checksum manifest %s: malformed %s digest for %s", name, algo, e.Path)
+			}
+			strong = strong || slices.Contains(strongAlgos, algo)
+		}
+		if !strong {
+			return nil, fmt.Errorf("invalid checksum manifest %s: %s has no sha256 or sha512 digest", name, e.Path)
+		}
+	}
+	return &m, nil
+}
+
+func parseManifestMode(mode string) (int64, error) {
+	v, err := strconv.ParseInt(mode, 8, 32)
+	if err != nil || v < 0 || v > 07777 {
+		return 0, fmt.Errorf("invalid mode")
+	}
+	return v, nil
+}
+
+// verifyManifest checks a data tree against its structured manifest: every
+// listed file must exist with the recorded size and digests, and every
+// file in the tree must be listed. Digests are not computed with
+// SkipChecksums.
+func (c *Checker) verifyManifest(dir, tree string) error {
+	defer c.track("hash")()
+	name := manifestName(tree)
+	m, err := loadManifest(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+
+	root := filepath.Join(dir, tree)
+	listed := map[string]bool{}
+	for _, e := range m.Files {
+		listed[e.Path] = true
+		target := filepath.Join(root, filepath.FromSlash(e.Path))
+		fi, err := os.Stat(target)
+		if err != nil || !fi.Mode().IsRegular() {
+			return fmt.Errorf("file missing or unreadable: %s (checked at %s)", e.Path, target)
+		}
+		if fi.Size() != e.Size {
+			return fmt.Errorf("size mismatch for %s in %s, expected: %d, got: %d", e.Path, name, e.Size, fi.Size())
+		}
+		if c.SkipChecksums {
+			continue
+		}
+		c.log(fmt.Sprintf("Checking %s digests for %s...", name, e.Path))
+		actual, err := c.fileDigests(target, e.Digests)
+		if err != nil {
+			return fmt.Errorf("file missing or unreadable: %s (checked at %s)", e.Path, target)
+		}
+		for _, algo := range slices.Sorted(maps.Keys(e.Digests)) {
+			if !strings.EqualFold(actual[algo], e.Digests[algo]) {
+				return fmt.Errorf("%s mismatch for %s, expected: %s, got: %s", strings.ToUpper(algo), e.Path, e.Digests[algo], actual[algo])
+			}
+		}
+	}
+
+	var unlisted []string
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		if !listed[filepath.ToSlash(rel)] {
+			unlisted = append(unlisted, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if len(unlisted) > 0 {
+		return fmt.Errorf("file not listed in %s: %s", name, strings.Join(unlisted, ", "))
+	}
+	return nil
+}
+
+// fileDigests returns the digests of an extracted file recorded in the
+// entry index, or hashes the file if any of them is missing.
+func (c *Checker) fileDigests(file string, want map[string]string) (map[string]string, error) {
+	sums := map[string]string{}
+	for algo := range want {
+		sum, ok := c.entries.digest(file, algo)
+		if !ok {
+			return fileDigests(file, want)
+		}
+		sums[algo] = sum
+	}
+	return sums, nil
+}
+
+// fileDigests hashes a file once with every algorithm in want.
+func fileDigests(file string, want map[string]string) (map[string]string, error) {
+	hashes := map[string]hash.Hash{}
+	var writers []io.Writer
+	for algo := range want {
+		h := newHash(algo)
+		hashes[algo] = h
+		writers = append(writers, h)
+	}
+	if err := hashFile(file, io.MultiWriter(writers...)); err != nil {
+		return nil, err
+	}
+	sums := map[string]string{}
+	for algo, h := range hashes {
+		sums[algo] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, nil
+}
+
+// checkManifestModes compares the modes recorded in structured manifests
+// with the archive headers, since extraction does not preserve them.
+func checkManifestModes(dir string, headers []*tar.Header, report *ValidationResponse) {
+	modes := map[string]int64{}
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg || h.Typeflag == tar.TypeGNUSparse {
+			modes[path.Clean(strings.TrimPrefix(h.Name, "./"))] = h.Mode & 07777
+		}
+	}
+	for _, tree := range dataTrees(dir) {
+		if !hasManifest(dir, tree) {
+			continue
+		}
+		m, err := loadManifest(filepath.Join(dir, manifestName(tree)))
+		if err != nil {
+			continue
+		}
+		for _, e := range m.Files {
+			want, _ := parseManifestMode(e.Mode)
+			got, ok := modes[tree+"/"+e.Path]
+			if ok && got != want {
+				report.Errors = append(report.Errors, fmt.Sprintf("mode mismatch for %s, expected: %04o, got: %04o", e.Path, want, got))
+			}
+		}
+	}
+}
+
+// generateManifest builds a manifest for a data tree with the given
+// algorithms, taking modes from the archive headers by path within the
+// tree, or from the files on disk for paths without one.
+func generateManifest(root string, algos []string, modes map[string]int64) ([]byte, error) {
+	want := map[string]string{}
+	for _, algo := range algos {
+		want[algo] = ""
+	}
+	m := ChecksumManifest{Format: manifestFormat, Files: []ManifestEntry{}}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sums, err := fileDigests(p, want)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		mode, ok := modes[filepath.ToSlash(rel)]
+		if !ok {
+			mode = int64(fi.Mode().Perm())
+		}
+		m.Files = append(m.Files, ManifestEntry{
+			Path:    filepath.ToSlash(rel),
+			Size:    fi.Size(),
+			Mode:    fmt.Sprintf("%04o", mode),
+			Digests: sums,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// manifestAlgorithms returns the algorithms an existing manifest uses, so
+// regenerating it keeps them, falling back to sha256.
+func manifestAlgorithms(file string) []string {
+	var m ChecksumManifest
+	if data, err := os.ReadFile(file); err == nil {
+		json.Unmarshal(data, &m)
+	}
+	var algos []string
+	for _, e := range m.Files {
+		for algo := range e.Digests {
+			if _, ok := manifestAlgos[algo]; ok && !slices.Contains(algos, algo) {
+				algos = append(algos, algo)
+			}
+		}
+	}
+	if !slices.ContainsFunc(algos, func(a string) bool { return slices.Contains(strongAlgos, a) }) {
+		algos = append(algos, "sha256")
+	}
+	slices.Sort(algos)
+	return algos
+}
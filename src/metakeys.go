@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// metadataKeys returns the JSON keys of a metadata struct.
+func metadataKeys(meta any) []string {
+	var keys []string
+	t := reflect.TypeOf(meta)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// closestKey returns the known key nearest to an unknown one, or "" when
+// none is close enough to be a plausible typo.
+func closestKey(key string, known []string) string {
+	best, bestDist := "", max(2, len(key)/3)+1
+	for _, k := range known {
+		if d := levenshtein(strings.ToLower(key), k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// checkMetadataKeys looks for keys the metadata format does not define,
+// other than x- extensions, and turns them into suggestions: a required
+// field that is missing because its key is misspelled is reported with the
+// likely typo, and with StrictMetadata unknown keys are errors themselves.
+func (c *Checker) checkMetadataKeys(data []byte, meta any, missing []string) error {
+	var raw map[string]json.RawMessage
+	json.Unmarshal(data, &raw)
+	known := metadataKeys(meta)
+	var unknown []string
+	typos := map[string]string{}
+	for _, key := range slices.Sorted(maps.Keys(raw)) {
+		if slices.Contains(known, key) || strings.HasPrefix(key, "x-") {
+			continue
+		}
+		unknown = append(unknown, key)
+		if s := closestKey(key, known); s != "" {
+			typos[key] = s
+		}
+		c.log(fmt.Sprintf("Unknown metadata key '%s'", key))
+	}
+
+	if len(missing) > 0 {
+		msg := fmt.Sprintf("missing or empty required metadata fields: %v", missing)
+		for _, key := range unknown {
+			if slices.Contains(missing, typos[key]) {
+				msg += fmt.Sprintf("; did you mean '%s' instead of '%s'?", typos[key], key)
+			}
+		}
+		return fmt.Errorf("%s", msg)
+	}
+	if c.StrictMetadata && len(unknown) > 0 {
+		var keys []string
+		for _, key := range unknown {
+			if typos[key] != "" {
+				key = fmt.Sprintf("'%s' (did you mean '%s'?)", key, typos[key])
+			} else {
+				key = fmt.Sprintf("'%s'", key)
+			}
+			keys = append(keys, key)
+		}
+		return fmt.Errorf("unknown metadata keys: %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var sumsAlgos = map[string]string{
+	"md5sums":   "MD5",
+	"crc32sums": "CRC32",
+}
+
+// archTrees returns the architectures of a fat package, one per
+// data-<arch>/ directory. It is empty for regular single-tree packages.
+func archTrees(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var arches []string
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), "data-") && len(e.Name()) > len("data-") {
+			arches = append(arches, strings.TrimPrefix(e.Name(), "data-"))
+		}
+	}
+	sort.Strings(arches)
+	return arches
+}
+
+func (c *Checker) checkArchPayloads(dir string, arches []string, sums []string) error {
+	if _, err := os.Stat(filepath.Join(dir, "data")); err == nil {
+		return fmt.Errorf("package mixes a shared 'data' tree with per-architecture trees")
+	}
+	for _, arch := range arches {
+		if err := requireManifests(dir, "data-"+arch, sums); err != nil {
+			return err
+		}
+		if err := c.verifyPayload(dir, "data-"+arch, sums); err != nil {
+			return fmt.Errorf("%s: %w", arch, err)
+		}
+	}
+	return nil
+}
+
+// requireManifests checks that a data tree has its flat manifests of the
+// given kinds, unless it has a structured checksums.json instead.
+func requireManifests(dir, tree string, kinds []string) error {
+	if hasManifest(dir, tree) {
+		return nil
+	}
+	for _, kind := range kinds {
+		name := kind + strings.TrimPrefix(tree, "data")
+		if _, err := os.Stat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			return fmt.Errorf("required file or directory missing: '%s'", name)
+		}
+	}
+	return nil
+}
+
+// verifyPayload verifies a data tree against its structured manifest, if
+// any, and the flat manifests of the given kinds it ships.
+func (c *Checker) verifyPayload(dir, tree string, kinds []string) error {
+	if hasManifest(dir, tree) {
+		c.log(fmt.Sprintf("Verifying %s...", manifestName(tree)))
+		if err := c.verifyManifest(dir, tree); err != nil {
+			return err
+		}
+	}
+	if c.SkipChecksums {
+		c.log("Skipping checksum verification.")
+		return nil
+	}
+	for _, kind := range kinds {
+		sumsFile := kind + strings.TrimPrefix(tree, "data")
+		if _, err := os.Stat(filepath.Join(dir, sumsFile)); os.IsNotExist(err) {
+			continue
+		}
+		c.log(fmt.Sprintf("Verifying %s checksums...", sumsAlgos[kind]))
+		if err := verifyHashesIn(dir, sumsFile, tree, sumsAlgos[kind], c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkDeclaredArches(declared, arches []string) error {
+	if declared == nil {
+		return fmt.Errorf("multi-architecture package does not declare 'architectures'")
+	}
+	want := append([]string{}, declared...)
+	sort.Strings(want)
+	if strings.Join(want, ",") != strings.Join(arches, ",") {
+		return fmt.Errorf("declared architectures %v do not match payload trees %v", want, arches)
+	}
+	return nil
+}
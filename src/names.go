@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// invisibleRunes are bidirectional controls and zero-width characters,
+// which can make a path display differently from what it is.
+var invisibleRunes = map[rune]string{
+	'\u00AD': "soft hyphen",
+	'\u061C': "arabic letter mark",
+	'\u180E': "mongolian vowel separator",
+	'\u200B': "zero width space",
+	'\u200C': "zero width non-joiner",
+	'\u200D': "zero width joiner",
+	'\u200E': "left-to-right mark",
+	'\u200F': "right-to-left mark",
+	'\u202A': "left-to-right embedding",
+	'\u202B': "right-to-left embedding",
+	'\u202C': "pop directional formatting",
+	'\u202D': "left-to-right override",
+	'\u202E': "right-to-left override",
+	'\u2060': "word joiner",
+	'\u2066': "left-to-right isolate",
+	'\u2067': "right-to-left isolate",
+	'\u2068': "first strong isolate",
+	'\u2069': "pop directional isolate",
+	'\uFEFF': "zero width no-break space",
+}
+
+// lookalikeRunes resemble the path separator or a dot.
+var lookalikeRunes = map[rune]string{
+	'\u2024': "one dot leader",
+	'\u2044': "fraction slash",
+	'\u2215': "division slash",
+	'\u29F8': "big solidus",
+	'\uFE52': "small full stop",
+	'\uFF0E': "fullwidth full stop",
+	'\uFF0F': "fullwidth solidus",
+}
+
+// confusableScripts are scripts with letters that look like Latin ones.
+var confusableScripts = map[string]*unicode.RangeTable{
+	"Cyrillic": unicode.Cyrillic,
+	"Greek":    unicode.Greek,
+	"Armenian": unicode.Armenian,
+	"Cherokee": unicode.Cherokee,
+}
+
+// checkEntryNames reports entry names and link targets that are not valid
+// UTF-8, contain invisible characters, or mix Latin letters with lookalikes
+// from other scripts, any of which can hide a path from a reviewer.
+func checkEntryNames(headers []*tar.Header, report *ValidationResponse) {
+	for _, h := range headers {
+		checkEntryName("entry name", h.Name, report)
+		if h.Typeflag == tar.TypeSymlink || h.Typeflag == tar.TypeLink {
+			checkEntryName("link target of "+h.Name, h.Linkname, report)
+		}
+	}
+}
+
+func checkEntryName(what, name string, report *ValidationResponse) {
+	if !utf8.ValidString(name) {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s is not valid UTF-8: %q", what, name))
+		return
+	}
+	for _, r := range name {
+		if desc, ok := invisibleRunes[r]; ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s contains invisible character U+%04X (%s): %q", what, r, desc, name))
+			return
+		}
+	}
+	for _, r := range name {
+		if desc, ok := lookalikeRunes[r]; ok {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s contains confusable character U+%04X (%s): %q", what, r, desc, name))
+			return
+		}
+		if r >= '\uFF01' && r <= '\uFF5E' {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s contains confusable character U+%04X (fullwidth form): %q", what, r, name))
+			return
+		}
+	}
+	for _, part := range strings.Split(name, "/") {
+		if script := mixedScript(part); script != "" {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s contains confusable character: %q mixes Latin and %s letters", what, name, script))
+			return
+		}
+	}
+}
+
+// mixedScript returns the script a path component mixes with Latin letters.
+func mixedScript(part string) string {
+	latin, other := false, ""
+	for _, r := range part {
+		if unicode.Is(unicode.Latin, r) {
+			latin = true
+			continue
+		}
+		for name, table := range confusableScripts {
+			if unicode.Is(table, r) {
+				other = name
+			}
+		}
+	}
+	if latin {
+		return other
+	}
+	return ""
+}
+
+// checkCaseCollisions reports paths, including the directories entries
+// imply, that differ only by case and so overwrite each other on a
+// case-insensitive filesystem.
+func checkCaseCollisions(headers []*tar.Header, report *ValidationResponse) {
+	seen := map[string]string{}
+	reported := map[string]bool{}
+	for _, h := range headers {
+		name := path.Clean(strings.TrimPrefix(h.Name, "./"))
+		for p := name; p != "." && p != "/"; p = path.Dir(p) {
+			folded := strings.ToLower(p)
+			prev, ok := seen[folded]
+			if !ok {
+				seen[folded] = p
+				continue
+			}
+			if prev == p {
+				break
+			}
+			if !reported[folded] {
+				reported[folded] = true
+				report.Warnings = append(report.Warnings, fmt.Sprintf("paths differ only by case: %s and %s", prev, p))
+			}
+		}
+	}
+}
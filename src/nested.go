@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NestedPolicy controls validation of APG packages shipped inside the
+// payload of another, such as installer bundles. MaxDepth is how many
+// levels of packages within packages are validated, 0 turning nested
+// validation off; MaxPackages bounds the nested packages of one top-level
+// package at all depths.
+type NestedPolicy struct {
+	MaxDepth    int `json:"max_depth"`
+	MaxPackages int `json:"max_packages"`
+}
+
+// NestedPackage is the report of a package found in the payload of
+// another, at the path it installs to.
+type NestedPackage struct {
+	Path   string             `json:"path"`
+	Report ValidationResponse `json:"report"`
+}
+
+// nesting is where a validation stands within a package tree: the depth
+// of the package validated and the nested packages seen so far, shared
+// by every level and reset for each top-level package.
+type nesting struct {
+	depth int
+	seen  *int
+}
+
+// checkNested validates the packages among the installed files with the
+// same settings, one level deeper. Their findings stay in their own
+// reports; an invalid nested package is an error of the outer one.
+func (c *Checker) checkNested(root string, files []string, report *ValidationResponse) {
+	limits := c.Policy.Nested
+	if limits.MaxDepth <= 0 {
+		return
+	}
+	for _, file := range files {
+		path := installedPath(root, file)
+		if !strings.HasSuffix(file, ".apg") || !isXZ(path) {
+			continue
+		}
+		if c.nesting.depth >= limits.MaxDepth {
+			report.Errors = append(report.Errors, fmt.Sprintf("nested package %s exceeds the nesting depth limit of %d (nested.max_depth)", file, limits.MaxDepth))
+			continue
+		}
+		if limits.MaxPackages > 0 && *c.nesting.seen >= limits.MaxPackages {
+			report.Errors = append(report.Errors, fmt.Sprintf("nested package %s is over the limit of %d nested packages (nested.max_packages)", file, limits.MaxPackages))
+			continue
+		}
+		*c.nesting.seen++
+
+		c.log(fmt.Sprintf("Validating nested package %s...", file))
+		inner := *c
+		inner.nesting.depth++
+		inner.SourcePackage = false
+		r, err := inner.validateFile(path, 0)
+		r.File = file
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("nested package %s cannot be validated: %v", file, err))
+		} else if !r.Valid {
+			report.Errors = append(report.Errors, fmt.Sprintf("nested package %s is invalid, with %d error(s)", file, len(r.Errors)))
+		}
+		report.Nested = append(report.Nested, NestedPackage{Path: file, Report: r})
+	}
+}
+
+// installedPath returns where an installed file was extracted: under
+// data/, or under the data tree of an architecture.
+func installedPath(root, file string) string {
+	path := filepath.Join(root, "data", file)
+	if fileExists(path) {
+		return path
+	}
+	for _, arch := range archTrees(root) {
+		if p := filepath.Join(root, "data-"+arch, file); fileExists(p) {
+			return p
+		}
+	}
+	return path
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// isXZ reports whether a regular file starts like an xz stream.
+func isXZ(path string) bool {
+	if fi, err := os.Lstat(path); err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, 6)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, []byte("\xfd7zXZ\x00"))
+}
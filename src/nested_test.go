@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bundlePackage packs a valid package that ships n valid packages.
+func bundlePackage(t *testing.T, dir string, n int) string {
+	t.Helper()
+	inner := filepath.Join(dir, "inner.apg")
+	tree := t.TempDir()
+	if err := writeSelftestPackage(tree, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := PackDir(tree, inner); err != nil {
+		t.Fatal(err)
+	}
+
+	tree = t.TempDir()
+	share := filepath.Join(tree, "data", "usr", "share", "hello")
+	if err := os.MkdirAll(share, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range n {
+		if err := os.WriteFile(filepath.Join(share, fmt.Sprintf("inner%d.apg", i)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeSelftestPackage(tree, 2); err != nil {
+		t.Fatal(err)
+	}
+	outer := filepath.Join(dir, "bundle.apg")
+	if err := PackDir(tree, outer); err != nil {
+		t.Fatal(err)
+	}
+	return outer
+}
+
+func TestNestedLimitIsPerTopLevelPackage(t *testing.T) {
+	bundle := bundlePackage(t, t.TempDir(), 1)
+	c := testChecker(t)
+	c.Policy.Nested.MaxPackages = 1
+
+	for i := range 3 {
+		report, err := c.ValidateFile(bundle, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range report.Errors {
+			if strings.Contains(e, "nested.max_packages") {
+				t.Errorf("validation %d: %s", i+1, e)
+			}
+		}
+		if len(report.Nested) != 1 || !report.Nested[0].Report.Valid {
+			t.Errorf("validation %d: nested = %+v, want one valid package", i+1, report.Nested)
+		}
+	}
+}
+
+func TestNestedLimitApplies(t *testing.T) {
+	bundle := bundlePackage(t, t.TempDir(), 2)
+	c := testChecker(t)
+	c.Policy.Nested.MaxPackages = 1
+
+	for i := range 2 {
+		report, err := c.ValidateFile(bundle, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var over int
+		for _, e := range report.Errors {
+			if strings.Contains(e, "nested.max_packages") {
+				over++
+			}
+		}
+		if over != 1 || len(report.Nested) != 1 {
+			t.Errorf("validation %d: %d packages over the limit and %d validated, want 1 and 1", i+1, over, len(report.Nested))
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// PackDir writes the contents of srcDir to dest as a deterministic .tar.xz
+// archive: entries in lexical order, owned by root, and all stamped with
+// SOURCE_DATE_EPOCH or, when it is unset, the time of packing.
+func PackDir(srcDir, dest string) error {
+	mtime, ok := sourceDateEpoch()
+	if !ok {
+		mtime = time.Now().Truncate(time.Second)
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("cannot create archive: %w", err)
+	}
+	defer out.Close()
+
+	xzw, err := xz.NewWriter(out)
+	if err != nil {
+		return fmt.Errorf("cannot create the XZ-writer: %w", err)
+	}
+	tw := tar.NewWriter(xzw)
+
+	err = filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == srcDir {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(srcDir, path)
+
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.ModTime, header.AccessTime, header.ChangeTime = mtime, time.Time{}, time.Time{}
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "root", "root"
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to pack %s: %w", srcDir, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return xzw.Close()
+}
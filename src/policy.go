@@ -0,0 +1,352 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Limits bound the resources an archive may consume during extraction.
+// A zero value disables the corresponding limit.
+type Limits struct {
+	MaxTotalSizeMB int64 `json:"max_total_size_mb"`
+	MaxFileSizeMB  int64 `json:"max_file_size_mb"`
+	MaxEntries     int   `json:"max_entries"`
+	MaxDiskMB      int64 `json:"max_disk_mb"`
+	MaxMemoryMB    int64 `json:"max_memory_mb"`
+	MaxPathLength  int   `json:"max_path_length"`
+	MaxNameLength  int   `json:"max_name_length"`
+	MaxPathDepth   int   `json:"max_path_depth"`
+}
+
+// Linux refuses paths of PATH_MAX (4096 bytes including the terminating
+// NUL) or more, and file names over NAME_MAX bytes, so longer limits could
+// never be installed.
+const (
+	pathMax = 4095
+	nameMax = 255
+)
+
+// ArchivePolicy controls how strictly the archive container is checked.
+// UnknownEntries is what happens to entries of a type apgcheck does not
+// extract, such as device nodes and FIFOs: "error", "warn" or "skip".
+// AllowedXattrs, when set, lists the extended attribute names entries may
+// carry, as patterns such as "user.*". AllowedCapabilities maps an
+// installed path to the file capabilities it may carry; capabilities on any
+// other path are rejected.
+type ArchivePolicy struct {
+	RequireDeterministic bool                `json:"require_deterministic"`
+	AllowedFormats       []string            `json:"allowed_formats"`
+	AllowSparse          bool                `json:"allow_sparse"`
+	UnknownEntries       string              `json:"unknown_entries"`
+	AllowedXattrs        []string            `json:"allowed_xattrs,omitempty"`
+	AllowedCapabilities  map[string][]string `json:"allowed_capabilities,omitempty"`
+}
+
+// PackagingPolicy controls the checks on what a package installs. Each
+// setting is "error", "warn" or "ignore". StaticLibraries applies to .a
+// archives in packages other than -dev, -devel and -static ones,
+// BundledLibraries to private copies of common system libraries, and
+// Runpaths to insecure ELF RPATH and RUNPATH entries. Interpreters applies
+// to scripts whose interpreter is neither shipped nor a dependency, and
+// ContentTypes to files whose content does not fit their path, and
+// ConfigText to files under /etc that are not clean text, and RuntimePaths
+// to files in directories populated at run time. SplitSuggestions applies
+// to documentation, development files or debug information making up most
+// of a package. ConfigPrefixes are the directories v2 conf entries may
+// point into.
+type PackagingPolicy struct {
+	StaticLibraries  string          `json:"static_libraries"`
+	BundledLibraries string          `json:"bundled_libraries"`
+	Runpaths         string          `json:"runpaths"`
+	Interpreters     string          `json:"interpreters"`
+	ContentTypes     string          `json:"content_types"`
+	ConfigText       string          `json:"config_text"`
+	RuntimePaths     string          `json:"runtime_paths"`
+	SplitSuggestions string          `json:"split_suggestions"`
+	ConfigPrefixes   []string        `json:"config_prefixes"`
+	Hardening        HardeningPolicy `json:"hardening"`
+}
+
+// HardeningPolicy sets how ELF files missing each hardening feature are
+// reported, so the baseline can be raised one feature at a time.
+type HardeningPolicy struct {
+	PIE            string `json:"pie"`
+	RELRO          string `json:"relro"`
+	StackProtector string `json:"stack_protector"`
+	NX             string `json:"nx"`
+}
+
+type Policy struct {
+	Limits       Limits            `json:"limits"`
+	Archive      ArchivePolicy     `json:"archive"`
+	Packaging    PackagingPolicy   `json:"packaging"`
+	Size         SizePolicy        `json:"size"`
+	Compression  CompressionPolicy `json:"compression"`
+	Provides     ProvidesPolicy    `json:"provides"`
+	Suppressions SuppressionPolicy `json:"suppressions"`
+	Nested       NestedPolicy      `json:"nested"`
+	// Budgets maps a rule ID or code to the budget of the check reporting
+	// it.
+	Budgets map[string]RuleBudget `json:"budgets,omitempty"`
+	// ExitCodes maps a severity (error, warning) or a rule ID or code to
+	// the exit status its findings cause.
+	ExitCodes map[string]int `json:"exit_codes,omitempty"`
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		Limits: Limits{
+			MaxTotalSizeMB: 500,
+			MaxFileSizeMB:  500,
+			MaxEntries:     100000,
+			MaxMemoryMB:    1024,
+			MaxPathLength:  pathMax,
+			MaxNameLength:  nameMax,
+		},
+		Archive: ArchivePolicy{
+			AllowSparse:    true,
+			UnknownEntries: "warn",
+		},
+		Packaging: PackagingPolicy{
+			StaticLibraries:  "warn",
+			BundledLibraries: "warn",
+			Runpaths:         "error",
+			Interpreters:     "warn",
+			ContentTypes:     "warn",
+			ConfigText:       "warn",
+			RuntimePaths:     "error",
+			SplitSuggestions: "warn",
+			ConfigPrefixes:   []string{"/etc"},
+			Hardening: HardeningPolicy{
+				PIE:            "warn",
+				RELRO:          "warn",
+				StackProtector: "ignore",
+				NX:             "warn",
+			},
+		},
+		Size: SizePolicy{
+			WarnCompressedMB: 100,
+			WarnInstalledMB:  250,
+		},
+		Compression: CompressionPolicy{
+			Action:          "warn",
+			MaxDictionaryMB: 8,
+			MinDictionaryMB: 1,
+			MinBlockMB:      1,
+		},
+		Provides: ProvidesPolicy{
+			Action:     "warn",
+			AllowPlain: true,
+			Namespaces: map[string]string{
+				"soname":    `^[^/\s()]+\.so(\.[0-9]+)*$`,
+				"cmd":       `^[^/\s()]+$`,
+				"pkgconfig": `^[A-Za-z0-9._+-]+$`,
+			},
+		},
+		Suppressions: SuppressionPolicy{Enabled: true},
+		Nested:       NestedPolicy{MaxDepth: 2, MaxPackages: 16},
+	}
+}
+
+// entryBudget tracks archive entries against the extraction limits.
+// Declared sizes are checked per entry header; the disk quota counts the
+// bytes actually written.
+type entryBudget struct {
+	limits  Limits
+	entries int
+	size    int64
+	written int64
+}
+
+func (b *entryBudget) account(name string, size int64) error {
+	b.entries++
+	if b.limits.MaxEntries > 0 && b.entries > b.limits.MaxEntries {
+		return fmt.Errorf("entry limit exceeded: archive has more than %d entries (max_entries)", b.limits.MaxEntries)
+	}
+	if b.limits.MaxFileSizeMB > 0 && size > b.limits.MaxFileSizeMB*1024*1024 {
+		return fmt.Errorf("file too large: %s is over the per-file limit of %d MB (max_file_size_mb)", name, b.limits.MaxFileSizeMB)
+	}
+	if err := b.checkPath(name); err != nil {
+		return err
+	}
+	b.size += size
+	if b.limits.MaxTotalSizeMB > 0 && b.size > b.limits.MaxTotalSizeMB*1024*1024 {
+		return fmt.Errorf("tar-bomb detected or size limit exceeded: total uncompressed size is over %d MB (max_total_size_mb)", b.limits.MaxTotalSizeMB)
+	}
+	return nil
+}
+
+// checkPath bounds the installed path of an entry: its length, the length
+// of each component, and the number of components.
+func (b *entryBudget) checkPath(name string) error {
+	installed := payloadPath(name)
+	if b.limits.MaxPathLength > 0 && len(installed) > b.limits.MaxPathLength {
+		return fmt.Errorf("path too long: %s is %d bytes, over the limit of %d (max_path_length)", name, len(installed), b.limits.MaxPathLength)
+	}
+	parts := strings.Split(strings.Trim(installed, "/"), "/")
+	if b.limits.MaxPathDepth > 0 && len(parts) > b.limits.MaxPathDepth {
+		return fmt.Errorf("path too deep: %s has %d components, over the limit of %d (max_path_depth)", name, len(parts), b.limits.MaxPathDepth)
+	}
+	for _, part := range parts {
+		if b.limits.MaxNameLength > 0 && len(part) > b.limits.MaxNameLength {
+			return fmt.Errorf("file name too long: %s has a %d byte component, over the limit of %d (max_name_length)", name, len(part), b.limits.MaxNameLength)
+		}
+	}
+	return nil
+}
+
+type quotaWriter struct {
+	budget *entryBudget
+	w      io.Writer
+}
+
+func (b *entryBudget) writer(w io.Writer) io.Writer {
+	return &quotaWriter{budget: b, w: w}
+}
+
+func (qw *quotaWriter) Write(p []byte) (int, error) {
+	b := qw.budget
+	if b.limits.MaxDiskMB > 0 && b.written+int64(len(p)) > b.limits.MaxDiskMB*1024*1024 {
+		return 0, fmt.Errorf("disk quota exceeded: extraction would write more than %d MB (max_disk_mb)", b.limits.MaxDiskMB)
+	}
+	n, err := qw.w.Write(p)
+	b.written += int64(n)
+	return n, err
+}
+
+var tarFormats = []string{"ustar", "pax", "gnu", "v7"}
+
+var unknownEntryActions = []string{"error", "warn", "skip"}
+
+var packagingActions = []string{"error", "warn", "ignore"}
+
+func (p Policy) Validate() error {
+	if p.Limits.MaxPathLength < 0 || p.Limits.MaxPathLength > pathMax {
+		return fmt.Errorf("max_path_length in policy must be between 0 and %d (Linux PATH_MAX)", pathMax)
+	}
+	if p.Limits.MaxNameLength < 0 || p.Limits.MaxNameLength > nameMax {
+		return fmt.Errorf("max_name_length in policy must be between 0 and %d (Linux NAME_MAX)", nameMax)
+	}
+	for _, f := range p.Archive.AllowedFormats {
+		if !slices.Contains(tarFormats, f) {
+			return fmt.Errorf("unknown tar format in policy: '%s' (expected one of %s)", f, strings.Join(tarFormats, ", "))
+		}
+	}
+	if !slices.Contains(unknownEntryActions, p.Archive.UnknownEntries) {
+		return fmt.Errorf("invalid unknown_entries in policy: '%s' (expected one of %s)", p.Archive.UnknownEntries, strings.Join(unknownEntryActions, ", "))
+	}
+	for _, s := range []struct{ key, action string }{
+		{"static_libraries", p.Packaging.StaticLibraries},
+		{"bundled_libraries", p.Packaging.BundledLibraries},
+		{"runpaths", p.Packaging.Runpaths},
+		{"interpreters", p.Packaging.Interpreters},
+		{"content_types", p.Packaging.ContentTypes},
+		{"config_text", p.Packaging.ConfigText},
+		{"runtime_paths", p.Packaging.RuntimePaths},
+		{"split_suggestions", p.Packaging.SplitSuggestions},
+		{"hardening.pie", p.Packaging.Hardening.PIE},
+		{"hardening.relro", p.Packaging.Hardening.RELRO},
+		{"hardening.stack_protector", p.Packaging.Hardening.StackProtector},
+		{"hardening.nx", p.Packaging.Hardening.NX},
+		{"compression.action", p.Compression.Action},
+		{"provides.action", p.Provides.Action},
+	} {
+		if !slices.Contains(packagingActions, s.action) {
+			return fmt.Errorf("invalid %s in policy: '%s' (expected one of %s)", s.key, s.action, strings.Join(packagingActions, ", "))
+		}
+	}
+	for _, s := range []struct {
+		key  string
+		size int64
+	}{
+		{"warn_compressed_mb", p.Size.WarnCompressedMB},
+		{"error_compressed_mb", p.Size.ErrorCompressedMB},
+		{"warn_installed_mb", p.Size.WarnInstalledMB},
+		{"error_installed_mb", p.Size.ErrorInstalledMB},
+		{"compression.max_dictionary_mb", p.Compression.MaxDictionaryMB},
+		{"compression.min_dictionary_mb", p.Compression.MinDictionaryMB},
+		{"compression.min_block_mb", p.Compression.MinBlockMB},
+	} {
+		if s.size < 0 {
+			return fmt.Errorf("%s in policy must not be negative", s.key)
+		}
+	}
+	for key, budget := range p.Budgets {
+		if _, ok := RuleByID(key); !ok {
+			return fmt.Errorf("unknown rule in policy budgets: '%s'", key)
+		}
+		if budget.TimeoutMS < 0 || budget.MaxMemoryMB < 0 {
+			return fmt.Errorf("budget for %s in policy must not be negative", key)
+		}
+	}
+	if p.Nested.MaxDepth < 0 || p.Nested.MaxPackages < 0 {
+		return fmt.Errorf("nested.max_depth and nested.max_packages in policy must not be negative")
+	}
+	if err := validateExitCodes(p.ExitCodes); err != nil {
+		return err
+	}
+	for ns, pattern := range p.Provides.Namespaces {
+		if !namespaceName.MatchString(ns) {
+			return fmt.Errorf("invalid provides namespace in policy: '%s'", ns)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern for provides namespace %s in policy: %w", ns, err)
+		}
+	}
+	for _, prefix := range p.Packaging.ConfigPrefixes {
+		if !path.IsAbs(prefix) {
+			return fmt.Errorf("invalid config prefix in policy: '%s' is not an absolute path", prefix)
+		}
+	}
+	for _, pattern := range p.Archive.AllowedXattrs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid xattr pattern in policy: '%s'", pattern)
+		}
+	}
+	for path, caps := range p.Archive.AllowedCapabilities {
+		for _, name := range caps {
+			if !slices.Contains(capabilityNames, name) {
+				return fmt.Errorf("unknown capability in policy for %s: '%s'", path, name)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadPolicy reads a JSON policy file. Settings it does not mention keep
+// their default values.
+func LoadPolicy(path string) (Policy, error) {
+	policy := DefaultPolicy()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policy, fmt.Errorf("failed to read policy: %w", err)
+	}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return policy, fmt.Errorf("policy invalid JSON: %w", err)
+	}
+	return policy, nil
+}
+
+// TarFormats returns the tar formats a policy may allow.
+func TarFormats() []string {
+	return slices.Clone(tarFormats)
+}
+
+// PackagingActions returns the values the packaging settings may take.
+func PackagingActions() []string {
+	return slices.Clone(packagingActions)
+}
+
+// UnknownEntryActions returns the values unknown_entries may take.
+func UnknownEntryActions() []string {
+	return slices.Clone(unknownEntryActions)
+}
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Timing struct {
+	Name         string  `json:"name"`
+	Milliseconds float64 `json:"ms"`
+	Calls        int     `json:"calls"`
+	elapsed      time.Duration
+}
+
+// Profile is the performance breakdown of one validation. Timings are
+// listed in the order phases first ran; nested phases (hash within
+// check:structure, decompress within extract) are included in their parent.
+type Profile struct {
+	Timings         []Timing `json:"timings"`
+	PeakMemoryBytes uint64   `json:"peak_memory_bytes"`
+	mu              sync.Mutex
+	closed          bool
+}
+
+func (p *Profile) add(name string, d time.Duration) {
+	p.addCalls(name, d, 1)
+}
+
+func (p *Profile) addCalls(name string, d time.Duration, calls int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	i := slices.IndexFunc(p.Timings, func(t Timing) bool { return t.Name == name })
+	if i < 0 {
+		p.Timings = append(p.Timings, Timing{Name: name})
+		i = len(p.Timings) - 1
+	}
+	t := &p.Timings[i]
+	t.elapsed += d
+	t.Milliseconds = float64(t.elapsed.Microseconds()) / 1000
+	t.Calls += calls
+}
+
+// close stops recording, so checks skipped for their budget and still
+// running do not change a profile that has been reported.
+func (p *Profile) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+}
+
+// track starts timing a phase and returns the function that stops it. It
+// is a no-op unless profiling or tracing is enabled.
+func (c *Checker) track(name string) func() {
+	if c.profile == nil && c.span == nil {
+		return func() {}
+	}
+	p, start := c.profile, time.Now()
+	var span *Span
+	if c.span != nil {
+		span = c.Tracer.Start(name, c.span.Context())
+	}
+	return func() {
+		if p != nil {
+			p.add(name, time.Since(start))
+		}
+		if span != nil {
+			span.End()
+		}
+	}
+}
+
+type timedReader struct {
+	r       io.ReadCloser
+	profile *Profile
+}
+
+func (t *timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := t.r.Read(p)
+	t.profile.add("decompress", time.Since(start))
+	return n, err
+}
+
+func (t *timedReader) Close() error {
+	return t.r.Close()
+}
+
+// peakMemory reports the peak resident set size where the OS exposes it,
+// and otherwise the memory the Go runtime obtained from the OS.
+func peakMemory() uint64 {
+	if f, err := os.Open("/proc/self/status"); err == nil {
+		defer f.Close()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if rest, ok := strings.CutPrefix(s.Text(), "VmHWM:"); ok {
+				kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(rest), " kB"), 10, 64)
+				if err == nil {
+					return kb * 1024
+				}
+			}
+		}
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Sys
+}
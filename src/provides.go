@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"context"
+	"debug/elf"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ProvidesPolicy sets the naming conventions for virtual packages in
+// provides: Namespaces maps each namespace, as in soname(libfoo.so.1), to a
+// pattern its argument must match, and AllowPlain permits names outside any
+// namespace. Action is how violations are reported: "error", "warn" or
+// "ignore".
+type ProvidesPolicy struct {
+	Action     string            `json:"action"`
+	AllowPlain bool              `json:"allow_plain"`
+	Namespaces map[string]string `json:"namespaces"`
+}
+
+var namespaceName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// commandDirs are the directories a cmd() virtual may name commands in.
+var commandDirs = []string{"/usr/bin", "/usr/sbin", "/bin", "/sbin"}
+
+// splitVirtual splits a namespaced name such as cmd(foo) into "cmd" and
+// "foo". Plain names have no namespace.
+func splitVirtual(name string) (namespace, arg string) {
+	ns, rest, ok := strings.Cut(name, "(")
+	if !ok || !strings.HasSuffix(rest, ")") {
+		return "", name
+	}
+	return ns, strings.TrimSuffix(rest, ")")
+}
+
+// checkProvides validates provides entries against the naming policy and,
+// for the built-in namespaces, against the payload: a package may only
+// provide the sonames of libraries, the commands and the pkg-config
+// modules it ships.
+func (c *Checker) checkProvides(ctx context.Context, dir string, meta MetadataV2, files []string, report *ValidationResponse) {
+	p := c.Policy.Provides
+	var sonames []string
+	c.payloadELFs(ctx, dir, func(_ string, f *elf.File) {
+		names, _ := f.DynString(elf.DT_SONAME)
+		sonames = append(sonames, names...)
+	})
+
+	for _, entry := range meta.Provides {
+		problem := ""
+		rel, err := ParseRelation(entry)
+		ns, arg := splitVirtual(rel.Name)
+		switch {
+		case err != nil:
+			problem = "not of the form 'name' or 'name = version'"
+		case rel.Op != "" && rel.Op != "=":
+			problem = fmt.Sprintf("a provided version must be exact, not '%s'", rel.Op)
+		case ns == "" && !p.AllowPlain:
+			problem = fmt.Sprintf("not in a namespace (allowed: %s)", strings.Join(namespaceList(p), ", "))
+		case ns == "":
+		case p.Namespaces[ns] == "":
+			problem = fmt.Sprintf("unknown namespace '%s' (allowed: %s)", ns, strings.Join(namespaceList(p), ", "))
+		case !regexp.MustCompile(p.Namespaces[ns]).MatchString(arg):
+			problem = fmt.Sprintf("'%s' does not match the %s() convention %s", arg, ns, p.Namespaces[ns])
+		case ns == "soname" && !slices.Contains(sonames, arg):
+			problem = fmt.Sprintf("no library in the package has the soname %s", arg)
+		case ns == "cmd" && !slices.ContainsFunc(commandDirs, func(d string) bool { return slices.Contains(files, d+"/"+arg) }):
+			problem = fmt.Sprintf("the package installs no command %s in %s", arg, strings.Join(commandDirs, ", "))
+		case ns == "pkgconfig" && !slices.ContainsFunc(files, func(f string) bool { return strings.HasSuffix(f, "/pkgconfig/"+arg+".pc") }):
+			problem = fmt.Sprintf("the package installs no pkg-config file %s.pc", arg)
+		}
+		if problem != "" {
+			c.reportAs(p.Action, fmt.Sprintf("invalid provides '%s': %s", entry, problem), report)
+		}
+	}
+}
+
+func namespaceList(p ProvidesPolicy) []string {
+	var names []string
+	for ns := range p.Namespaces {
+		names = append(names, ns+"()")
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// PayloadEntry is an archive entry reduced to the attributes that matter
+// for reproducibility. Ordering, timestamps and ownership are dropped.
+type PayloadEntry struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Mode   string `json:"mode"`
+	Link   string `json:"link,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+type ReproReport struct {
+	Reproducible bool     `json:"reproducible"`
+	Files        []string `json:"files"`
+	Digests      []string `json:"digests"`
+	Differences  []string `json:"differences"`
+}
+
+// NormalizedPayload reads an APG archive and returns its entries sorted by
+// name together with a digest over them. Two packages with the same digest
+// have bit-identical payloads.
+func (c *Checker) NormalizedPayload(apgFile string) ([]PayloadEntry, string, error) {
+	f, err := os.Open(apgFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot open archive: %w", err)
+	}
+	defer f.Close()
+
+	xzr, err := c.openXZ(f)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot create the XZ-reader: %w", err)
+	}
+	defer xzr.Close()
+	tr := tar.NewReader(xzr)
+	budget := entryBudget{limits: c.Policy.Limits}
+
+	var entries []PayloadEntry
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			if err := drainXZ(xzr); err != nil {
+				return nil, "", err
+			}
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("error during reading archive: %w", err)
+		}
+		if err := budget.account(h.Name, h.Size); err != nil {
+			return nil, "", err
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+h.Name), "/")
+		if name == "" {
+			continue
+		}
+		e := PayloadEntry{Name: name, Mode: fmt.Sprintf("%04o", h.Mode&07777)}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			e.Type = "dir"
+		case tar.TypeReg, tar.TypeGNUSparse:
+			e.Type = "file"
+			sum := sha256.New()
+			if _, err := io.Copy(sum, tr); err != nil {
+				return nil, "", fmt.Errorf("failed to read %s: %w", h.Name, err)
+			}
+			e.SHA256 = fmt.Sprintf("%x", sum.Sum(nil))
+		case tar.TypeSymlink:
+			e.Type, e.Link = "symlink", h.Linkname
+		case tar.TypeLink:
+			e.Type, e.Link = "hardlink", h.Linkname
+		default:
+			e.Type = fmt.Sprintf("type-%c", h.Typeflag)
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	digest := sha256.New()
+	for _, e := range entries {
+		fmt.Fprintf(digest, "%s\x00%s\x00%s\x00%s\x00%s\n", e.Name, e.Type, e.Mode, e.Link, e.SHA256)
+	}
+	return entries, fmt.Sprintf("%x", digest.Sum(nil)), nil
+}
+
+// Repro compares the normalized payloads of two builds of a package.
+func (c *Checker) Repro(oldFile, newFile string) (*ReproReport, error) {
+	c.log(fmt.Sprintf("Normalizing %s...", oldFile))
+	oldEntries, oldDigest, err := c.NormalizedPayload(oldFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", oldFile, err)
+	}
+	c.log(fmt.Sprintf("Normalizing %s...", newFile))
+	newEntries, newDigest, err := c.NormalizedPayload(newFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", newFile, err)
+	}
+
+	report := &ReproReport{
+		Reproducible: oldDigest == newDigest,
+		Files:        []string{oldFile, newFile},
+		Digests:      []string{oldDigest, newDigest},
+		Differences:  diffPayloads(oldEntries, newEntries),
+	}
+	return report, nil
+}
+
+func diffPayloads(old, new []PayloadEntry) []string {
+	byName := map[string]PayloadEntry{}
+	for _, e := range new {
+		byName[e.Name] = e
+	}
+
+	diffs := []string{}
+	for _, o := range old {
+		n, ok := byName[o.Name]
+		delete(byName, o.Name)
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("%s: only in the first package", o.Name))
+		case o.Type != n.Type:
+			diffs = append(diffs, fmt.Sprintf("%s: %s became %s", o.Name, o.Type, n.Type))
+		case o.SHA256 != n.SHA256:
+			diffs = append(diffs, fmt.Sprintf("%s: content differs", o.Name))
+		case o.Link != n.Link:
+			diffs = append(diffs, fmt.Sprintf("%s: link target %s became %s", o.Name, o.Link, n.Link))
+		case o.Mode != n.Mode:
+			diffs = append(diffs, fmt.Sprintf("%s: mode %s became %s", o.Name, o.Mode, n.Mode))
+		}
+	}
+
+	var added []string
+	for name := range byName {
+		added = append(added, name)
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		diffs = append(diffs, fmt.Sprintf("%s: only in the second package", name))
+	}
+	return diffs
+}
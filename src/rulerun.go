@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+// RuleBudget bounds the time and memory one check may use, so an
+// expensive optional check is skipped with a warning rather than stalling
+// validation. A zero value disables the bound. Memory is the heap the
+// whole process grows by while the check runs, which includes whatever
+// else it does meanwhile, so a memory budget is an upper bound rather
+// than an exact measure of the check.
+type RuleBudget struct {
+	TimeoutMS   int64 `json:"timeout_ms"`
+	MaxMemoryMB int64 `json:"max_memory_mb"`
+}
+
+// contentCheck is one independent check over the extracted package,
+// named by the rule it reports. It reports into its own response, so
+// checks can run concurrently, and stops early once ctx is cancelled.
+type contentCheck struct {
+	rule string
+	run  func(ctx context.Context, report *ValidationResponse)
+}
+
+// memoryBudgetMu serializes checks with a memory budget across the
+// process, so concurrent validations never count each other's budgeted
+// checks against them.
+var memoryBudgetMu sync.Mutex
+
+// budgetFor returns the budget the policy gives a rule, by ID or code.
+func (c *Checker) budgetFor(id string) RuleBudget {
+	for key, budget := range c.Policy.Budgets {
+		if rule, ok := RuleByID(key); ok && rule.ID == id {
+			return budget
+		}
+	}
+	return RuleBudget{}
+}
+
+// runContentChecks runs the checks on up to c.Threads workers (all CPUs
+// for 0) and merges their findings in the order the checks are listed, so
+// reports do not depend on scheduling. Checks with a memory budget run
+// afterwards, so the other checks of this validation no longer grow the
+// heap while they are measured.
+func (c *Checker) runContentChecks(checks []contentCheck, report *ValidationResponse) {
+	defer c.track("check:content")()
+	workers := c.Threads
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, len(checks))
+	c.log(fmt.Sprintf("Running %d checks on %d workers...", len(checks), workers))
+
+	results := make([]ValidationResponse, len(checks))
+	var alone []int
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = c.runBudgeted(checks[i], c.budgetFor(checks[i].rule))
+			}
+		}()
+	}
+	for i, check := range checks {
+		if c.budgetFor(check.rule).MaxMemoryMB > 0 {
+			alone = append(alone, i)
+			continue
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, i := range alone {
+		results[i] = c.runBudgeted(checks[i], c.budgetFor(checks[i].rule))
+	}
+
+	for _, r := range results {
+		report.Errors = append(report.Errors, r.Errors...)
+		report.Warnings = append(report.Warnings, r.Warnings...)
+		report.FileLicenses = append(report.FileLicenses, r.FileLicenses...)
+	}
+}
+
+// runBudgeted runs a check and returns its findings, or a warning that it
+// was skipped if it runs out of its budget. A skipped check is cancelled
+// and waited for, so it never outlives the validation that started it;
+// its findings are dropped.
+func (c *Checker) runBudgeted(check contentCheck, budget RuleBudget) ValidationResponse {
+	if budget.TimeoutMS <= 0 && budget.MaxMemoryMB <= 0 {
+		var r ValidationResponse
+		check.run(context.Background(), &r)
+		return r
+	}
+
+	if budget.MaxMemoryMB > 0 {
+		memoryBudgetMu.Lock()
+		defer memoryBudgetMu.Unlock()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan ValidationResponse, 1)
+	start := heapBytes()
+	go func() {
+		var r ValidationResponse
+		check.run(ctx, &r)
+		done <- r
+	}()
+	skip := func(reason string) ValidationResponse {
+		cancel()
+		<-done
+		return skippedCheck(check.rule, reason)
+	}
+	defer cancel()
+
+	var timeout <-chan time.Time
+	if budget.TimeoutMS > 0 {
+		timer := time.NewTimer(time.Duration(budget.TimeoutMS) * time.Millisecond)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	poll := time.NewTicker(10 * time.Millisecond)
+	defer poll.Stop()
+	for {
+		select {
+		case r := <-done:
+			return r
+		case <-timeout:
+			return skip(fmt.Sprintf("time budget of %d ms", budget.TimeoutMS))
+		case <-poll.C:
+			if budget.MaxMemoryMB > 0 && heapBytes()-start > budget.MaxMemoryMB<<20 {
+				return skip(fmt.Sprintf("memory budget of %d MiB", budget.MaxMemoryMB))
+			}
+		}
+	}
+}
+
+func skippedCheck(rule, budget string) ValidationResponse {
+	return ValidationResponse{Warnings: []string{fmt.Sprintf("check skipped: %s exceeded its %s", rule, budget)}}
+}
+
+// heapBytes returns the memory occupied by heap objects, live or not yet
+// collected.
+func heapBytes() int64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64())
+}
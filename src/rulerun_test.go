@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunBudgetedWaitsForSkippedCheck(t *testing.T) {
+	var stopped atomic.Bool
+	check := contentCheck{"slow", func(ctx context.Context, r *ValidationResponse) {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		stopped.Store(true)
+	}}
+
+	r := testChecker(t).runBudgeted(check, RuleBudget{TimeoutMS: 10})
+	if !stopped.Load() {
+		t.Error("runBudgeted returned while the skipped check was still running")
+	}
+	if len(r.Warnings) != 1 || !strings.HasPrefix(r.Warnings[0], "check skipped: slow exceeded its time budget") {
+		t.Errorf("warnings = %q, want a skipped check", r.Warnings)
+	}
+}
+
+func TestRunBudgetedKeepsFindings(t *testing.T) {
+	check := contentCheck{"quick", func(ctx context.Context, r *ValidationResponse) {
+		r.Errors = append(r.Errors, "finding")
+	}}
+	r := testChecker(t).runBudgeted(check, RuleBudget{TimeoutMS: 10000})
+	if len(r.Errors) != 1 || len(r.Warnings) != 0 {
+		t.Errorf("report = %+v, want the check's finding", r)
+	}
+}
+
+func TestRunBudgetedSerializesMemoryBudgets(t *testing.T) {
+	var running, overlapped atomic.Int32
+	check := contentCheck{"heavy", func(ctx context.Context, r *ValidationResponse) {
+		if running.Add(1) > 1 {
+			overlapped.Add(1)
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+	}}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			testChecker(t).runBudgeted(check, RuleBudget{MaxMemoryMB: 1024})
+		}()
+	}
+	wg.Wait()
+	if overlapped.Load() != 0 {
+		t.Error("checks with a memory budget ran concurrently")
+	}
+}
+
+func TestPayloadFilesStopsOnCancel(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(dir, "data", "usr", name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var seen []string
+	payloadFiles(ctx, dir, func(installed, _ string) {
+		seen = append(seen, installed)
+		cancel()
+	})
+	if len(seen) != 1 {
+		t.Errorf("visited %q after the context was cancelled", seen)
+	}
+}
@@ -0,0 +1,977 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Rule classifies findings by message and explains how to fix them. Code
+// is the stable identifier (APG001, ...) that suppressions, baselines and
+// bug reports refer to; it never changes or gets reused, while ID is a
+// readable name. Hint is the generic remediation; render, when set, builds a more specific one
+// from the pattern's submatches. AppliesTo lists the package kinds (v1, v2,
+// source) and commands (bundle, delta, index) the rule runs for, and
+// Requires the option without which it does not run.
+type Rule struct {
+	ID        string       `json:"id"`
+	Code      string       `json:"code"`
+	DocsURL   string       `json:"docs_url"`
+	Severity  string       `json:"severity"`
+	Summary   string       `json:"summary"`
+	Hint      string       `json:"hint"`
+	AppliesTo []string     `json:"applies_to"`
+	Requires  string       `json:"requires,omitempty"`
+	Options   []RuleOption `json:"options"`
+	pattern   *regexp.Regexp
+	render    func(m []string) string
+}
+
+// RuleOption is a setting that changes how a rule behaves: a key of the
+// policy file, a command-line flag, or both.
+type RuleOption struct {
+	Policy string `json:"policy,omitempty"`
+	Flag   string `json:"flag,omitempty"`
+	Effect string `json:"effect"`
+}
+
+var (
+	allPackages    = []string{"v1", "v2", "source"}
+	binaryPackages = []string{"v1", "v2"}
+
+	deterministicOption = RuleOption{Policy: "archive.require_deterministic", Flag: "--require-deterministic", Effect: "report the finding as an error instead of a warning"}
+)
+
+// RulesURL is the rule reference, with a section per rule code.
+const RulesURL = "https://github.com/NurOS-Linux/apgcheck/blob/main/RULES.md"
+
+type Finding struct {
+	Rule     string `json:"rule,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// rules are matched in order, so specific patterns come before the generic
+// ones they overlap with. New rules take the next unused code wherever
+// they are placed.
+var rules = []Rule{
+	{
+		ID:        "missing-manifest",
+		Code:      "APG001",
+		Severity:  "error",
+		Summary:   "a checksum manifest is missing",
+		Hint:      "regenerate the checksum manifests with `apgcheck -a PACKAGE.apg --fix`",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`^required file or directory missing: '((?:md5|crc32|sha256)sums[^']*)'`),
+	},
+	{
+		ID:        "missing-file",
+		Code:      "APG002",
+		Severity:  "error",
+		Summary:   "a required top-level file or directory is missing",
+		Hint:      "add the missing entry at the top level of the archive",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`^required file or directory missing: '([^']+)'`),
+		render: func(m []string) string {
+			return fmt.Sprintf("add '%s' at the top level of the archive, next to metadata.json", m[1])
+		},
+	},
+	{
+		ID:        "metadata-json",
+		Code:      "APG003",
+		Severity:  "error",
+		Summary:   "metadata.json is not valid JSON",
+		Hint:      "locate the syntax error with `jq . metadata.json` and fix it",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`metadata invalid JSON`),
+	},
+	{
+		ID:        "metadata-fields",
+		Code:      "APG004",
+		Severity:  "error",
+		Summary:   "required metadata fields are missing or empty",
+		Hint:      "add non-empty values for the listed fields to metadata.json",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`^missing or empty required metadata fields: \[(.*)\]`),
+		render: func(m []string) string {
+			var fields []string
+			for _, f := range strings.Fields(m[1]) {
+				fields = append(fields, fmt.Sprintf("%q: %s", f, fieldPlaceholder(f)))
+			}
+			return "add to metadata.json: {" + strings.Join(fields, ", ") + "}"
+		},
+	},
+	{
+		ID:        "metadata-unknown-key",
+		Code:      "APG005",
+		Severity:  "error",
+		Summary:   "metadata.json has keys the APG format does not define",
+		Hint:      "rename misspelled keys as suggested and remove the others",
+		AppliesTo: allPackages,
+		Requires:  "--strict-metadata",
+		pattern:   regexp.MustCompile(`^unknown metadata keys: `),
+	},
+	{
+		ID:        "checksum-mismatch",
+		Code:      "APG006",
+		Severity:  "error",
+		Summary:   "a file does not match its recorded checksum",
+		Hint:      "regenerate stale manifests with `apgcheck -a PACKAGE.apg --fix`, or rebuild the package if the file was modified unintentionally",
+		AppliesTo: allPackages,
+		Options:   []RuleOption{{Flag: "--skip-checksums", Effect: "skip checksum verification"}},
+		pattern:   regexp.MustCompile(`^(?:\S+: )?(?:MD5|CRC32|SHA256|SHA512) mismatch for (\S+),`),
+		render: func(m []string) string {
+			return fmt.Sprintf("if %s was changed on purpose, regenerate the manifests with `apgcheck -a PACKAGE.apg --fix`; otherwise rebuild the package", m[1])
+		},
+	},
+	{
+		ID:        "checksum-orphan",
+		Code:      "APG007",
+		Severity:  "error",
+		Summary:   "a manifest lists a file the package does not ship",
+		Hint:      "ship the file or drop it from the manifest; `apgcheck -a PACKAGE.apg --fix` regenerates manifests from the shipped files",
+		AppliesTo: allPackages,
+		Options:   []RuleOption{{Flag: "--skip-checksums", Effect: "skip checksum verification"}},
+		pattern:   regexp.MustCompile(`file missing or unreadable: (\S+)`),
+	},
+	{
+		ID:        "manifest-invalid",
+		Code:      "APG008",
+		Severity:  "error",
+		Summary:   "checksums.json is malformed",
+		Hint:      "write checksums.json as {\"format\": 1, \"files\": [{\"path\", \"size\", \"mode\", \"digests\": {\"sha256\": ...}}]}, or regenerate it with `apgcheck -a PACKAGE.apg --fix`",
+		AppliesTo: binaryPackages,
+		pattern:   regexp.MustCompile(`^invalid checksum manifest `),
+	},
+	{
+		ID:        "manifest-unlisted",
+		Code:      "APG009",
+		Severity:  "error",
+		Summary:   "a shipped file is missing from checksums.json",
+		Hint:      "regenerate checksums.json with `apgcheck -a PACKAGE.apg --fix`",
+		AppliesTo: binaryPackages,
+		pattern:   regexp.MustCompile(`file not listed in checksums`),
+	},
+	{
+		ID:        "manifest-size",
+		Code:      "APG010",
+		Severity:  "error",
+		Summary:   "a file's size differs from checksums.json",
+		Hint:      "regenerate checksums.json with `apgcheck -a PACKAGE.apg --fix`, or rebuild the package if the file was modified unintentionally",
+		AppliesTo: binaryPackages,
+		pattern:   regexp.MustCompile(`^(?:\S+: )?size mismatch for \S+ in checksums(?:-\S+)?\.json,`),
+	},
+	{
+		ID:        "manifest-mode",
+		Code:      "APG011",
+		Severity:  "error",
+		Summary:   "a file's mode differs from checksums.json",
+		Hint:      "regenerate checksums.json with `apgcheck -a PACKAGE.apg --fix`, or correct the file mode before packing",
+		AppliesTo: binaryPackages,
+		pattern:   regexp.MustCompile(`^mode mismatch for `),
+	},
+	{
+		ID:        "arch-mixed-trees",
+		Code:      "APG012",
+		Severity:  "error",
+		Summary:   "a shared data/ tree is combined with per-architecture trees",
+		Hint:      "move the contents of data/ into every data-ARCH/ tree, or build one package per architecture",
+		AppliesTo: []string{"v2"},
+		pattern:   regexp.MustCompile(`mixes a shared 'data' tree`),
+	},
+	{
+		ID:        "arch-undeclared",
+		Code:      "APG013",
+		Severity:  "error",
+		Summary:   "a multi-architecture package does not declare its architectures",
+		Hint:      `add "architectures": [...] to metadata.json, listing one entry per data-ARCH/ tree`,
+		AppliesTo: []string{"v2"},
+		pattern:   regexp.MustCompile(`does not declare 'architectures'`),
+	},
+	{
+		ID:        "arch-mismatch",
+		Code:      "APG014",
+		Severity:  "error",
+		Summary:   "declared architectures differ from the payload trees",
+		Hint:      `make "architectures" in metadata.json list exactly the data-ARCH/ trees`,
+		AppliesTo: []string{"v2"},
+		pattern:   regexp.MustCompile(`^declared architectures \[.*\] do not match payload trees \[(.*)\]`),
+		render: func(m []string) string {
+			return "set in metadata.json: \"architectures\": " + jsonList(strings.Fields(m[1]))
+		},
+	},
+	{
+		ID:        "recipe-empty",
+		Code:      "APG015",
+		Severity:  "error",
+		Summary:   "the build recipe of a source package is empty",
+		Hint:      "write the build steps into the recipe file",
+		AppliesTo: []string{"source"},
+		pattern:   regexp.MustCompile(`^build recipe is empty`),
+	},
+	{
+		ID:        "source-unlisted",
+		Code:      "APG016",
+		Severity:  "error",
+		Summary:   "a shipped source file has no checksum",
+		Hint:      "regenerate sha256sums with `apgcheck --source -a PACKAGE.apg --fix`",
+		AppliesTo: []string{"source"},
+		pattern:   regexp.MustCompile(`^source file has no checksum in sha256sums`),
+	},
+	{
+		ID:        "source-missing",
+		Code:      "APG017",
+		Severity:  "error",
+		Summary:   "a declared source is not shipped",
+		Hint:      "ship the source in sources/ or remove it from \"sources\" in metadata.json",
+		AppliesTo: []string{"source"},
+		pattern:   regexp.MustCompile(`^declared source not shipped in sources/: (.*)`),
+		render: func(m []string) string {
+			return fmt.Sprintf("add sources/%s to the archive or remove it from \"sources\" in metadata.json", m[1])
+		},
+	},
+	{
+		ID:        "version-syntax",
+		Code:      "APG018",
+		Severity:  "error",
+		Summary:   "the version, epoch or release is malformed or ambiguous",
+		Hint:      `write the version as [epoch:]upstream[-release]: a non-negative epoch without leading zeros, an upstream version starting with a digit, no '-' except before the release, and only letters, digits and . + ~ _; set epoch and release either in the version or as separate fields, not both`,
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`^invalid (?:version|epoch|release) `),
+	},
+	{
+		ID:        "changelog-format",
+		Code:      "APG019",
+		Severity:  "error",
+		Summary:   "a shipped changelog is malformed or not ordered newest first",
+		Hint:      `use the Debian changelog format, newest entry first: a "name (version) distribution; urgency=..." header, indented change lines, and a " -- Name <email>  Mon, 01 Jul 2024 12:00:00 +0000" trailer`,
+		AppliesTo: binaryPackages,
+		pattern:   regexp.MustCompile(`^(?:invalid changelog |entries in changelog .* are not ordered)`),
+	},
+	{
+		ID:        "changelog-version",
+		Code:      "APG020",
+		Severity:  "error",
+		Summary:   "the newest changelog entry is not for the package version",
+		Hint:      "add a changelog entry for the version in metadata.json at the top of the changelog",
+		AppliesTo: binaryPackages,
+		pattern:   regexp.MustCompile(`^newest entry in changelog `),
+	},
+	{
+		ID:        "description-i18n",
+		Code:      "APG021",
+		Severity:  "error",
+		Summary:   "a translated description is malformed",
+		Hint:      `key description_i18n by locale codes such as "de" or "pt_BR" and give each a non-empty UTF-8 translation`,
+		AppliesTo: []string{"v2"},
+		pattern:   regexp.MustCompile(`^invalid description_i18n: `),
+	},
+	{
+		ID:        "image-reference",
+		Code:      "APG022",
+		Severity:  "error",
+		Summary:   "an icon or screenshot is missing, not an image, or a malformed URL",
+		Hint:      "list icons and screenshots as http(s) URLs or as absolute paths of PNG, JPEG, GIF, WebP, SVG, ICO or XPM images installed by the package",
+		AppliesTo: []string{"v2"},
+		pattern:   regexp.MustCompile(`^invalid (?:icons|screenshots) entry `),
+	},
+	{
+		ID:        "relation-syntax",
+		Code:      "APG023",
+		Severity:  "error",
+		Summary:   "a relation is malformed",
+		Hint:      `write relations as "name" or "name OP version" with OP one of = >= <= > <, e.g. "foo >= 1.0"`,
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`malformed relation`),
+	},
+	{
+		ID:        "dependency-unsatisfiable",
+		Code:      "APG024",
+		Severity:  "error",
+		Summary:   "no package in the repository index satisfies a dependency",
+		Hint:      "publish a package satisfying the dependency first, or relax its version constraint",
+		AppliesTo: allPackages,
+		Requires:  "--repo-index",
+		Options:   []RuleOption{{Flag: "--repo-index", Effect: "repository index dependencies are resolved against"}},
+		pattern:   regexp.MustCompile(`^unsatisfiable dependency: '([^']+)'`),
+		render: func(m []string) string {
+			return fmt.Sprintf("publish a package satisfying '%s' first, or relax the constraint", m[1])
+		},
+	},
+	{
+		ID:        "version-regression",
+		Code:      "APG025",
+		Severity:  "error",
+		Summary:   "the version is lower than the published one",
+		Hint:      "raise the version above the published one, or add an epoch if the upstream version went backwards",
+		AppliesTo: binaryPackages,
+		Requires:  "--repo-index",
+		Options:   []RuleOption{{Flag: "--repo-index", Effect: "repository index holding the published versions"}},
+		pattern:   regexp.MustCompile(`^version regression: (\S+) is lower than published version (\S+)`),
+		render: func(m []string) string {
+			return fmt.Sprintf("use a version above %s; if upstream went backwards, add an epoch: \"version\": \"1:%s\"", m[2], m[1])
+		},
+	},
+	{
+		ID:        "version-published",
+		Code:      "APG026",
+		Severity:  "error",
+		Summary:   "the version is already published",
+		Hint:      "bump the version or the release, e.g. 1.0-1 to 1.0-2",
+		AppliesTo: binaryPackages,
+		Requires:  "--repo-index",
+		Options:   []RuleOption{{Flag: "--repo-index", Effect: "repository index holding the published versions"}},
+		pattern:   regexp.MustCompile(`is already published`),
+	},
+	{
+		ID:        "license-incompatible",
+		Code:      "APG027",
+		Severity:  "warning",
+		Summary:   "the package license is incompatible with the license of a library it depends on",
+		Hint:      "have the licensing reviewed: relicense the package, choose a compatibly licensed library, or use a library license alternative or exception that allows linking",
+		AppliesTo: binaryPackages,
+		Requires:  "--repo-index",
+		pattern:   regexp.MustCompile(`^license incompatibility: `),
+	},
+	{
+		ID:        "license-expression",
+		Code:      "APG028",
+		Severity:  "warning",
+		Summary:   "the license is not a valid SPDX license expression",
+		Hint:      `write the license as an SPDX expression, e.g. "MIT" or "GPL-2.0-or-later OR Apache-2.0"`,
+		AppliesTo: binaryPackages,
+		Requires:  "--repo-index",
+		pattern:   regexp.MustCompile(`^invalid license expression `),
+	},
+	{
+		ID:        "file-license",
+		Code:      "APG029",
+		Severity:  "warning",
+		Summary:   "a shipped file is under a license the package license does not include",
+		Hint:      "add the file's license to the package license expression and ship its text for attribution, e.g. \"GPL-2.0-or-later AND MIT\"",
+		AppliesTo: binaryPackages,
+		Requires:  "--scan-licenses",
+		pattern:   regexp.MustCompile(`^file under a different license than the package`),
+	},
+	{
+		ID:        "index-metadata",
+		Code:      "APG030",
+		Severity:  "error",
+		Summary:   "repository index metadata differs from the package",
+		Hint:      "regenerate the index with `apgcheck index build DIR -o index.json`",
+		AppliesTo: []string{"index"},
+		pattern:   regexp.MustCompile(`^index metadata differs from package metadata`),
+	},
+	{
+		ID:        "path-limit",
+		Code:      "APG031",
+		Severity:  "error",
+		Summary:   "an entry path is too long or too deeply nested",
+		Hint:      "shorten or flatten the path, or raise the limit with --max-path-length, --max-name-length or --max-path-depth",
+		AppliesTo: []string{"v1", "v2", "source", "delta"},
+		Options: []RuleOption{
+			{Policy: "limits.max_path_length", Flag: "--max-path-length", Effect: "maximum length in bytes of an installed path, at most 4095 (0 for no limit)"},
+			{Policy: "limits.max_name_length", Flag: "--max-name-length", Effect: "maximum length in bytes of a path component, at most 255 (0 for no limit)"},
+			{Policy: "limits.max_path_depth", Flag: "--max-path-depth", Effect: "maximum number of components in an installed path (0 for no limit)"},
+		},
+		pattern: regexp.MustCompile(`\((max_path_length|max_name_length|max_path_depth)\)$`),
+		render: func(m []string) string {
+			return fmt.Sprintf("shorten or flatten the path, or raise %s in a --policy file (or with the matching flag)", m[1])
+		},
+	},
+	{
+		ID:        "resource-limit",
+		Code:      "APG032",
+		Severity:  "error",
+		Summary:   "the archive exceeds an extraction resource limit",
+		Hint:      "shrink the package, or raise the limit with --max-size, --max-file-size, --max-entries, --max-disk or a --policy file if the size is legitimate",
+		AppliesTo: []string{"v1", "v2", "source", "delta"},
+		Options: []RuleOption{
+			{Policy: "limits.max_total_size_mb", Flag: "--max-size", Effect: "maximum total uncompressed size in MB (0 for no limit)"},
+			{Policy: "limits.max_file_size_mb", Flag: "--max-file-size", Effect: "maximum size of a single entry in MB (0 for no limit)"},
+			{Policy: "limits.max_entries", Flag: "--max-entries", Effect: "maximum number of entries (0 for no limit)"},
+			{Policy: "limits.max_disk_mb", Flag: "--max-disk", Effect: "maximum bytes in MB written to disk (0 for no quota)"},
+		},
+		pattern: regexp.MustCompile(`\((max_[a-z_]+)\)$`),
+		render: func(m []string) string {
+			return fmt.Sprintf("shrink the package, or raise %s in a --policy file (or with the matching flag) if the size is legitimate", m[1])
+		},
+	},
+	{
+		ID:        "archive-unsorted",
+		Code:      "APG033",
+		Severity:  "warning",
+		Summary:   "archive entries are not in sorted order",
+		Hint:      "create the archive with sorted entries, e.g. `tar --sort=name`",
+		AppliesTo: allPackages,
+		Options:   []RuleOption{deterministicOption},
+		pattern:   regexp.MustCompile(`^archive entries are not sorted`),
+	},
+	{
+		ID:        "archive-mtime",
+		Code:      "APG034",
+		Severity:  "warning",
+		Summary:   "archive entry mtimes are not fixed",
+		Hint:      "set every mtime to SOURCE_DATE_EPOCH, e.g. `tar --mtime=@$SOURCE_DATE_EPOCH`",
+		AppliesTo: allPackages,
+		Options:   []RuleOption{deterministicOption},
+		pattern:   regexp.MustCompile(`^entry mtime`),
+	},
+	{
+		ID:        "archive-owner",
+		Code:      "APG035",
+		Severity:  "warning",
+		Summary:   "archive entries carry build-user ownership",
+		Hint:      "zero the owners, e.g. `tar --owner=0 --group=0 --numeric-owner`",
+		AppliesTo: allPackages,
+		Options:   []RuleOption{deterministicOption},
+		pattern:   regexp.MustCompile(`^entry ownership is not zeroed`),
+	},
+	{
+		ID:        "archive-format",
+		Code:      "APG036",
+		Severity:  "error",
+		Summary:   "the archive uses a tar format the policy does not allow",
+		Hint:      "re-create the archive in an allowed format, e.g. `tar --format=pax` (or `--format=ustar`)",
+		AppliesTo: allPackages,
+		Requires:  "--tar-formats",
+		Options:   []RuleOption{{Policy: "archive.allowed_formats", Flag: "--tar-formats", Effect: "tar formats the archive may use (empty for any)"}},
+		pattern:   regexp.MustCompile(`^tar format \S+ is not allowed by policy \(allowed: ([^)]*)\)`),
+		render: func(m []string) string {
+			return fmt.Sprintf("re-create the archive in one of the allowed formats (%s), e.g. `tar --format=pax`", m[1])
+		},
+	},
+	{
+		ID:        "archive-sparse",
+		Code:      "APG037",
+		Severity:  "error",
+		Summary:   "the archive contains sparse file entries the policy does not allow",
+		Hint:      "re-create the archive without `tar --sparse` so the file is stored in full",
+		AppliesTo: allPackages,
+		Requires:  "--reject-sparse",
+		Options:   []RuleOption{{Policy: "archive.allow_sparse", Flag: "--reject-sparse", Effect: "whether sparse file entries are allowed; --reject-sparse disallows them"}},
+		pattern:   regexp.MustCompile(`^sparse file entry is not allowed by policy`),
+	},
+	{
+		ID:        "hardlink-target",
+		Code:      "APG038",
+		Severity:  "error",
+		Summary:   "a hard link does not point at a regular file stored earlier in the archive",
+		Hint:      "link only to files inside the package, and store the target before the link, e.g. with `tar --sort=name` on the package tree",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`^hardlink target is not a regular file earlier in the archive`),
+	},
+	{
+		ID:        "path-collision",
+		Code:      "APG039",
+		Severity:  "error",
+		Summary:   "the archive uses the same path as a directory and as a file or link",
+		Hint:      "make sure each path is either a directory or a file in the package tree, then rebuild the archive",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`^path collision: `),
+	},
+	{
+		ID:        "package-size",
+		Code:      "APG040",
+		Severity:  "warning",
+		Summary:   "the compressed or installed size of the package is over a size threshold",
+		Hint:      "check that no build artifacts, debug data or test files ended up in the package, or split it into subpackages",
+		AppliesTo: allPackages,
+		Options: []RuleOption{
+			{Policy: "size.warn_compressed_mb", Effect: "compressed size above which a warning is reported"},
+			{Policy: "size.error_compressed_mb", Effect: "compressed size above which an error is reported"},
+			{Policy: "size.warn_installed_mb", Effect: "installed size above which a warning is reported"},
+			{Policy: "size.error_installed_mb", Effect: "installed size above which an error is reported"},
+		},
+		pattern: regexp.MustCompile(`^package (is large|too large): `),
+	},
+	{
+		ID:        "compression-settings",
+		Code:      "APG041",
+		Severity:  "warning",
+		Summary:   "the xz settings of the archive deviate from the repository standard",
+		Hint:      "recompress the package tree with the xz command the message suggests",
+		AppliesTo: allPackages,
+		Options: []RuleOption{
+			{Policy: "compression.action", Effect: "report deviations as an error, a warning, or ignore them"},
+			{Policy: "compression.max_dictionary_mb", Effect: "largest dictionary allowed, bounding decompression memory"},
+			{Policy: "compression.min_dictionary_mb", Effect: "smallest dictionary allowed for packages larger than it"},
+			{Policy: "compression.min_block_mb", Effect: "smallest xz block allowed in multi-block archives"},
+		},
+		pattern: regexp.MustCompile(`^compression settings`),
+	},
+	{
+		ID:        "entry-type",
+		Code:      "APG042",
+		Severity:  "warning",
+		Summary:   "the archive contains entries of a type apgcheck does not extract",
+		Hint:      "remove device nodes, FIFOs and other special files from the package; create them at install time if they are needed",
+		AppliesTo: allPackages,
+		Options:   []RuleOption{{Policy: "archive.unknown_entries", Flag: "--unknown-entries", Effect: "report such entries as an error, a warning, or skip them silently"}},
+		pattern:   regexp.MustCompile(`^unsupported entry type`),
+	},
+	{
+		ID:        "name-encoding",
+		Code:      "APG043",
+		Severity:  "error",
+		Summary:   "an entry name or link target is not valid UTF-8",
+		Hint:      "rename the file to a UTF-8 name, e.g. with `convmv -f latin1 -t utf8`",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`is not valid UTF-8: `),
+	},
+	{
+		ID:        "name-invisible",
+		Code:      "APG044",
+		Severity:  "error",
+		Summary:   "an entry name or link target contains bidirectional or zero-width characters",
+		Hint:      "rename the file without the invisible character; it makes the path display differently from what it is",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`contains invisible character U\+`),
+	},
+	{
+		ID:        "name-confusable",
+		Code:      "APG045",
+		Severity:  "warning",
+		Summary:   "an entry name or link target uses characters that look like others",
+		Hint:      "rename the file using plain ASCII characters, or letters of a single script per path component",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`contains confusable character`),
+	},
+	{
+		ID:        "name-case-collision",
+		Code:      "APG046",
+		Severity:  "warning",
+		Summary:   "two paths differ only by case",
+		Hint:      "rename one of the paths; they overwrite each other when the package is unpacked on a case-insensitive filesystem",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`^paths differ only by case`),
+	},
+	{
+		ID:        "xattr-denied",
+		Code:      "APG047",
+		Severity:  "error",
+		Summary:   "an entry carries extended attributes the policy does not allow",
+		Hint:      "pack without the attributes, e.g. `tar --no-xattrs` or `--xattrs-exclude`, or allow them with --allowed-xattrs",
+		AppliesTo: allPackages,
+		Requires:  "--allowed-xattrs",
+		Options:   []RuleOption{{Policy: "archive.allowed_xattrs", Flag: "--allowed-xattrs", Effect: "extended attribute name patterns entries may carry (unset for any)"}},
+		pattern:   regexp.MustCompile(`^extended attributes are not allowed by policy \(allowed: [^)]*\): \S+ has (.*)`),
+		render: func(m []string) string {
+			return fmt.Sprintf("drop %s when packing, e.g. with `tar --xattrs-exclude=PATTERN`, or allow it with --allowed-xattrs or allowed_xattrs in a --policy file", m[1])
+		},
+	},
+	{
+		ID:        "capability-malformed",
+		Code:      "APG048",
+		Severity:  "error",
+		Summary:   "a security.capability xattr cannot be decoded",
+		Hint:      "set the capabilities again with `setcap` before packing, and pack with `tar --xattrs`",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`^malformed security.capability xattr`),
+	},
+	{
+		ID:        "capability-denied",
+		Code:      "APG049",
+		Severity:  "error",
+		Summary:   "a file carries capabilities the policy does not allow",
+		Hint:      "drop the capabilities with `setcap -r`, or allow them for the path under archive.allowed_capabilities in a --policy file",
+		AppliesTo: allPackages,
+		Options:   []RuleOption{{Policy: "archive.allowed_capabilities", Effect: "capabilities each installed path may carry"}},
+		pattern:   regexp.MustCompile(`^file capabilities are not allowed by policy: (\S+) has (\S+)`),
+		render: func(m []string) string {
+			return fmt.Sprintf("drop the capabilities with `setcap -r %s`, or allow them in a --policy file: \"allowed_capabilities\": {\"%s\": %s}", m[1], m[1], jsonList(strings.Split(m[2], ",")))
+		},
+	},
+	{
+		ID:        "static-library",
+		Code:      "APG050",
+		Severity:  "warning",
+		Summary:   "a package other than a -dev package ships static libraries",
+		Hint:      "move .a archives into a NAME-dev package along with the headers, keeping the runtime package small",
+		AppliesTo: binaryPackages,
+		Options:   []RuleOption{{Policy: "packaging.static_libraries", Flag: "--static-libs", Effect: "report static libraries as an error, a warning, or ignore them"}},
+		pattern:   regexp.MustCompile(`^static library in a non-development package`),
+	},
+	{
+		ID:        "bundled-library",
+		Code:      "APG051",
+		Severity:  "warning",
+		Summary:   "the package ships a private copy of a common system library",
+		Hint:      "link against the system library and depend on its package, so security updates reach this package too",
+		AppliesTo: binaryPackages,
+		Options:   []RuleOption{{Policy: "packaging.bundled_libraries", Effect: "report bundled libraries as an error, a warning, or ignore them"}},
+		pattern:   regexp.MustCompile(`^bundled copy of a system library`),
+	},
+	{
+		ID:        "runpath",
+		Code:      "APG052",
+		Severity:  "error",
+		Summary:   "an ELF RPATH or RUNPATH makes the loader search an unsafe directory",
+		Hint:      "drop the RPATH/RUNPATH (e.g. with -DCMAKE_SKIP_RPATH=ON or patchelf --remove-rpath), or use $ORIGIN paths that stay within the package",
+		AppliesTo: binaryPackages,
+		Options:   []RuleOption{{Policy: "packaging.runpaths", Effect: "report insecure search paths as an error, a warning, or ignore them"}},
+		pattern:   regexp.MustCompile(`^insecure (?:RPATH|RUNPATH) in `),
+	},
+	{
+		ID:        "elf-hardening",
+		Code:      "APG053",
+		Severity:  "warning",
+		Summary:   "an ELF binary was built without a hardening feature",
+		Hint:      "build with -fPIE -pie, -Wl,-z,relro,-z,now, -fstack-protector-strong and -Wl,-z,noexecstack, e.g. through the distribution's default CFLAGS and LDFLAGS",
+		AppliesTo: binaryPackages,
+		Options: []RuleOption{
+			{Policy: "packaging.hardening.pie", Effect: "set the severity for executables that are not position-independent"},
+			{Policy: "packaging.hardening.relro", Effect: "set the severity for dynamic binaries without RELRO"},
+			{Policy: "packaging.hardening.stack_protector", Effect: "set the severity for executables without a stack protector (ignored by default)"},
+			{Policy: "packaging.hardening.nx", Effect: "set the severity for binaries with an executable stack"},
+		},
+		pattern: regexp.MustCompile(`^missing hardening in `),
+	},
+	{
+		ID:        "script-interpreter",
+		Code:      "APG054",
+		Severity:  "warning",
+		Summary:   "a script's interpreter is neither shipped nor a dependency",
+		Hint:      "add the package providing the interpreter, e.g. python3 or perl, to dependencies",
+		AppliesTo: binaryPackages,
+		Options:   []RuleOption{{Policy: "packaging.interpreters", Effect: "report undeclared interpreters as an error, a warning, or ignore them"}},
+		pattern:   regexp.MustCompile(`^script interpreter not shipped or declared`),
+	},
+	{
+		ID:        "content-mismatch",
+		Code:      "APG055",
+		Severity:  "warning",
+		Summary:   "a file's content does not match its path",
+		Hint:      "check that the right file was installed: machine code belongs under /usr/bin or /usr/lib, and files named .png, .sh and so on must have that content",
+		AppliesTo: binaryPackages,
+		Options:   []RuleOption{{Policy: "packaging.content_types", Effect: "report mismatches as an error, a warning, or ignore them"}},
+		pattern:   regexp.MustCompile(`^content does not match the path`),
+	},
+	{
+		ID:        "conf-path",
+		Code:      "APG056",
+		Severity:  "error",
+		Summary:   "a conf entry is outside the configuration directories or not installed",
+		Hint:      "list only configuration files the package installs under /etc, or under a prefix the policy allows in packaging.config_prefixes",
+		AppliesTo: []string{"v2"},
+		Options:   []RuleOption{{Policy: "packaging.config_prefixes", Effect: "directories conf entries may point into (default /etc)"}},
+		pattern:   regexp.MustCompile(`^conf entry is `),
+	},
+	{
+		ID:        "conf-unlisted",
+		Code:      "APG057",
+		Severity:  "warning",
+		Summary:   "a file in a configuration directory is not listed in conf",
+		Hint:      "add the file to conf so upgrades preserve local changes to it",
+		AppliesTo: []string{"v2"},
+		Options:   []RuleOption{{Policy: "packaging.config_prefixes", Effect: "directories whose files must be listed (default /etc)"}},
+		pattern:   regexp.MustCompile(`^configuration file is not listed in conf`),
+	},
+	{
+		ID:        "conf-text",
+		Code:      "APG058",
+		Severity:  "warning",
+		Summary:   "a file under /etc has a byte order mark, binary data or no final newline",
+		Hint:      "save configuration files as UTF-8 text without a byte order mark, ending in a newline",
+		AppliesTo: binaryPackages,
+		Options:   []RuleOption{{Policy: "packaging.config_text", Effect: "report such files as an error, a warning, or ignore them"}},
+		pattern:   regexp.MustCompile(`^configuration file is not clean text`),
+	},
+	{
+		ID:        "runtime-path",
+		Code:      "APG059",
+		Severity:  "error",
+		Summary:   "a file is installed into /run, /var/run, /proc or /sys",
+		Hint:      "these directories are populated at run time; create runtime files from the service or with a tmpfiles.d entry instead",
+		AppliesTo: binaryPackages,
+		Options:   []RuleOption{{Policy: "packaging.runtime_paths", Effect: "report such files as an error, a warning, or ignore them"}},
+		pattern:   regexp.MustCompile(`^file in a runtime directory`),
+	},
+	{
+		ID:        "split-package",
+		Code:      "APG060",
+		Severity:  "warning",
+		Summary:   "documentation, development files or debug information make up most of the package",
+		Hint:      "move them into the suggested -doc, -dev or -dbg subpackage, or strip debug sections from the binaries",
+		AppliesTo: binaryPackages,
+		Options:   []RuleOption{{Policy: "packaging.split_suggestions", Effect: "report such packages as an error, a warning, or ignore them"}},
+		pattern:   regexp.MustCompile(`^consider splitting `),
+	},
+	{
+		ID:        "provides-name",
+		Code:      "APG061",
+		Severity:  "warning",
+		Summary:   "a provides entry does not follow the virtual package naming conventions",
+		Hint:      "name virtuals as namespace(argument), e.g. soname(libfoo.so.1) or cmd(foo), for sonames and commands the package really ships",
+		AppliesTo: binaryPackages,
+		Options: []RuleOption{
+			{Policy: "provides.action", Effect: "report violations as an error, a warning, or ignore them"},
+			{Policy: "provides.allow_plain", Effect: "allow provided names outside any namespace"},
+			{Policy: "provides.namespaces", Effect: "namespaces and the pattern their arguments must match"},
+		},
+		pattern: regexp.MustCompile(`^invalid provides '`),
+	},
+	{
+		ID:        "self-relation",
+		Code:      "APG062",
+		Severity:  "warning",
+		Summary:   "the package depends on, provides, replaces or conflicts with itself",
+		Hint:      "remove the entry; a package always satisfies relations on its own name and the virtuals it provides",
+		AppliesTo: binaryPackages,
+		pattern:   regexp.MustCompile(`^trivial relation: `),
+	},
+	{
+		ID:        "base-file-overlap",
+		Code:      "APG063",
+		Severity:  "error",
+		Summary:   "the package would overwrite a file of the base system",
+		Hint:      "install the file under another name, or declare the owning package in replaces if this package takes over its files",
+		AppliesTo: binaryPackages,
+		Requires:  "--base-manifest",
+		pattern:   regexp.MustCompile(`^overwrites base system file`),
+	},
+	{
+		ID:        "bundle-file-overlap",
+		Code:      "APG064",
+		Severity:  "error",
+		Summary:   "split packages ship the same file",
+		Hint:      "move the file into exactly one of the split packages",
+		AppliesTo: []string{"bundle"},
+		pattern:   regexp.MustCompile(`is shipped by more than one package`),
+	},
+	{
+		ID:        "bundle-version",
+		Code:      "APG065",
+		Severity:  "error",
+		Summary:   "split packages have different versions",
+		Hint:      "build all split packages from the same source version",
+		AppliesTo: []string{"bundle"},
+		pattern:   regexp.MustCompile(`^version mismatch: `),
+	},
+	{
+		ID:        "bundle-dev-dependency",
+		Code:      "APG066",
+		Severity:  "error",
+		Summary:   "a -dev package does not depend on its main package",
+		Hint:      "add an exact dependency on the main package to the -dev package",
+		AppliesTo: []string{"bundle"},
+		pattern:   regexp.MustCompile(`^(\S+) does not depend on (\S+) (\S+)$`),
+		render: func(m []string) string {
+			return fmt.Sprintf("add to the dependencies of %s: \"%s = %s\"", m[1], m[2], m[3])
+		},
+	},
+	{
+		ID:        "delta-reconstruction",
+		Code:      "APG067",
+		Severity:  "error",
+		Summary:   "applying the delta does not reproduce the target package",
+		Hint:      "regenerate the delta from the exact base and target packages",
+		AppliesTo: []string{"delta"},
+		Requires:  "--target",
+		Options: []RuleOption{
+			{Flag: "--base", Effect: "package the delta applies to"},
+			{Flag: "--target", Effect: "package the delta must reconstruct"},
+		},
+		pattern: regexp.MustCompile(`^reconstruct`),
+	},
+	{
+		ID:        "suppression-invalid",
+		Code:      "APG068",
+		Severity:  "warning",
+		Summary:   "an x-apgcheck suppression in metadata.json is malformed or not allowed",
+		Hint:      "give each suppression a known rule ID or code and a reason, and suppress only warnings unless the policy allows errors",
+		AppliesTo: allPackages,
+		Options: []RuleOption{
+			{Policy: "suppressions.enabled", Effect: "honor suppressions in packages at all"},
+			{Policy: "suppressions.errors", Effect: "allow suppressions to silence errors"},
+		},
+		pattern: regexp.MustCompile(`^invalid suppression: `),
+	},
+	{
+		ID:        "rule-budget",
+		Code:      "APG069",
+		Severity:  "warning",
+		Summary:   "a check was skipped because it ran out of the time or memory budget the policy gives its rule",
+		Hint:      "raise the budget in the policy, or check the package without it where time allows",
+		AppliesTo: binaryPackages,
+		Options: []RuleOption{
+			{Policy: "budgets.<rule>.timeout_ms", Effect: "time a check may run before it is skipped"},
+			{Policy: "budgets.<rule>.max_memory_mb", Effect: "heap a check may grow before it is skipped"},
+		},
+		pattern: regexp.MustCompile(`^check skipped: `),
+	},
+	{
+		ID:        "nested-package",
+		Code:      "APG070",
+		Severity:  "error",
+		Summary:   "an APG package shipped in the payload is invalid or cannot be read",
+		Hint:      "validate the inner package on its own with `apgcheck -a` and fix it before bundling it; its findings are listed under `nested` in the JSON report",
+		AppliesTo: binaryPackages,
+		pattern:   regexp.MustCompile(`^nested package \S+ (is invalid|cannot be validated)`),
+	},
+	{
+		ID:        "nested-limit",
+		Code:      "APG071",
+		Severity:  "error",
+		Summary:   "packages are nested deeper or in greater number than the policy allows",
+		Hint:      "flatten the bundle, or raise the limit in a --policy file (or with the matching flag) if the nesting is legitimate",
+		AppliesTo: binaryPackages,
+		Options: []RuleOption{
+			{Policy: "nested.max_depth", Flag: "--max-nesting-depth", Effect: "levels of packages inside packages that are validated (0 to not validate nested packages)"},
+			{Policy: "nested.max_packages", Flag: "--max-nested-packages", Effect: "maximum number of nested packages in one package at all levels (0 for no limit)"},
+		},
+		pattern: regexp.MustCompile(`^nested package \S+ (exceeds|is over) .*\(nested\.(max_depth|max_packages)\)$`),
+	},
+	{
+		ID:        "uncompressed-archive",
+		Code:      "APG072",
+		Severity:  "warning",
+		Summary:   "the package is an uncompressed tar, which is accepted for development but not for publishing",
+		Hint:      "compress the archive with `xz -6 -T0 --check=crc64` before publishing it",
+		AppliesTo: binaryPackages,
+		pattern:   regexp.MustCompile(`^archive is an uncompressed tar`),
+	},
+	{
+		ID:        "index-size",
+		Code:      "APG073",
+		Severity:  "error",
+		Summary:   "a package's size differs from the one recorded in the repository index",
+		Hint:      "the package file changed after it was indexed; restore the indexed file, and only rebuild the index with `apgcheck index build` once the new file is known to be legitimate",
+		AppliesTo: []string{"index"},
+		pattern:   regexp.MustCompile(`^index size mismatch for `),
+	},
+	{
+		ID:        "index-digest",
+		Code:      "APG074",
+		Severity:  "error",
+		Summary:   "a package's SHA-256 differs from the one recorded in the repository index",
+		Hint:      "the package file changed after it was indexed; restore the indexed file, and only rebuild the index with `apgcheck index build` once the new file is known to be legitimate",
+		AppliesTo: []string{"index"},
+		pattern:   regexp.MustCompile(`^index SHA256 mismatch for `),
+	},
+	{
+		ID:        "index-filename",
+		Code:      "APG075",
+		Severity:  "error",
+		Summary:   "a repository index entry names a file outside the index directory",
+		Hint:      "index entries must name packages by a relative path within the index directory; regenerate the index with `apgcheck index build DIR -o index.json`",
+		AppliesTo: []string{"index"},
+		pattern:   regexp.MustCompile(`^index filename is not a path within the index directory`),
+	},
+	{
+		ID:        "path-escape",
+		Code:      "APG076",
+		Severity:  "error",
+		Summary:   "an entry name leads outside the package, such as through `..` or a symlink",
+		Hint:      "archive the package tree with relative names, e.g. `tar -C pkgroot -cJf foo.apg .`",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`^entry path leaves the package(?: through a symlink)?: `),
+	},
+	{
+		ID:        "sums-path",
+		Code:      "APG077",
+		Severity:  "error",
+		Summary:   "a checksum list such as md5sums names a file outside the tree it covers",
+		Hint:      "list files by their path within the tree, e.g. `usr/bin/foo`; `apgcheck -a PACKAGE.apg --fix` regenerates the lists",
+		AppliesTo: allPackages,
+		pattern:   regexp.MustCompile(`^\S+ lists a path outside \S+/: `),
+	},
+}
+
+// Rules returns the catalog of known rules.
+func Rules() []Rule {
+	catalog := slices.Clone(rules)
+	for i := range catalog {
+		if catalog[i].Options == nil {
+			catalog[i].Options = []RuleOption{}
+		}
+		catalog[i].DocsURL = RulesURL + "#" + strings.ToLower(catalog[i].Code)
+	}
+	return catalog
+}
+
+// RuleByID returns the rule with the given ID or code.
+func RuleByID(id string) (Rule, bool) {
+	for _, r := range Rules() {
+		if r.ID == id || strings.EqualFold(r.Code, id) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+func classify(message string) (*Rule, []string) {
+	for i := range rules {
+		if m := rules[i].pattern.FindStringSubmatch(message); m != nil {
+			return &rules[i], m
+		}
+	}
+	return nil, nil
+}
+
+// HintFor returns the remediation hint for a finding message, or an empty
+// string when no rule covers it.
+func HintFor(message string) string {
+	rule, m := classify(message)
+	if rule == nil {
+		return ""
+	}
+	if rule.render != nil {
+		return rule.render(m)
+	}
+	return rule.Hint
+}
+
+// CodeFor returns the code of the rule covering a finding message, or an
+// empty string.
+func CodeFor(message string) string {
+	if rule, _ := classify(message); rule != nil {
+		return rule.Code
+	}
+	return ""
+}
+
+func newFinding(severity, message string) Finding {
+	f := Finding{Severity: severity, Message: message, Hint: HintFor(message)}
+	if rule, _ := classify(message); rule != nil {
+		f.Rule, f.Code = rule.ID, rule.Code
+	}
+	return f
+}
+
+func findingsOf(errs, warnings []string) []Finding {
+	findings := []Finding{}
+	for _, e := range errs {
+		findings = append(findings, newFinding("error", e))
+	}
+	for _, w := range warnings {
+		findings = append(findings, newFinding("warning", w))
+	}
+	return findings
+}
+
+func (r *ValidationResponse) annotate() {
+	r.Findings = findingsOf(r.Errors, r.Warnings)
+}
+
+func fieldPlaceholder(field string) string {
+	switch field {
+	case "tags", "dependencies", "conflicts", "provides", "replaces", "conf", "sources", "build_dependencies":
+		return `["..."]`
+	}
+	return `"..."`
+}
+
+func jsonList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, s := range items {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import "time"
+
+// SandboxCommand is the hidden command line argument that makes apgcheck
+// run as a sandboxed validation child; see RunSandbox.
+const SandboxCommand = "__sandbox"
+
+// sandboxRequest carries the checker settings into the sandbox. File is
+// the name to report, Path the absolute path of the package to bind.
+type sandboxRequest struct {
+	File           string       `json:"file"`
+	Path           string       `json:"path"`
+	Version        int          `json:"version"`
+	Verbose        bool         `json:"verbose"`
+	SkipChecksums  bool         `json:"skip_checksums"`
+	SourcePackage  bool         `json:"source_package"`
+	Profiling      bool         `json:"profiling"`
+	ScanLicenses   bool         `json:"scan_licenses"`
+	StrictMetadata bool         `json:"strict_metadata"`
+	Harden         bool         `json:"harden"`
+	Threads        int          `json:"threads"`
+	Colors         Colors       `json:"colors"`
+	Policy         Policy       `json:"policy"`
+	RepoIndex      *RepoIndex   `json:"repo_index,omitempty"`
+	BaseManifest   BaseManifest `json:"base_manifest,omitempty"`
+}
+
+type sandboxResponse struct {
+	Report ValidationResponse `json:"report"`
+	Files  []string           `json:"files,omitempty"`
+	Error  string             `json:"error,omitempty"`
+}
+
+func (c *Checker) sandboxRequest(apgFile, path string, apgVersion int) sandboxRequest {
+	return sandboxRequest{
+		File:           apgFile,
+		Path:           path,
+		Version:        apgVersion,
+		Verbose:        c.Verbose,
+		SkipChecksums:  c.SkipChecksums,
+		SourcePackage:  c.SourcePackage,
+		Profiling:      c.profile != nil,
+		ScanLicenses:   c.ScanLicenses,
+		StrictMetadata: c.StrictMetadata,
+		Harden:         c.Harden,
+		Threads:        c.Threads,
+		Colors:         c.Colors,
+		Policy:         c.Policy,
+		RepoIndex:      c.RepoIndex,
+		BaseManifest:   c.BaseManifest,
+	}
+}
+
+// mergeProfile adds the timings recorded in the sandbox to the profile of
+// this process.
+func (c *Checker) mergeProfile(child *Profile) {
+	if c.profile == nil || child == nil {
+		return
+	}
+	for _, t := range child.Timings {
+		if t.Name != "total" {
+			c.profile.addCalls(t.Name, time.Duration(t.Milliseconds*float64(time.Millisecond)), t.Calls)
+		}
+	}
+	c.profile.PeakMemoryBytes = max(c.profile.PeakMemoryBytes, child.PeakMemoryBytes)
+}
@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+// validateSandboxed validates a package in a child process running in new
+// user, mount, network and IPC namespaces. The child mounts a private
+// tmpfs, binds the package into it read-only and makes it the root of the
+// mount namespace, so the extractor cannot reach the host filesystem even
+// if it is subverted.
+func (c *Checker) validateSandboxed(apgFile string, apgVersion int) (ValidationResponse, error) {
+	report := ValidationResponse{Version: apgVersion, File: apgFile, Errors: []string{}, Warnings: []string{}}
+
+	path, err := filepath.Abs(apgFile)
+	if err != nil {
+		return report, fmt.Errorf("cannot open archive: %w", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return report, fmt.Errorf("cannot stat archive: %w", err)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return report, fmt.Errorf("sandbox unavailable: %w", err)
+	}
+	request, err := json.Marshal(c.sandboxRequest(apgFile, path, apgVersion))
+	if err != nil {
+		return report, err
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(self, SandboxCommand)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	c.log("Validating in a sandbox...")
+	stop := c.track("sandbox")
+	runErr := cmd.Run()
+	stop()
+
+	var resp sandboxResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		if runErr != nil {
+			return report, fmt.Errorf("sandbox unavailable: %w", runErr)
+		}
+		return report, fmt.Errorf("sandbox returned no result: %w", err)
+	}
+	if resp.Error != "" {
+		return report, errors.New(resp.Error)
+	}
+	report = resp.Report
+	report.Files = resp.Files
+	c.mergeProfile(report.Profile)
+	report.Profile = nil
+	return report, nil
+}
+
+// RunSandbox is the entry point of the sandboxed child started by
+// validateSandboxed. It reads the request from stdin, confines itself and
+// writes the result to stdout, returning the process exit code.
+func RunSandbox() int {
+	var req sandboxRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		return writeSandboxResponse(sandboxResponse{Error: fmt.Sprintf("invalid sandbox request: %v", err)})
+	}
+	if err := confine(req.Path, req.Policy.Limits.MaxDiskMB); err != nil {
+		return writeSandboxResponse(sandboxResponse{Error: fmt.Sprintf("sandbox setup failed: %v", err)})
+	}
+	if req.Harden {
+		if err := Harden([]string{"/"}); err != nil && !errors.Is(err, ErrNoLandlock) {
+			return writeSandboxResponse(sandboxResponse{Error: fmt.Sprintf("sandbox setup failed: %v", err)})
+		}
+	}
+
+	c := New(req.Verbose, req.SkipChecksums, req.Colors, req.Policy.Limits.MaxTotalSizeMB)
+	c.Policy = req.Policy
+	c.SourcePackage = req.SourcePackage
+	c.ScanLicenses = req.ScanLicenses
+	c.StrictMetadata = req.StrictMetadata
+	c.Threads = req.Threads
+	c.RepoIndex = req.RepoIndex
+	c.BaseManifest = req.BaseManifest
+	c.TempDir = "/"
+	if req.Profiling {
+		c.profile = &Profile{}
+	}
+
+	report, err := c.validateFile(sandboxPackage, req.Version)
+	if err != nil {
+		return writeSandboxResponse(sandboxResponse{Error: err.Error()})
+	}
+	report.File = req.File
+	if c.profile != nil {
+		c.profile.close()
+		c.profile.PeakMemoryBytes = peakMemory()
+		report.Profile = c.profile
+	}
+	return writeSandboxResponse(sandboxResponse{Report: report, Files: report.Files})
+}
+
+// sandboxPackage is where the package appears inside the sandbox, whose
+// root is the tmpfs mounted at sandboxRoot.
+const (
+	sandboxRoot    = "/tmp"
+	sandboxPackage = "/package.apg"
+	sandboxOldRoot = "/.oldroot"
+)
+
+// confine mounts an empty tmpfs over sandboxRoot, visible only in the new
+// mount namespace, binds the package at path into it read-only and pivots
+// the root there. The old root is then detached: a chroot would leave it
+// mounted, and root in the user namespace could escape back to it.
+// maxDiskMB, when set, also bounds the size of the tmpfs.
+func confine(path string, maxDiskMB int64) error {
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	// The package may live below sandboxRoot, so it is opened before the
+	// tmpfs hides it and bound through its descriptor.
+	pkg, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open archive: %w", err)
+	}
+	defer pkg.Close()
+
+	options := "mode=0755"
+	if maxDiskMB > 0 {
+		options += fmt.Sprintf(",size=%dm", maxDiskMB+1)
+	}
+	if err := syscall.Mount("tmpfs", sandboxRoot, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, options); err != nil {
+		return fmt.Errorf("mount tmpfs: %w", err)
+	}
+	target := sandboxRoot + sandboxPackage
+	if err := os.WriteFile(target, nil, 0444); err != nil {
+		return err
+	}
+	if err := syscall.Mount(fmt.Sprintf("/proc/self/fd/%d", pkg.Fd()), target, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind package: %w", err)
+	}
+	if err := syscall.Mount("", target, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("remount package read-only: %w", err)
+	}
+	oldRoot := sandboxRoot + sandboxOldRoot
+	if err := os.Mkdir(oldRoot, 0700); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(sandboxRoot, oldRoot); err != nil {
+		return fmt.Errorf("pivot root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := syscall.Unmount(sandboxOldRoot, syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach old root: %w", err)
+	}
+	return os.Remove(sandboxOldRoot)
+}
+
+func writeSandboxResponse(resp sandboxResponse) int {
+	if err := json.NewEncoder(os.Stdout).Encode(resp); err != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,22 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !linux
+
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+func (c *Checker) validateSandboxed(apgFile string, apgVersion int) (ValidationResponse, error) {
+	report := ValidationResponse{Version: apgVersion, File: apgFile, Errors: []string{}, Warnings: []string{}}
+	return report, errors.New("sandbox unavailable: namespaces are only supported on Linux")
+}
+
+func RunSandbox() int {
+	fmt.Fprintln(os.Stderr, "sandbox unavailable: namespaces are only supported on Linux")
+	return 1
+}
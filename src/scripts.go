@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// essentialInterpreters are present on every installation.
+var essentialInterpreters = []string{"sh"}
+
+// interpreterAliases lists packages that install an interpreter under a
+// name other than its own, keyed by the interpreter without its version.
+var interpreterAliases = map[string][]string{
+	"python": {"python3"},
+	"node":   {"nodejs"},
+	"wish":   {"tk"},
+	"tclsh":  {"tcl"},
+	"gawk":   {"awk"},
+}
+
+// shebangInterpreter returns the command a script's #! line runs and the
+// line itself, looking through /usr/bin/env.
+func shebangInterpreter(head []byte) (string, string) {
+	if !bytes.HasPrefix(head, []byte("#!")) {
+		return "", ""
+	}
+	line, _, _ := bytes.Cut(head[2:], []byte("\n"))
+	shebang := strings.TrimSpace(string(line))
+	fields := strings.Fields(shebang)
+	if len(fields) == 0 {
+		return "", shebang
+	}
+	if path.Base(fields[0]) != "env" {
+		return fields[0], shebang
+	}
+	for _, f := range fields[1:] {
+		if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+			return f, shebang
+		}
+	}
+	return "", shebang
+}
+
+// interpreterPackages returns the package names that may supply an
+// interpreter: its own name, without a version suffix, and known aliases.
+func interpreterPackages(name string) []string {
+	base := strings.TrimRight(name, "0123456789.")
+	names := []string{name, base}
+	names = append(names, interpreterAliases[base]...)
+	return slices.Compact(names)
+}
+
+// checkInterpreters reports executable scripts whose interpreter the
+// package neither ships nor depends on, as they fail on a minimal
+// installation.
+func (c *Checker) checkInterpreters(ctx context.Context, dir string, headers []*tar.Header, meta MetadataV2, report *ValidationResponse) {
+	installed := map[string]bool{}
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg || h.Typeflag == tar.TypeSymlink || h.Typeflag == tar.TypeLink {
+			installed[payloadPath(h.Name)] = true
+		}
+	}
+	supplied := map[string]bool{meta.Name: true}
+	for _, rel := range append(slices.Clone(meta.Dependencies), meta.Provides...) {
+		if r, err := ParseRelation(rel); err == nil {
+			supplied[r.Name] = true
+		}
+	}
+
+	for _, h := range headers {
+		if ctx.Err() != nil {
+			return
+		}
+		p := payloadPath(h.Name)
+		if h.Typeflag != tar.TypeReg || h.Mode&0111 == 0 || !strings.HasPrefix(p, "/") {
+			continue
+		}
+		interp, shebang := shebangInterpreter(fileHead(filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(h.Name, "./"))), 256))
+		if interp == "" {
+			continue
+		}
+		name := path.Base(interp)
+		if slices.Contains(essentialInterpreters, name) {
+			continue
+		}
+		if path.IsAbs(interp) && installed[interp] || !path.IsAbs(interp) && (installed["/usr/bin/"+interp] || installed["/bin/"+interp]) {
+			continue
+		}
+		if slices.ContainsFunc(interpreterPackages(name), func(pkg string) bool { return supplied[pkg] }) {
+			continue
+		}
+		c.reportAs(c.Policy.Packaging.Interpreters, fmt.Sprintf("script interpreter not shipped or declared as a dependency: %s runs '%s'", p, shebang), report)
+	}
+}
@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SuiteExpectation is read from <package>.expect.json next to each golden
+// package. Errors and Warnings are substrings that must each match at
+// least one reported finding.
+type SuiteExpectation struct {
+	Valid      bool     `json:"valid"`
+	APGVersion int      `json:"apg_version"`
+	Errors     []string `json:"errors"`
+	Warnings   []string `json:"warnings"`
+}
+
+type SuiteResult struct {
+	File     string   `json:"file"`
+	Passed   bool     `json:"passed"`
+	Problems []string `json:"problems"`
+}
+
+func (c *Checker) RunSuite(dir string) ([]SuiteResult, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.apg"))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no .apg packages found in %s", dir)
+	}
+	sort.Strings(matches)
+
+	var results []SuiteResult
+	for _, pkg := range matches {
+		c.log(fmt.Sprintf("Running case %s...", filepath.Base(pkg)))
+		results = append(results, c.runSuiteCase(pkg))
+	}
+	return results, nil
+}
+
+func (c *Checker) runSuiteCase(pkg string) SuiteResult {
+	result := SuiteResult{File: pkg, Problems: []string{}}
+
+	expectPath := strings.TrimSuffix(pkg, ".apg") + ".expect.json"
+	data, err := os.ReadFile(expectPath)
+	if err != nil {
+		result.Problems = append(result.Problems, fmt.Sprintf("no expectation file: %s", filepath.Base(expectPath)))
+		return result
+	}
+	var expect SuiteExpectation
+	if err := json.Unmarshal(data, &expect); err != nil {
+		result.Problems = append(result.Problems, fmt.Sprintf("expectation invalid JSON: %v", err))
+		return result
+	}
+
+	report, err := c.ValidateFile(pkg, expect.APGVersion)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("extraction error: %v", err))
+	}
+
+	if report.Valid != expect.Valid {
+		result.Problems = append(result.Problems, fmt.Sprintf("expected valid=%t, got valid=%t (errors: %v)", expect.Valid, report.Valid, report.Errors))
+	}
+	result.Problems = append(result.Problems, unmatchedFindings("error", expect.Errors, report.Errors)...)
+	result.Problems = append(result.Problems, unmatchedFindings("warning", expect.Warnings, report.Warnings)...)
+	result.Passed = len(result.Problems) == 0
+	return result
+}
+
+func unmatchedFindings(kind string, expected, actual []string) []string {
+	var problems []string
+	for _, want := range expected {
+		found := false
+		for _, got := range actual {
+			if strings.Contains(got, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("expected %s matching '%s', got: %v", kind, want, actual))
+		}
+	}
+	return problems
+}
+
+type selftestCase struct {
+	name       string
+	apgVersion int
+	mutate     func(dir string) error
+	expect     SuiteExpectation
+}
+
+var selftestCases = []selftestCase{
+	{"valid-v1", 1, nil, SuiteExpectation{Valid: true}},
+	{"valid-v2", 2, nil, SuiteExpectation{Valid: true}},
+	{"missing-md5sums", 1, removeFile("md5sums"),
+		SuiteExpectation{Errors: []string{"required file or directory missing: 'md5sums'"}}},
+	{"md5-mismatch", 1, writeFile("data/usr/bin/hello", "#!/bin/sh\necho tampered\n"),
+		SuiteExpectation{Errors: []string{"MD5 mismatch"}}},
+	{"crc32-mismatch", 2, writeFile("crc32sums", "usr/bin/hello 00000000\n"),
+		SuiteExpectation{Errors: []string{"CRC32 mismatch"}}},
+	{"invalid-json", 1, writeFile("metadata.json", "{"),
+		SuiteExpectation{Errors: []string{"metadata invalid JSON"}}},
+	{"missing-fields", 2, writeFile("metadata.json", `{"name":"hello","version":"1.0"}`),
+		SuiteExpectation{Errors: []string{"missing or empty required metadata fields"}}},
+}
+
+func removeFile(name string) func(string) error {
+	return func(dir string) error {
+		return os.Remove(filepath.Join(dir, name))
+	}
+}
+
+func writeFile(name, content string) func(string) error {
+	return func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+}
+
+// SynthesizeSuite writes a minimal valid package and a set of broken
+// variants, each with its expectation file, to dir.
+func SynthesizeSuite(dir string) error {
+	for _, tc := range selftestCases {
+		tree, err := os.MkdirTemp(dir, tc.name+"-")
+		if err != nil {
+			return err
+		}
+		if err := writeSelftestPackage(tree, tc.apgVersion); err != nil {
+			return err
+		}
+		if tc.mutate != nil {
+			if err := tc.mutate(tree); err != nil {
+				return err
+			}
+		}
+		if err := PackDir(tree, filepath.Join(dir, tc.name+".apg")); err != nil {
+			return err
+		}
+		os.RemoveAll(tree)
+
+		expect := tc.expect
+		expect.APGVersion = tc.apgVersion
+		data, _ := json.Marshal(expect)
+		if err := os.WriteFile(filepath.Join(dir, tc.name+".expect.json"), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSelftestPackage(dir string, apgVersion int) error {
+	dataDir := filepath.Join(dir, "data", "usr", "bin")
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "hello"), []byte("#!/bin/sh\necho hello\n"), 0755); err != nil {
+		return err
+	}
+
+	license := "GPL-3.0-or-later"
+	arch := "x86_64"
+	var meta interface{} = MetadataV1{
+		Name: "hello", Version: "1.0", Architecture: &arch, Description: "apgcheck selftest package",
+		Maintainer: "apgcheck", License: &license, Homepage: "https://nuros.org",
+		Dependencies: []string{}, Conflicts: []string{}, Provides: []string{}, Replaces: []string{},
+	}
+	sums := map[string]string{"md5sums": "MD5"}
+	if apgVersion == 2 {
+		meta = MetadataV2{
+			Name: "hello", Version: "1.0", Type: "binary", Architecture: &arch, Description: "apgcheck selftest package",
+			Maintainer: "apgcheck", License: &license, Tags: []string{"test"}, Homepage: "https://nuros.org",
+			Dependencies: []string{}, Conflicts: []string{}, Provides: []string{}, Replaces: []string{}, Conf: []string{},
+		}
+		sums["crc32sums"] = "CRC32"
+	}
+
+	data, _ := json.MarshalIndent(meta, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, "metadata.json"), data, 0644); err != nil {
+		return err
+	}
+	for file, algo := range sums {
+		content, err := generateSums(filepath.Join(dir, "data"), algo)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+)
+
+// SizePolicy sets the package sizes, in MB, above which a warning or an
+// error is reported. A zero value disables the threshold. Unlike the
+// extraction limits, these do not stop validation.
+type SizePolicy struct {
+	WarnCompressedMB  int64 `json:"warn_compressed_mb"`
+	ErrorCompressedMB int64 `json:"error_compressed_mb"`
+	WarnInstalledMB   int64 `json:"warn_installed_mb"`
+	ErrorInstalledMB  int64 `json:"error_installed_mb"`
+}
+
+// checkSizes records the compressed size of the archive and the installed
+// size of its files, and compares them with the size thresholds.
+func (c *Checker) checkSizes(apgFile string, headers []*tar.Header, report *ValidationResponse) {
+	if fi, err := os.Stat(apgFile); err == nil {
+		report.Archive.CompressedSize = fi.Size()
+	}
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg || h.Typeflag == tar.TypeGNUSparse {
+			report.Archive.InstalledSize += h.Size
+		}
+	}
+
+	p := c.Policy.Size
+	check := func(what string, size, warn, fail int64, key string) {
+		mb := float64(size) / (1024 * 1024)
+		switch {
+		case fail > 0 && size > fail*1024*1024:
+			report.Errors = append(report.Errors, fmt.Sprintf("package too large: %s size %.1f MB is over %d MB (error_%s_mb)", what, mb, fail, key))
+		case warn > 0 && size > warn*1024*1024:
+			report.Warnings = append(report.Warnings, fmt.Sprintf("package is large: %s size %.1f MB is over %d MB (warn_%s_mb)", what, mb, warn, key))
+		}
+	}
+	check("compressed", report.Archive.CompressedSize, p.WarnCompressedMB, p.ErrorCompressedMB, "compressed")
+	check("installed", report.Archive.InstalledSize, p.WarnInstalledMB, p.ErrorInstalledMB, "installed")
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (c *Checker) CheckSource(dir string) (error, error, string) {
+	c.log("Checking the source package structure...")
+	required := []string{"recipe", "sources", "sha256sums", "metadata.json"}
+	for _, name := range required {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return fmt.Errorf("required file or directory missing: '%s'", name), nil, "bad"
+		}
+	}
+
+	recipe, err := os.ReadFile(filepath.Join(dir, "recipe"))
+	if err != nil {
+		return fmt.Errorf("failed to read recipe: %w", err), nil, "bad"
+	}
+	if strings.TrimSpace(string(recipe)) == "" {
+		return fmt.Errorf("build recipe is empty"), nil, "bad"
+	}
+
+	if !c.SkipChecksums {
+		c.log("Verifying SHA256 checksums of sources...")
+		if err := verifyHashesIn(dir, "sha256sums", "sources", "SHA256", c); err != nil {
+			return err, nil, "bad"
+		}
+	} else {
+		c.log("Skipping checksum verification.")
+	}
+
+	listed, err := listedFiles(filepath.Join(dir, "sha256sums"))
+	if err != nil {
+		return err, nil, "bad"
+	}
+	shipped, err := os.ReadDir(filepath.Join(dir, "sources"))
+	if err != nil {
+		return fmt.Errorf("failed to read sources: %w", err), nil, "bad"
+	}
+	for _, e := range shipped {
+		if !e.IsDir() && !listed[e.Name()] {
+			return fmt.Errorf("source file has no checksum in sha256sums: %s", e.Name()), nil, "bad"
+		}
+	}
+
+	c.log("Reading the metadata...")
+	fileData, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err), "bad"
+	}
+
+	var meta MetadataSource
+	if err := json.Unmarshal(fileData, &meta); err != nil {
+		return nil, fmt.Errorf("metadata invalid JSON: %w", err), "bad"
+	}
+
+	c.log("Checking the metadata...")
+	var missingFields []string
+	if meta.Name == "" {
+		missingFields = append(missingFields, "name")
+	}
+	if meta.Version == "" {
+		missingFields = append(missingFields, "version")
+	}
+	if meta.Description == "" {
+		missingFields = append(missingFields, "description")
+	}
+	if meta.Maintainer == "" {
+		missingFields = append(missingFields, "maintainer")
+	}
+	if meta.Homepage == "" {
+		missingFields = append(missingFields, "homepage")
+	}
+	if meta.License == nil {
+		missingFields = append(missingFields, "license")
+	}
+	if len(meta.Sources) == 0 {
+		missingFields = append(missingFields, "sources")
+	}
+	if meta.BuildDependencies == nil {
+		missingFields = append(missingFields, "build_dependencies")
+	}
+	if err := c.checkMetadataKeys(fileData, meta, missingFields); err != nil {
+		return nil, err, "bad"
+	}
+	if err := ValidateVersion(meta.Version, meta.Epoch, meta.Release); err != nil {
+		return nil, err, "bad"
+	}
+
+	for _, src := range meta.Sources {
+		if strings.Contains(src, "://") {
+			continue
+		}
+		if !listed[src] {
+			return nil, fmt.Errorf("declared source not shipped in sources/: %s", src), "bad"
+		}
+	}
+	for _, dep := range meta.BuildDependencies {
+		if _, err := ParseRelation(dep); err != nil {
+			return nil, fmt.Errorf("invalid build dependency: %w", err), "bad"
+		}
+	}
+	return nil, nil, "good"
+}
+
+func listedFiles(sumsPath string) (map[string]bool, error) {
+	data, err := os.ReadFile(sumsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(sumsPath), err)
+	}
+	listed := map[string]bool{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if parts := strings.Fields(line); len(parts) >= 2 {
+			listed[parts[0]] = true
+		}
+	}
+	return listed, nil
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"context"
+	"debug/elf"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// splitMinSize is the size below which content is not worth a subpackage.
+const splitMinSize = 1 << 20
+
+var (
+	docPrefixes = []string{"/usr/share/doc/", "/usr/share/man/", "/usr/share/info/", "/usr/share/gtk-doc/", "/usr/share/help/"}
+	devPrefixes = []string{"/usr/include/", "/usr/share/aclocal/", "/usr/lib/cmake/", "/usr/lib64/cmake/", "/usr/lib/pkgconfig/", "/usr/lib64/pkgconfig/", "/usr/share/pkgconfig/"}
+)
+
+// splitCategory returns the subpackage suffix a file belongs in, or "" for
+// runtime files.
+func splitCategory(installed string) string {
+	switch {
+	case strings.HasPrefix(installed, "/usr/lib/debug/"):
+		return "dbg"
+	case path.Ext(installed) == ".a" || path.Ext(installed) == ".h" || path.Ext(installed) == ".hpp":
+		return "dev"
+	}
+	for _, prefix := range docPrefixes {
+		if strings.HasPrefix(installed, prefix) {
+			return "doc"
+		}
+	}
+	for _, prefix := range devPrefixes {
+		if strings.HasPrefix(installed, prefix) {
+			return "dev"
+		}
+	}
+	return ""
+}
+
+// checkSplits measures documentation, development files and debug
+// information, including debug sections left in ELF files, and suggests a
+// -doc, -dev or -dbg subpackage for any of them that makes up most of the
+// package.
+func (c *Checker) checkSplits(ctx context.Context, dir string, meta MetadataV2, report *ValidationResponse) {
+	var total int64
+	sizes := map[string]int64{}
+	payloadFiles(ctx, dir, func(installed, file string) {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return
+		}
+		total += fi.Size()
+		sizes[splitCategory(installed)] += fi.Size()
+	})
+	c.payloadELFs(ctx, dir, func(installed string, f *elf.File) {
+		if splitCategory(installed) != "" {
+			return
+		}
+		for _, s := range f.Sections {
+			if strings.HasPrefix(s.Name, ".debug_") || strings.HasPrefix(s.Name, ".zdebug_") {
+				sizes["dbg"] += int64(s.FileSize)
+			}
+		}
+	})
+	if total == 0 {
+		return
+	}
+
+	for _, split := range []struct{ suffix, what string }{
+		{"doc", "documentation"},
+		{"dev", "development files"},
+		{"dbg", "debug information"},
+	} {
+		size := sizes[split.suffix]
+		if size < splitMinSize || size*2 <= total || isSplitPackage(meta.Name, split.suffix) {
+			continue
+		}
+		c.reportAs(c.Policy.Packaging.SplitSuggestions, fmt.Sprintf("consider splitting %s-%s: %.1f MB of %s, %d%% of the installed size", meta.Name, split.suffix, float64(size)/(1024*1024), split.what, size*100/total), report)
+	}
+}
+
+// isSplitPackage reports whether a package is already the subpackage for a
+// suffix.
+func isSplitPackage(name, suffix string) bool {
+	switch suffix {
+	case "dev":
+		return isDevPackage(name)
+	case "dbg":
+		return strings.HasSuffix(name, "-dbg") || strings.HasSuffix(name, "-debug") || strings.HasSuffix(name, "-debuginfo")
+	}
+	return strings.HasSuffix(name, "-"+suffix)
+}
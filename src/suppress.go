@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Suppression is an entry of the x-apgcheck metadata extension, which
+// packages use to silence a rule that does not apply to them:
+//
+//	"x-apgcheck": {"suppress": [{"rule": "APG045", "reason": "..."}]}
+type Suppression struct {
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// SuppressedFinding is a finding a suppression removed from the report.
+type SuppressedFinding struct {
+	Finding
+	Reason string `json:"reason"`
+}
+
+// SuppressionPolicy controls in-package suppressions. Errors allows them
+// to silence errors as well as warnings.
+type SuppressionPolicy struct {
+	Enabled bool `json:"enabled"`
+	Errors  bool `json:"errors"`
+}
+
+// readSuppressions returns the suppressions in a package's metadata.
+func readSuppressions(dir string) ([]Suppression, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		return nil, nil
+	}
+	var meta struct {
+		Ext json.RawMessage `json:"x-apgcheck"`
+	}
+	if json.Unmarshal(data, &meta) != nil || meta.Ext == nil {
+		return nil, nil
+	}
+	var ext struct {
+		Suppress []Suppression `json:"suppress"`
+	}
+	if err := json.Unmarshal(meta.Ext, &ext); err != nil {
+		return nil, fmt.Errorf("x-apgcheck must be an object with a 'suppress' list of {\"rule\", \"reason\"} objects")
+	}
+	return ext.Suppress, nil
+}
+
+// applySuppressions moves the findings of suppressed rules from the errors
+// and warnings to report.Suppressed. Each suppression must name a known
+// rule by ID or code and give a reason; errors stay unless the policy
+// allows suppressing them.
+func (c *Checker) applySuppressions(dir string, report *ValidationResponse) {
+	if !c.Policy.Suppressions.Enabled {
+		return
+	}
+	suppressions, err := readSuppressions(dir)
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("invalid suppression: %v", err))
+		return
+	}
+
+	reasons := map[string]string{}
+	var problems []string
+	for _, s := range suppressions {
+		rule, ok := RuleByID(s.Rule)
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("invalid suppression: unknown rule '%s'", s.Rule))
+		case strings.TrimSpace(s.Reason) == "":
+			problems = append(problems, fmt.Sprintf("invalid suppression: %s has no reason", s.Rule))
+		default:
+			reasons[rule.Code] = s.Reason
+		}
+	}
+
+	keep := func(severity string, messages []string) []string {
+		return slices.DeleteFunc(messages, func(m string) bool {
+			reason, ok := reasons[CodeFor(m)]
+			if !ok {
+				return false
+			}
+			if severity == "error" && !c.Policy.Suppressions.Errors {
+				problems = append(problems, fmt.Sprintf("invalid suppression: %s reports an error, which the policy does not allow suppressing: %s", CodeFor(m), m))
+				return false
+			}
+			c.log(fmt.Sprintf("Suppressed %s: %s (%s)", CodeFor(m), m, reason))
+			report.Suppressed = append(report.Suppressed, SuppressedFinding{Finding: newFinding(severity, m), Reason: reason})
+			return true
+		})
+	}
+	report.Errors = keep("error", report.Errors)
+	report.Warnings = keep("warning", report.Warnings)
+	report.Warnings = append(report.Warnings, problems...)
+}
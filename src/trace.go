@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxQueuedSpans bounds the spans held for export, so an unreachable
+// collector does not grow memory; further spans are dropped.
+const maxQueuedSpans = 4096
+
+// SpanContext identifies a span within a trace, as carried in a W3C
+// traceparent header.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats the context as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%x-%x-01", sc.TraceID, sc.SpanID)
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	return sc, sc.IsValid()
+}
+
+// Span is a timed operation reported to the tracer when it ends.
+type Span struct {
+	tracer     *Tracer
+	name       string
+	context    SpanContext
+	parent     [8]byte
+	start, end time.Time
+	attributes map[string]any
+	err        string
+}
+
+// Context returns the span's context, to parent other spans.
+func (s *Span) Context() SpanContext {
+	return s.context
+}
+
+// SetName renames the span, for names known only once it has started.
+func (s *Span) SetName(name string) {
+	s.name = name
+}
+
+// SetAttribute records a string, integer or boolean attribute.
+func (s *Span) SetAttribute(key string, value any) {
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	s.err = err.Error()
+}
+
+func (s *Span) End() {
+	s.end = time.Now()
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	if len(s.tracer.spans) < maxQueuedSpans {
+		s.tracer.spans = append(s.tracer.spans, s)
+	}
+}
+
+// Tracer records spans and exports them to an OpenTelemetry collector
+// over OTLP/HTTP with JSON encoding.
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+	mu       sync.Mutex
+	spans    []*Span
+}
+
+// NewTracer returns a tracer exporting to the OTLP traces endpoint, such
+// as http://localhost:4318/v1/traces, sending the headers with every
+// export.
+func NewTracer(endpoint string, headers map[string]string, service string) *Tracer {
+	return &Tracer{endpoint: endpoint, headers: headers, service: service, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Start starts a span, a child of parent if it is valid and the root of
+// a new trace otherwise.
+func (t *Tracer) Start(name string, parent SpanContext) *Span {
+	s := &Span{tracer: t, name: name, start: time.Now(), attributes: map[string]any{}}
+	if parent.IsValid() {
+		s.context.TraceID, s.parent = parent.TraceID, parent.SpanID
+	} else {
+		rand.Read(s.context.TraceID[:])
+	}
+	rand.Read(s.context.SpanID[:])
+	return s
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+func otlpAttributes(attributes map[string]any) []otlpAttribute {
+	var out []otlpAttribute
+	for key, value := range attributes {
+		var v otlpValue
+		switch value := value.(type) {
+		case bool:
+			v.BoolValue = &value
+		case int:
+			s := strconv.Itoa(value)
+			v.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(value, 10)
+			v.IntValue = &s
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		out = append(out, otlpAttribute{Key: key, Value: v})
+	}
+	return out
+}
+
+// Flush exports the spans that have ended since the last flush. Spans a
+// collector refuses are dropped.
+func (t *Tracer) Flush() error {
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	var out []otlpSpan
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceID:           hex.EncodeToString(s.context.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.context.SpanID[:]),
+			Name:              s.name,
+			Kind:              1,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attributes),
+		}
+		if s.parent != [8]byte{} {
+			o.ParentSpanID = hex.EncodeToString(s.parent[:])
+		}
+		if s.err != "" {
+			o.Status.Code, o.Status.Message = 2, s.err
+		}
+		out = append(out, o)
+	}
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": otlpAttributes(map[string]any{
+				"service.name":    t.service,
+				"service.version": Version,
+			})},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "apgcheck", "version": Version},
+				"spans": out,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot export spans: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot export spans: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("cannot export spans: collector answered %s", resp.Status)
+	}
+	return nil
+}
@@ -3,44 +3,82 @@
 
 package checker
 
+import "time"
+
 const Version = "0.3.0"
 
 type MetadataV1 struct {
-	Name         string   `json:"name"`
-	Version      string   `json:"version"`
-	Architecture *string  `json:"architecture"`
-	Description  string   `json:"description"`
-	Maintainer   string   `json:"maintainer"`
-	License      *string  `json:"license"`
-	Homepage     string   `json:"homepage"`
-	Dependencies []string `json:"dependencies"`
-	Conflicts    []string `json:"conflicts"`
-	Provides     []string `json:"provides"`
-	Replaces     []string `json:"replaces"`
+	Name          string   `json:"name"`
+	Version       string   `json:"version"`
+	Epoch         *int     `json:"epoch,omitempty"`
+	Release       *string  `json:"release,omitempty"`
+	Architecture  *string  `json:"architecture"`
+	Architectures []string `json:"architectures,omitempty"`
+	Description   string   `json:"description"`
+	Maintainer    string   `json:"maintainer"`
+	License       *string  `json:"license"`
+	Homepage      string   `json:"homepage"`
+	Dependencies  []string `json:"dependencies"`
+	Conflicts     []string `json:"conflicts"`
+	Provides      []string `json:"provides"`
+	Replaces      []string `json:"replaces"`
 }
 
 type MetadataV2 struct {
-	Name         string   `json:"name"`
-	Version      string   `json:"version"`
-	Type         string   `json:"type"`
-	Architecture *string  `json:"architecture"`
-	Description  string   `json:"description"`
-	Maintainer   string   `json:"maintainer"`
-	License      *string  `json:"license"`
-	Tags         []string `json:"tags"`
-	Homepage     string   `json:"homepage"`
-	Dependencies []string `json:"dependencies"`
-	Conflicts    []string `json:"conflicts"`
-	Provides     []string `json:"provides"`
-	Replaces     []string `json:"replaces"`
-	Conf         []string `json:"conf"`
+	Name            string            `json:"name"`
+	Version         string            `json:"version"`
+	Epoch           *int              `json:"epoch,omitempty"`
+	Release         *string           `json:"release,omitempty"`
+	Type            string            `json:"type"`
+	Architecture    *string           `json:"architecture"`
+	Architectures   []string          `json:"architectures,omitempty"`
+	Description     string            `json:"description"`
+	DescriptionI18n map[string]string `json:"description_i18n,omitempty"`
+	Maintainer      string            `json:"maintainer"`
+	License         *string           `json:"license"`
+	Tags            []string          `json:"tags"`
+	Icons           []string          `json:"icons,omitempty"`
+	Screenshots     []string          `json:"screenshots,omitempty"`
+	Homepage        string            `json:"homepage"`
+	Dependencies    []string          `json:"dependencies"`
+	Conflicts       []string          `json:"conflicts"`
+	Provides        []string          `json:"provides"`
+	Replaces        []string          `json:"replaces"`
+	Conf            []string          `json:"conf"`
+}
+
+type MetadataSource struct {
+	Name              string   `json:"name"`
+	Version           string   `json:"version"`
+	Epoch             *int     `json:"epoch,omitempty"`
+	Release           *string  `json:"release,omitempty"`
+	Description       string   `json:"description"`
+	Maintainer        string   `json:"maintainer"`
+	License           *string  `json:"license"`
+	Homepage          string   `json:"homepage"`
+	Sources           []string `json:"sources"`
+	BuildDependencies []string `json:"build_dependencies"`
 }
 
 type ValidationResponse struct {
-	Valid    bool                   `json:"valid"`
-	Version  int                    `json:"version"`
-	File     string                 `json:"file"`
-	Metadata map[string]interface{} `json:"metadata,omitempty"`
-	Errors   []string               `json:"errors"`
-	Warnings []string               `json:"warnings"`
+	Valid        bool                   `json:"valid"`
+	Version      int                    `json:"version"`
+	File         string                 `json:"file"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Errors       []string               `json:"errors"`
+	Warnings     []string               `json:"warnings"`
+	Archive      *ArchiveInfo           `json:"archive,omitempty"`
+	Findings     []Finding              `json:"findings"`
+	Fixes        []FixChange            `json:"fixes,omitempty"`
+	Profile      *Profile               `json:"profile,omitempty"`
+	FileLicenses []FileLicense          `json:"file_licenses,omitempty"`
+	Suppressed   []SuppressedFinding    `json:"suppressed,omitempty"`
+	Nested       []NestedPackage        `json:"nested,omitempty"`
+	Files        []string               `json:"-"`
+	// Name and PackageVersion are read from the metadata like Metadata,
+	// but are kept when the package is invalid.
+	Name           string `json:"name,omitempty"`
+	PackageVersion string `json:"package_version,omitempty"`
+	// Duration is how long ValidateFile took, including cache lookups.
+	Duration time.Duration `json:"-"`
 }
@@ -4,8 +4,10 @@
 package checker
 
 import (
+	"cmp"
 	"fmt"
 	"math/rand"
+	"path/filepath"
 	"time"
 )
 
@@ -19,6 +21,12 @@ func GenerateRandomNumber() string {
 	return num
 }
 
+// tempPath returns a fresh path for a temporary directory in TempDir, or in
+// /tmp when it is unset.
+func (c *Checker) tempPath(prefix string) string {
+	return filepath.Join(cmp.Or(c.TempDir, "/tmp"), prefix+GenerateRandomNumber())
+}
+
 func IsEmpty[T comparable](value T) bool {
 	var zero T
 	return value == zero
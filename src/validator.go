@@ -4,25 +4,51 @@
 package checker
 
 import (
+	"archive/tar"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 )
 
 type Checker struct {
-	Verbose       bool
-	SkipChecksums bool
-	Colors        Colors
-	MaxSizeMB     int64
+	Verbose        bool
+	SkipChecksums  bool
+	Colors         Colors
+	Policy         Policy
+	RepoIndex      *RepoIndex
+	BaseManifest   BaseManifest
+	ScanLicenses   bool
+	StrictMetadata bool
+	Cache          *ResultCache
+	SourcePackage  bool
+	Threads        int
+	TempDir        string
+	Sandbox        bool
+	Harden         bool
+	Profiling      bool
+	// Tracer, when set, receives a span for each validation and its
+	// phases, as children of TraceParent if that is valid.
+	Tracer      *Tracer
+	TraceParent SpanContext
+	profile     *Profile
+	span        *Span
+	entries     entryIndex
+	nesting     nesting
 }
 
 func New(verbose, skipChecksums bool, colors Colors, maxSizeMB int64) *Checker {
+	policy := DefaultPolicy()
+	policy.Limits.MaxTotalSizeMB = maxSizeMB
+	policy.Limits.MaxFileSizeMB = maxSizeMB
 	return &Checker{
 		Verbose:       verbose,
 		SkipChecksums: skipChecksums,
 		Colors:        colors,
-		MaxSizeMB:     maxSizeMB,
+		Policy:        policy,
 	}
 }
 
@@ -33,9 +59,230 @@ func (c *Checker) log(detail string) {
 	fmt.Fprintf(os.Stderr, "%s[*] %s %s\n", c.Colors.Blue, detail, c.Colors.Reset)
 }
 
+// ValidateFile validates an APG package. With a cache, results are looked
+// up and stored by the package's SHA-256 digest.
+func (c *Checker) ValidateFile(apgFile string, apgVersion int) (report ValidationResponse, err error) {
+	start := time.Now()
+	defer func() { report.Duration = time.Since(start) }()
+	if c.Tracer != nil {
+		c.span = c.Tracer.Start("validate", c.TraceParent)
+		c.span.SetAttribute("apg.file", apgFile)
+		c.span.SetAttribute("apg.version", apgVersion)
+		defer func() {
+			if err != nil {
+				c.span.SetError(err)
+			} else {
+				c.span.SetAttribute("apg.valid", report.Valid)
+				c.span.SetAttribute("apg.errors", len(report.Errors))
+				c.span.SetAttribute("apg.warnings", len(report.Warnings))
+			}
+			c.span.End()
+			c.span = nil
+		}()
+	}
+	if c.Profiling {
+		c.profile = &Profile{}
+		stop := c.track("total")
+		defer func() {
+			stop()
+			c.profile.close()
+			c.profile.PeakMemoryBytes = max(c.profile.PeakMemoryBytes, peakMemory())
+			report.Profile = c.profile
+			c.profile = nil
+		}()
+	}
+
+	if c.Cache == nil {
+		return c.validate(apgFile, apgVersion)
+	}
+	stop := c.track("cache")
+	digest, err := c.Cache.digest(apgFile)
+	if err != nil {
+		stop()
+		return c.validate(apgFile, apgVersion)
+	}
+	options := c.cacheOptions(apgVersion)
+	cached, ok := c.Cache.lookup(apgFile, digest, options)
+	stop()
+	if ok {
+		c.log(fmt.Sprintf("Using cached result for %s (sha256 %s)", apgFile, digest))
+		return cached, nil
+	}
+
+	report, err = c.validate(apgFile, apgVersion)
+	if err == nil {
+		if err := c.Cache.store(digest, options, report); err != nil {
+			c.log(fmt.Sprintf("Failed to store cached result: %v", err))
+		}
+	}
+	return report, err
+}
+
+// validate validates a package in this process, or in a sandboxed child
+// process when Sandbox is set.
+func (c *Checker) validate(apgFile string, apgVersion int) (ValidationResponse, error) {
+	if c.Sandbox {
+		return c.validateSandboxed(apgFile, apgVersion)
+	}
+	return c.validateFile(apgFile, apgVersion)
+}
+
+func (c *Checker) validateFile(apgFile string, apgVersion int) (ValidationResponse, error) {
+	report := ValidationResponse{
+		Version:  apgVersion,
+		File:     apgFile,
+		Errors:   []string{},
+		Warnings: []string{},
+	}
+	if c.nesting.depth == 0 {
+		c.nesting.seen = new(int)
+	}
+
+	pathToFolderTMP, headers, err := c.extractTemp(apgFile)
+	defer os.RemoveAll(pathToFolderTMP)
+	if err != nil {
+		return report, err
+	}
+
+	if apgVersion == 0 && !c.SourcePackage {
+		apgVersion = detectAPGVersion(pathToFolderTMP)
+		report.Version = apgVersion
+		c.log(fmt.Sprintf("Detected APG v%d layout", apgVersion))
+	}
+
+	var fileErr, jsonErr error
+	var status string
+
+	stop := c.track("check:structure")
+	if c.SourcePackage {
+		fileErr, jsonErr, status = c.CheckSource(pathToFolderTMP)
+	} else if apgVersion == 2 {
+		fileErr, jsonErr, status = c.CheckV2(pathToFolderTMP)
+	} else {
+		fileErr, jsonErr, status = c.CheckV1(pathToFolderTMP)
+	}
+	stop()
+
+	if fileErr != nil {
+		report.Errors = append(report.Errors, fileErr.Error())
+	}
+	if jsonErr != nil {
+		report.Errors = append(report.Errors, jsonErr.Error())
+	}
+	if data, err := os.ReadFile(filepath.Join(pathToFolderTMP, "metadata.json")); err == nil {
+		var meta map[string]interface{}
+		if json.Unmarshal(data, &meta) == nil {
+			m := MetadataFromMap(meta)
+			report.Name, report.PackageVersion = m.Name, m.Version
+		}
+	}
+
+	c.checkEntries(headers, &report)
+	c.checkSizes(apgFile, headers, &report)
+	c.checkCompression(apgFile, &report)
+	if !c.SourcePackage {
+		checkManifestModes(pathToFolderTMP, headers, &report)
+	}
+
+	if len(report.Errors) == 0 && status == "good" {
+		metaData, _ := os.ReadFile(filepath.Join(pathToFolderTMP, "metadata.json"))
+		var meta map[string]interface{}
+		json.Unmarshal(metaData, &meta)
+		report.Metadata = meta
+		trees := []string{"data"}
+		for _, arch := range archTrees(pathToFolderTMP) {
+			trees = append(trees, "data-"+arch)
+		}
+		report.Files = slices.Compact(c.entries.installed(pathToFolderTMP, trees))
+
+		if !c.SourcePackage {
+			typed := MetadataFromMap(meta)
+			checks := []contentCheck{
+				{"changelog-format", func(ctx context.Context, r *ValidationResponse) { c.checkChangelogs(ctx, pathToFolderTMP, typed, r) }},
+				{"static-library", func(ctx context.Context, r *ValidationResponse) {
+					c.checkStaticLibraries(ctx, pathToFolderTMP, typed, r)
+				}},
+				{"bundled-library", func(ctx context.Context, r *ValidationResponse) { c.checkBundledLibraries(ctx, pathToFolderTMP, r) }},
+				{"runpath", func(ctx context.Context, r *ValidationResponse) { c.checkRunpaths(ctx, pathToFolderTMP, r) }},
+				{"elf-hardening", func(ctx context.Context, r *ValidationResponse) { c.checkHardening(ctx, pathToFolderTMP, r) }},
+				{"script-interpreter", func(ctx context.Context, r *ValidationResponse) {
+					c.checkInterpreters(ctx, pathToFolderTMP, headers, typed, r)
+				}},
+				{"content-mismatch", func(ctx context.Context, r *ValidationResponse) { c.checkContentTypes(ctx, pathToFolderTMP, r) }},
+				{"conf-text", func(ctx context.Context, r *ValidationResponse) { c.checkConfigText(ctx, pathToFolderTMP, r) }},
+				{"runtime-path", func(_ context.Context, r *ValidationResponse) { c.checkRuntimePaths(headers, r) }},
+				{"split-package", func(ctx context.Context, r *ValidationResponse) { c.checkSplits(ctx, pathToFolderTMP, typed, r) }},
+				{"provides-name", func(ctx context.Context, r *ValidationResponse) {
+					c.checkProvides(ctx, pathToFolderTMP, typed, report.Files, r)
+				}},
+				{"self-relation", func(_ context.Context, r *ValidationResponse) { r.Warnings = checkSelfRelations(typed) }},
+			}
+			if apgVersion == 2 {
+				checks = append(checks, contentCheck{"conf-path", func(_ context.Context, r *ValidationResponse) { c.checkConfFiles(typed, report.Files, r) }})
+			}
+			if c.ScanLicenses {
+				checks = append(checks, contentCheck{"file-license", func(ctx context.Context, r *ValidationResponse) {
+					c.log("Scanning files for licenses...")
+					c.scanLicenses(ctx, pathToFolderTMP, typed, r)
+				}})
+			}
+			if c.BaseManifest != nil {
+				checks = append(checks, contentCheck{"base-file-overlap", func(_ context.Context, r *ValidationResponse) {
+					c.log("Checking for base system files...")
+					c.checkBaseOverlap(typed, report.Files, r)
+				}})
+			}
+			c.runContentChecks(checks, &report)
+			c.checkNested(pathToFolderTMP, report.Files, &report)
+		}
+
+		if c.RepoIndex != nil && c.SourcePackage {
+			var src MetadataSource
+			json.Unmarshal(metaData, &src)
+			c.log("Resolving build dependencies against the repository index...")
+			report.Errors = append(report.Errors, c.checkDependencies(src.BuildDependencies)...)
+		} else if c.RepoIndex != nil {
+			typed := MetadataFromMap(meta)
+			c.log("Resolving dependencies against the repository index...")
+			report.Errors = append(report.Errors, c.checkDependencies(typed.Dependencies)...)
+			c.log("Checking for version regressions...")
+			report.Errors = append(report.Errors, c.checkVersionRegression(typed)...)
+			c.log("Checking license compatibility...")
+			report.Warnings = append(report.Warnings, c.checkLicenses(typed)...)
+		}
+	}
+
+	c.applySuppressions(pathToFolderTMP, &report)
+	report.Valid = len(report.Errors) == 0 && status == "good"
+	if !report.Valid {
+		report.Metadata = nil
+	}
+	report.annotate()
+	return report, nil
+}
+
+func (c *Checker) extractTemp(apgFile string) (string, []*tar.Header, error) {
+	dir := c.tempPath("apgcheck-")
+	defer c.track("extract")()
+	headers, err := ExtractTarXz(apgFile, dir, c)
+	return dir, headers, err
+}
+
+func detectAPGVersion(dir string) int {
+	if _, err := os.Stat(filepath.Join(dir, "crc32sums")); err == nil {
+		return 2
+	}
+	return 1
+}
+
 func (c *Checker) CheckV1(dir string) (error, error, string) {
 	c.log("Checking the archive structure...")
-	required := []string{"data", "md5sums", "metadata.json"}
+	arches := archTrees(dir)
+	required := []string{"data", "metadata.json"}
+	if len(arches) > 0 {
+		c.log(fmt.Sprintf("Multi-architecture package: %v", arches))
+		required = []string{"metadata.json"}
+	}
 	for _, name := range required {
 		path := filepath.Join(dir, name)
 		if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -43,13 +290,14 @@ func (c *Checker) CheckV1(dir string) (error, error, string) {
 		}
 	}
 
-	if !c.SkipChecksums {
-		c.log("Verifying MD5 checksums...")
-		if err := verifyHashes(dir, "md5sums", "MD5", c); err != nil {
+	if len(arches) > 0 {
+		if err := c.checkArchPayloads(dir, arches, []string{"md5sums"}); err != nil {
 			return err, nil, "bad"
 		}
-	} else {
-		c.log("Skipping checksum verification.")
+	} else if err := requireManifests(dir, "data", []string{"md5sums"}); err != nil {
+		return err, nil, "bad"
+	} else if err := c.verifyPayload(dir, "data", []string{"md5sums"}); err != nil {
+		return err, nil, "bad"
 	}
 
 	c.log("Reading the metadata...")
@@ -103,15 +351,28 @@ func (c *Checker) CheckV1(dir string) (error, error, string) {
 		missingFields = append(missingFields, "replaces")
 	}
 
-	if len(missingFields) > 0 {
-		return nil, fmt.Errorf("missing or empty required metadata fields: %v", missingFields), "bad"
+	if err := c.checkMetadataKeys(fileData, meta, missingFields); err != nil {
+		return nil, err, "bad"
+	}
+	if err := ValidateVersion(meta.Version, meta.Epoch, meta.Release); err != nil {
+		return nil, err, "bad"
+	}
+	if len(arches) > 0 {
+		if err := checkDeclaredArches(meta.Architectures, arches); err != nil {
+			return nil, err, "bad"
+		}
 	}
 	return nil, nil, "good"
 }
 
 func (c *Checker) CheckV2(dir string) (error, error, string) {
 	c.log("Checking the archive structure...")
-	required := []string{"data", "md5sums", "crc32sums", "metadata.json"}
+	arches := archTrees(dir)
+	required := []string{"data", "metadata.json"}
+	if len(arches) > 0 {
+		c.log(fmt.Sprintf("Multi-architecture package: %v", arches))
+		required = []string{"metadata.json"}
+	}
 	for _, name := range required {
 		path := filepath.Join(dir, name)
 		if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -119,17 +380,14 @@ func (c *Checker) CheckV2(dir string) (error, error, string) {
 		}
 	}
 
-	if !c.SkipChecksums {
-		c.log("Verifying MD5 checksums...")
-		if err := verifyHashes(dir, "md5sums", "MD5", c); err != nil {
-			return err, nil, "bad"
-		}
-		c.log("Verifying CRC32 checksums...")
-		if err := verifyHashes(dir, "crc32sums", "CRC32", c); err != nil {
+	if len(arches) > 0 {
+		if err := c.checkArchPayloads(dir, arches, []string{"md5sums", "crc32sums"}); err != nil {
 			return err, nil, "bad"
 		}
-	} else {
-		c.log("Skipping checksum verification.")
+	} else if err := requireManifests(dir, "data", []string{"md5sums", "crc32sums"}); err != nil {
+		return err, nil, "bad"
+	} else if err := c.verifyPayload(dir, "data", []string{"md5sums", "crc32sums"}); err != nil {
+		return err, nil, "bad"
 	}
 
 	c.log("Reading the metadata...")
@@ -195,8 +453,25 @@ func (c *Checker) CheckV2(dir string) (error, error, string) {
 		missingFields = append(missingFields, "conf")
 	}
 
-	if len(missingFields) > 0 {
-		return nil, fmt.Errorf("missing or empty required metadata fields: %v", missingFields), "bad"
+	if err := c.checkMetadataKeys(fileData, meta, missingFields); err != nil {
+		return nil, err, "bad"
+	}
+	if err := ValidateVersion(meta.Version, meta.Epoch, meta.Release); err != nil {
+		return nil, err, "bad"
+	}
+	if err := validateDescriptions(meta.DescriptionI18n); err != nil {
+		return nil, err, "bad"
+	}
+	if err := validateImages(dir, "icons", meta.Icons); err != nil {
+		return nil, err, "bad"
+	}
+	if err := validateImages(dir, "screenshots", meta.Screenshots); err != nil {
+		return nil, err, "bad"
+	}
+	if len(arches) > 0 {
+		if err := checkDeclaredArches(meta.Architectures, arches); err != nil {
+			return nil, err, "bad"
+		}
 	}
 	return nil, nil, "good"
 }
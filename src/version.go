@@ -0,0 +1,199 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CompareVersions orders versions of the form [epoch:]upstream[-release]
+// and returns -1, 0 or 1. Segments are compared dpkg-style: digit runs
+// numerically, everything else lexically with '~' sorting first.
+func CompareVersions(a, b string) int {
+	ea, ua, ra := splitVersion(a)
+	eb, ub, rb := splitVersion(b)
+	if ea != eb {
+		if ea < eb {
+			return -1
+		}
+		return 1
+	}
+	if c := compareSegments(ua, ub); c != 0 {
+		return c
+	}
+	return compareSegments(ra, rb)
+}
+
+func splitVersion(v string) (int, string, string) {
+	epoch := 0
+	if i := strings.Index(v, ":"); i >= 0 {
+		epoch, _ = strconv.Atoi(v[:i])
+		v = v[i+1:]
+	}
+	release := ""
+	if i := strings.LastIndex(v, "-"); i >= 0 {
+		release = v[i+1:]
+		v = v[:i]
+	}
+	return epoch, v, release
+}
+
+func compareSegments(a, b string) int {
+	for a != "" || b != "" {
+		var na, nb string
+		na, a = splitPrefix(a, false)
+		nb, b = splitPrefix(b, false)
+		if c := compareLexical(na, nb); c != 0 {
+			return c
+		}
+
+		na, a = splitPrefix(a, true)
+		nb, b = splitPrefix(b, true)
+		if c := compareNumeric(na, nb); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func splitPrefix(s string, digits bool) (string, string) {
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9') == digits {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func lexicalOrder(c byte) int {
+	switch {
+	case c == '~':
+		return -1
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
+
+func compareLexical(a, b string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var oa, ob int
+		if i < len(a) {
+			oa = lexicalOrder(a[i])
+		}
+		if i < len(b) {
+			ob = lexicalOrder(b[i])
+		}
+		if oa != ob {
+			if oa < ob {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func compareNumeric(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// FullVersion folds the separate epoch and release metadata fields into
+// the version, so versions compare the same however they are written.
+func FullVersion(version string, epoch *int, release *string) string {
+	if epoch != nil {
+		version = strconv.Itoa(*epoch) + ":" + version
+	}
+	if release != nil {
+		version += "-" + *release
+	}
+	return version
+}
+
+// ValidateVersion checks that a version splits into epoch, upstream
+// version and release in exactly one way, and that the separate epoch and
+// release fields, when set, are not given in the version as well.
+func ValidateVersion(version string, epoch *int, release *string) error {
+	rest := version
+	if i := strings.Index(rest, ":"); i >= 0 {
+		if epoch != nil {
+			return fmt.Errorf("invalid version '%s': epoch is set both in the version and in 'epoch'", version)
+		}
+		e := rest[:i]
+		if e == "" || strings.Trim(e, "0123456789") != "" {
+			return fmt.Errorf("invalid version '%s': epoch '%s' is not a non-negative integer", version, e)
+		}
+		if len(e) > 1 && e[0] == '0' {
+			return fmt.Errorf("invalid version '%s': epoch '%s' has leading zeros", version, e)
+		}
+		rest = rest[i+1:]
+		if strings.Contains(rest, ":") {
+			return fmt.Errorf("invalid version '%s': more than one ':'", version)
+		}
+	}
+	if epoch != nil && *epoch < 0 {
+		return fmt.Errorf("invalid epoch %d: must be a non-negative integer", *epoch)
+	}
+
+	upstream := rest
+	if i := strings.Index(rest, "-"); i >= 0 {
+		if release != nil {
+			return fmt.Errorf("invalid version '%s': release is set both in the version and in 'release'", version)
+		}
+		upstream = rest[:i]
+		if err := validateRelease(rest[i+1:]); err != nil {
+			return fmt.Errorf("invalid version '%s': %w", version, err)
+		}
+	}
+	if release != nil {
+		if err := validateRelease(*release); err != nil {
+			return fmt.Errorf("invalid release '%s': %w", *release, err)
+		}
+	}
+
+	if upstream == "" {
+		return fmt.Errorf("invalid version '%s': upstream version is empty", version)
+	}
+	if upstream[0] < '0' || upstream[0] > '9' {
+		return fmt.Errorf("invalid version '%s': upstream version must start with a digit", version)
+	}
+	if c, ok := invalidVersionChar(upstream); ok {
+		return fmt.Errorf("invalid version '%s': character %q is not allowed", version, c)
+	}
+	return nil
+}
+
+func validateRelease(release string) error {
+	if release == "" {
+		return fmt.Errorf("release is empty")
+	}
+	if strings.Contains(release, "-") {
+		return fmt.Errorf("release contains '-', so it is ambiguous")
+	}
+	if c, ok := invalidVersionChar(release); ok {
+		return fmt.Errorf("character %q is not allowed in the release", c)
+	}
+	return nil
+}
+
+// invalidVersionChar returns the first character that may not appear in
+// an upstream version or release: anything but letters, digits and . + ~ _
+func invalidVersionChar(s string) (rune, bool) {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || strings.ContainsRune(".+~_", c)) {
+			return c, true
+		}
+	}
+	return 0, false
+}
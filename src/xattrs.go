@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"archive/tar"
+	"cmp"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// EntryXattrs lists the extended attributes stored for an archive entry.
+type EntryXattrs struct {
+	Path  string   `json:"path"`
+	Names []string `json:"names"`
+}
+
+// entryXattrs returns the names of the extended attributes of an entry,
+// from both GNU tar (SCHILY.xattr) and libarchive (LIBARCHIVE.xattr, with
+// URL-encoded names) PAX records.
+func entryXattrs(h *tar.Header) []string {
+	var names []string
+	for key := range h.PAXRecords {
+		if name, ok := strings.CutPrefix(key, "SCHILY.xattr."); ok {
+			names = append(names, name)
+		} else if name, ok := strings.CutPrefix(key, "LIBARCHIVE.xattr."); ok {
+			if unescaped, err := url.PathUnescape(name); err == nil {
+				name = unescaped
+			}
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// xattrAllowed reports whether a name matches one of the allowed patterns.
+// security.capability is governed by AllowedCapabilities instead.
+func xattrAllowed(name string, allowed []string) bool {
+	if name == "security.capability" {
+		return true
+	}
+	for _, pattern := range allowed {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkXattrs lists the extended attributes in the archive and, when the
+// policy restricts them, reports the ones it does not allow.
+func (c *Checker) checkXattrs(headers []*tar.Header, report *ValidationResponse) {
+	allowed := c.Policy.Archive.AllowedXattrs
+	for _, h := range headers {
+		names := entryXattrs(h)
+		if len(names) == 0 {
+			continue
+		}
+		p := payloadPath(h.Name)
+		report.Archive.Xattrs = append(report.Archive.Xattrs, EntryXattrs{Path: p, Names: names})
+		c.log(fmt.Sprintf("Extended attributes: %s %s", p, strings.Join(names, ", ")))
+		if allowed == nil {
+			continue
+		}
+		var denied []string
+		for _, name := range names {
+			if !xattrAllowed(name, allowed) {
+				denied = append(denied, name)
+			}
+		}
+		if len(denied) > 0 {
+			report.Errors = append(report.Errors, fmt.Sprintf("extended attributes are not allowed by policy (allowed: %s): %s has %s", cmp.Or(strings.Join(allowed, ", "), "none"), p, strings.Join(denied, ", ")))
+		}
+	}
+}
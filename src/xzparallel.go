@@ -0,0 +1,475 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// maxParallelBlock bounds the uncompressed size of a block decoded in
+// memory. Archives with larger blocks are decompressed sequentially.
+const maxParallelBlock = 256 * 1024 * 1024
+
+var errNotParallel = errors.New("xz file cannot be decoded in parallel")
+
+type xzBlock struct {
+	dataOff      int64
+	compressed   int64
+	uncompressed int64
+	dictCap      int
+	check        byte
+}
+
+// openXZ returns a decompressing reader for an xz file. Files with several
+// blocks, as written by `xz -T` or pixz, are decoded by up to c.Threads
+// workers in parallel, holding at most max_memory_mb of decoded blocks and
+// dictionaries in memory. Everything else, including archives with a block
+// too large for the memory budget, falls back to the streaming decoder,
+// which also reads all concatenated streams. An uncompressed tar, such as
+// an intermediate build artifact, is read as it is.
+func (c *Checker) openXZ(f *os.File) (io.ReadCloser, error) {
+	if isTar(f) {
+		c.log("Archive is an uncompressed tar")
+		return io.NopCloser(f), nil
+	}
+	r, err := c.openXZReader(f)
+	if err != nil || c.profile == nil {
+		return r, err
+	}
+	return &timedReader{r: r, profile: c.profile}, nil
+}
+
+// isTar reports whether a file starts with a tar header.
+func isTar(f *os.File) bool {
+	header := make([]byte, 512)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return false
+	}
+	return IsTarHeader(header)
+}
+
+// IsTarHeader reports whether a 512-byte block is a tar header, recognised
+// by its checksum since old tar formats have no magic.
+func IsTarHeader(header []byte) bool {
+	if len(header) < 512 {
+		return false
+	}
+	stored, err := strconv.ParseUint(strings.Trim(string(header[148:156]), " \x00"), 8, 32)
+	if err != nil {
+		return false
+	}
+	sum := uint64(8 * ' ')
+	for i, b := range header[:512] {
+		if i < 148 || i >= 156 {
+			sum += uint64(b)
+		}
+	}
+	return sum == stored
+}
+
+func (c *Checker) openXZReader(f *os.File) (io.ReadCloser, error) {
+	threads := c.Threads
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	budget := c.Policy.Limits.MaxMemoryMB * 1024 * 1024
+	if threads > 1 {
+		blocks, err := planXZBlocks(f)
+		if err == nil && len(blocks) > 1 && blocksFit(blocks, budget) {
+			c.log(fmt.Sprintf("Decompressing %d xz blocks with %d threads", len(blocks), threads))
+			return newParallelXZ(f, blocks, threads, budget), nil
+		}
+		if err == nil && len(blocks) > 1 {
+			c.log("xz blocks exceed the memory budget, decompressing sequentially")
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	r, err := xz.ReaderConfig{SingleStream: false}.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(r), nil
+}
+
+// planXZBlocks locates every block of every stream through the stream
+// indexes, walking the file backwards from the last stream footer.
+func planXZBlocks(f *os.File) ([]xzBlock, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var blocks []xzBlock
+	pos := fi.Size()
+	for pos > 0 {
+		var pad [4]byte
+		if pos >= 4 {
+			if _, err := f.ReadAt(pad[:], pos-4); err != nil {
+				return nil, err
+			}
+			if pad == [4]byte{} {
+				pos -= 4
+				continue
+			}
+		}
+		streamBlocks, start, err := planXZStream(f, pos)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(streamBlocks, blocks...)
+		pos = start
+	}
+	return blocks, nil
+}
+
+func planXZStream(f *os.File, end int64) ([]xzBlock, int64, error) {
+	if end < 24 {
+		return nil, 0, errNotParallel
+	}
+	footer := make([]byte, 12)
+	if _, err := f.ReadAt(footer, end-12); err != nil {
+		return nil, 0, err
+	}
+	if string(footer[10:]) != "YZ" || crc32.ChecksumIEEE(footer[4:10]) != binary.LittleEndian.Uint32(footer) {
+		return nil, 0, errNotParallel
+	}
+	check := footer[9] & 0x0f
+	if _, ok := xzCheckSizes[check]; !ok {
+		return nil, 0, errNotParallel
+	}
+
+	indexSize := (int64(binary.LittleEndian.Uint32(footer[4:8])) + 1) * 4
+	indexStart := end - 12 - indexSize
+	if indexStart < 12 {
+		return nil, 0, errNotParallel
+	}
+	index := make([]byte, indexSize)
+	if _, err := f.ReadAt(index, indexStart); err != nil {
+		return nil, 0, err
+	}
+	records, err := parseXZIndex(index, indexStart-12)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	for _, r := range records {
+		total += (r[0] + 3) &^ 3
+		if total > indexStart-12 {
+			return nil, 0, errNotParallel
+		}
+	}
+	start := indexStart - total - 12
+	if start < 0 {
+		return nil, 0, errNotParallel
+	}
+	header := make([]byte, 12)
+	if _, err := f.ReadAt(header, start); err != nil {
+		return nil, 0, err
+	}
+	if string(header[:6]) != "\xfd7zXZ\x00" || !bytes.Equal(header[6:8], footer[8:10]) {
+		return nil, 0, errNotParallel
+	}
+
+	var blocks []xzBlock
+	off := start + 12
+	for _, r := range records {
+		b, err := readXZBlockHeader(f, off, r[0], r[1], check)
+		if err != nil {
+			return nil, 0, err
+		}
+		blocks = append(blocks, b)
+		off += (r[0] + 3) &^ 3
+	}
+	return blocks, start, nil
+}
+
+var xzCheckSizes = map[byte]int64{0x00: 0, 0x01: 4, 0x04: 8, 0x0a: 32}
+
+// parseXZIndex returns the (unpadded size, uncompressed size) record of
+// every block listed in a stream index. The index comes from an untrusted
+// footer, so every field is checked against what is left of it, and no
+// block may be larger than the maxBlocks bytes in front of the index.
+func parseXZIndex(index []byte, maxBlocks int64) ([][2]int64, error) {
+	// An index holds at least its indicator, a record count and its CRC32.
+	if len(index) < 8 {
+		return nil, errNotParallel
+	}
+	body := index[:len(index)-4]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(index[len(index)-4:]) || body[0] != 0 {
+		return nil, errNotParallel
+	}
+	br := bytes.NewReader(body[1:])
+	count, err := binary.ReadUvarint(br)
+	// Every record takes at least two bytes.
+	if err != nil || count > uint64(br.Len()/2) {
+		return nil, errNotParallel
+	}
+	var records [][2]int64
+	for i := uint64(0); i < count; i++ {
+		unpadded, err1 := binary.ReadUvarint(br)
+		uncompressed, err2 := binary.ReadUvarint(br)
+		if err1 != nil || err2 != nil || unpadded == 0 || unpadded > uint64(maxBlocks) || uncompressed > maxParallelBlock {
+			return nil, errNotParallel
+		}
+		records = append(records, [2]int64{int64(unpadded), int64(uncompressed)})
+	}
+	return records, nil
+}
+
+// readXZBlockHeader accepts only the common single-filter LZMA2 blocks.
+func readXZBlockHeader(f *os.File, off, unpadded, uncompressed int64, check byte) (xzBlock, error) {
+	var size [1]byte
+	if _, err := f.ReadAt(size[:], off); err != nil {
+		return xzBlock{}, err
+	}
+	headerSize := (int64(size[0]) + 1) * 4
+	if size[0] == 0 {
+		return xzBlock{}, errNotParallel
+	}
+	header := make([]byte, headerSize)
+	if _, err := f.ReadAt(header, off); err != nil {
+		return xzBlock{}, err
+	}
+	if crc32.ChecksumIEEE(header[:headerSize-4]) != binary.LittleEndian.Uint32(header[headerSize-4:]) {
+		return xzBlock{}, errNotParallel
+	}
+
+	flags := header[1]
+	if flags&0x03 != 0 {
+		return xzBlock{}, errNotParallel
+	}
+	br := bytes.NewReader(header[2 : headerSize-4])
+	if flags&0x40 != 0 {
+		binary.ReadUvarint(br)
+	}
+	if flags&0x80 != 0 {
+		binary.ReadUvarint(br)
+	}
+	id, err1 := binary.ReadUvarint(br)
+	propsSize, err2 := binary.ReadUvarint(br)
+	props, err3 := br.ReadByte()
+	if err1 != nil || err2 != nil || err3 != nil || id != 0x21 || propsSize != 1 || props > 40 {
+		return xzBlock{}, errNotParallel
+	}
+
+	dictCap := int64(0xffffffff)
+	if props < 40 {
+		dictCap = int64(2|props&1) << (props/2 + 11)
+	}
+	// A block never refers back further than its own start.
+	dictCap = min(dictCap, max(uncompressed, lzma.MinDictCap))
+
+	compressed := unpadded - headerSize - xzCheckSizes[check]
+	if compressed <= 0 {
+		return xzBlock{}, errNotParallel
+	}
+	return xzBlock{
+		dataOff:      off + headerSize,
+		compressed:   compressed,
+		uncompressed: uncompressed,
+		dictCap:      int(dictCap),
+		check:        check,
+	}, nil
+}
+
+// cost is the memory a block takes while it is decoded: its output and the
+// LZMA2 dictionary.
+func (b xzBlock) cost() int64 {
+	return b.uncompressed + int64(b.dictCap)
+}
+
+func blocksFit(blocks []xzBlock, budget int64) bool {
+	if budget <= 0 {
+		return true
+	}
+	for _, b := range blocks {
+		if b.cost() > budget {
+			return false
+		}
+	}
+	return true
+}
+
+// memoryBudget is a weighted semaphore over bytes of memory. A zero limit
+// admits everything.
+type memoryBudget struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int64
+	used   int64
+	closed bool
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	m := &memoryBudget{limit: limit}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+func (m *memoryBudget) acquire(n int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for m.limit > 0 && m.used > 0 && m.used+n > m.limit && !m.closed {
+		m.cond.Wait()
+	}
+	m.used += n
+	return !m.closed
+}
+
+func (m *memoryBudget) release(n int64) {
+	m.mu.Lock()
+	m.used -= n
+	m.mu.Unlock()
+	m.cond.Broadcast()
+}
+
+func (m *memoryBudget) close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	m.cond.Broadcast()
+}
+
+type blockResult struct {
+	data []byte
+	err  error
+}
+
+// parallelXZ decodes blocks concurrently and hands them out in order. At
+// most threads blocks, within the memory budget, are decoded or waiting to
+// be read at any time.
+type parallelXZ struct {
+	blocks  []xzBlock
+	results []chan blockResult
+	slots   chan struct{}
+	memory  *memoryBudget
+	done    chan struct{}
+	cur     []byte
+	next    int
+	err     error
+}
+
+func newParallelXZ(f *os.File, blocks []xzBlock, threads int, budget int64) *parallelXZ {
+	p := &parallelXZ{
+		blocks:  blocks,
+		results: make([]chan blockResult, len(blocks)),
+		slots:   make(chan struct{}, threads),
+		memory:  newMemoryBudget(budget),
+		done:    make(chan struct{}),
+	}
+	for i := range p.results {
+		p.results[i] = make(chan blockResult, 1)
+	}
+	go func() {
+		for i, b := range blocks {
+			select {
+			case p.slots <- struct{}{}:
+			case <-p.done:
+				return
+			}
+			if !p.memory.acquire(b.cost()) {
+				return
+			}
+			go func() {
+				data, err := decodeXZBlock(f, b)
+				if err != nil {
+					err = fmt.Errorf("xz block %d: %w", i, err)
+				}
+				p.results[i] <- blockResult{data, err}
+			}()
+		}
+	}()
+	return p
+}
+
+func (p *parallelXZ) Read(buf []byte) (int, error) {
+	for len(p.cur) == 0 {
+		if p.err != nil {
+			return 0, p.err
+		}
+		if p.next == len(p.results) {
+			return 0, io.EOF
+		}
+		r := <-p.results[p.next]
+		<-p.slots
+		p.memory.release(p.blocks[p.next].cost())
+		p.next++
+		p.cur, p.err = r.data, r.err
+	}
+	n := copy(buf, p.cur)
+	p.cur = p.cur[n:]
+	return n, nil
+}
+
+func (p *parallelXZ) Close() error {
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+		p.memory.close()
+	}
+	return nil
+}
+
+func decodeXZBlock(f *os.File, b xzBlock) ([]byte, error) {
+	section := io.NewSectionReader(f, b.dataOff, b.compressed)
+	r, err := lzma.Reader2Config{DictCap: b.dictCap}.NewReader2(section)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, b.uncompressed+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != b.uncompressed {
+		return nil, fmt.Errorf("uncompressed size mismatch, expected: %d, got: %d", b.uncompressed, len(data))
+	}
+
+	if b.check == 0 {
+		return data, nil
+	}
+	stored := make([]byte, xzCheckSizes[b.check])
+	if _, err := f.ReadAt(stored, b.dataOff+(b.compressed+3)&^3); err != nil {
+		return nil, err
+	}
+	var h hash.Hash
+	switch b.check {
+	case 0x01:
+		h = crc32.NewIEEE()
+	case 0x04:
+		h = crc64.New(crc64.MakeTable(crc64.ECMA))
+	case 0x0a:
+		h = sha256.New()
+	}
+	h.Write(data)
+	sum := h.Sum(nil)
+	if b.check != 0x0a {
+		// CRC32 and CRC64 are stored little-endian.
+		for i, j := 0, len(sum)-1; i < j; i, j = i+1, j-1 {
+			sum[i], sum[j] = sum[j], sum[i]
+		}
+	}
+	if !bytes.Equal(sum, stored) {
+		return nil, fmt.Errorf("integrity check failed")
+	}
+	return data, nil
+}
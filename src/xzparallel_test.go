@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package checker
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// xzFooter returns a valid stream footer for an index of indexSize bytes
+// in a stream without integrity check.
+func xzFooter(indexSize int) []byte {
+	footer := make([]byte, 12)
+	binary.LittleEndian.PutUint32(footer[4:], uint32(indexSize/4-1))
+	copy(footer[10:], "YZ")
+	binary.LittleEndian.PutUint32(footer, crc32.ChecksumIEEE(footer[4:10]))
+	return footer
+}
+
+func TestPlanXZBlocksRejectsBadIndexes(t *testing.T) {
+	header := []byte("\xfd7zXZ\x00\x00\x00")
+	header = binary.LittleEndian.AppendUint32(header, crc32.ChecksumIEEE(header[6:8]))
+
+	// withCRC appends the CRC32 an index ends with.
+	withCRC := func(body ...byte) []byte {
+		return binary.LittleEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+	}
+	tests := []struct {
+		name  string
+		index []byte
+	}{
+		{"zero-size index", []byte{0, 0, 0, 0}},
+		{"truncated record count", withCRC(0, 0x80, 0x80, 0x80)},
+		{"more records than bytes", withCRC(0, 0x7f, 0, 0)},
+		{"truncated record", withCRC(0, 1, 0x80, 0)},
+		{"block larger than the stream", withCRC(0, 1, 0xff, 0x7f, 1, 0, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append([]byte{}, header...)
+			data = append(data, make([]byte, 16)...)
+			data = append(data, tt.index...)
+			data = append(data, xzFooter(len(tt.index))...)
+			path := filepath.Join(t.TempDir(), "evil.apg")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			if _, err := planXZBlocks(f); err == nil {
+				t.Error("planXZBlocks() succeeded on a corrupt index")
+			}
+			c := testChecker(t)
+			c.Threads = 4
+			r, err := c.openXZReader(f)
+			if err == nil {
+				_, err = io.Copy(io.Discard, r)
+			}
+			if err == nil {
+				t.Error("decompressing a corrupt stream succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+// SPDX-FileCopyrightText: m1lkydev, AnmiTaliDev
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func enterRawMode(fd int) (func(), error) {
+	return nil, errors.New("the interactive UI is only supported on Linux")
+}
+
+func terminalSize(fd int) (int, int) {
+	return 80, 24
+}
+
+func notifyResize() <-chan os.Signal {
+	return nil
+}